@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/raft"
+	pb "github.com/triplewy/simpledb/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// StatusRPC returns this node's view of the raft cluster
+func (node *Node) StatusRPC(ctx context.Context, msg *pb.EmptyMsg) (*pb.StatusMsg, error) {
+	f := node.raft.GetConfiguration()
+	if err := f.Error(); err != nil {
+		return nil, node.raftError(err)
+	}
+	stats := node.raft.Stats()
+	term, err := parseStat(stats, "term")
+	if err != nil {
+		return nil, err
+	}
+	commitIndex, err := parseStat(stats, "commit_index")
+	if err != nil {
+		return nil, err
+	}
+	clusterVersion, err := node.clusterFeatureVersion()
+	if err != nil {
+		return nil, err
+	}
+	appliedIndex := node.raft.AppliedIndex()
+	leader := node.raft.Leader()
+	localID := node.localID()
+
+	servers := []*pb.ServerStatus{}
+	for _, server := range f.Configuration().Servers {
+		status := &pb.ServerStatus{
+			Id:             string(server.ID),
+			Address:        string(server.Address),
+			Suffrage:       suffrageToPb(server.Suffrage),
+			Leader:         server.Address == leader,
+			LastContact:    node.serverLastContact(server.ID),
+			ReplicationLag: node.serverReplicationLag(server.ID),
+		}
+		servers = append(servers, status)
+	}
+	return &pb.StatusMsg{
+		Id:                    string(localID),
+		State:                 node.raft.State().String(),
+		Leader:                string(leader),
+		Term:                  term,
+		CommitIndex:           commitIndex,
+		AppliedIndex:          appliedIndex,
+		Servers:               servers,
+		RpcAddress:            node.rpcAdvertise,
+		ReplicationLag:        node.replicationLag(),
+		FeatureVersion:        uint32(featureVersion),
+		ClusterFeatureVersion: uint32(clusterVersion),
+	}, nil
+}
+
+// TransferLeadershipRPC hands leadership to the given server, or to the most
+// up to date follower if no server is given
+func (node *Node) TransferLeadershipRPC(ctx context.Context, msg *pb.ServerMsg) (*pb.OkMsg, error) {
+	var f raft.Future
+	if msg.Id == "" {
+		f = node.raft.LeadershipTransfer()
+	} else {
+		f = node.raft.LeadershipTransferToServer(raft.ServerID(msg.Id), raft.ServerAddress(msg.Address))
+	}
+	if err := f.Error(); err != nil {
+		return nil, node.raftError(err)
+	}
+	return &pb.OkMsg{Ok: true}, nil
+}
+
+// TriggerSnapshotRPC forces raft to take a snapshot and compact its log
+func (node *Node) TriggerSnapshotRPC(ctx context.Context, msg *pb.EmptyMsg) (*pb.OkMsg, error) {
+	if err := node.raft.Snapshot().Error(); err != nil {
+		return nil, node.raftError(err)
+	}
+	return &pb.OkMsg{Ok: true}, nil
+}
+
+// RemoveServerRPC removes a server from the cluster. Must be called on the leader.
+func (node *Node) RemoveServerRPC(ctx context.Context, msg *pb.ServerMsg) (*pb.OkMsg, error) {
+	if msg.Id == "" {
+		return nil, status.Error(codes.InvalidArgument, "server id is required")
+	}
+	f := node.raft.RemoveServer(raft.ServerID(msg.Id), 0, raftTimeout)
+	if err := f.Error(); err != nil {
+		return nil, node.raftError(err)
+	}
+	return &pb.OkMsg{Ok: true}, nil
+}
+
+// AddNonvoterRPC adds a server that receives the log but does not vote.
+// Must be called on the leader.
+func (node *Node) AddNonvoterRPC(ctx context.Context, msg *pb.ServerMsg) (*pb.OkMsg, error) {
+	if msg.Id == "" || msg.Address == "" {
+		return nil, status.Error(codes.InvalidArgument, "server id and address are required")
+	}
+	f := node.raft.AddNonvoter(raft.ServerID(msg.Id), raft.ServerAddress(msg.Address), 0, raftTimeout)
+	if err := f.Error(); err != nil {
+		return nil, node.raftError(err)
+	}
+	return &pb.OkMsg{Ok: true}, nil
+}
+
+// PromoteRPC promotes a nonvoter to a voter. The address is looked up in the
+// cluster configuration if not given. Must be called on the leader.
+func (node *Node) PromoteRPC(ctx context.Context, msg *pb.ServerMsg) (*pb.OkMsg, error) {
+	if msg.Id == "" {
+		return nil, status.Error(codes.InvalidArgument, "server id is required")
+	}
+	f := node.raft.GetConfiguration()
+	if err := f.Error(); err != nil {
+		return nil, node.raftError(err)
+	}
+	address := raft.ServerAddress(msg.Address)
+	found := false
+	for _, server := range f.Configuration().Servers {
+		if server.ID == raft.ServerID(msg.Id) {
+			found = true
+			if address == "" {
+				address = server.Address
+			}
+		}
+	}
+	if !found {
+		return nil, status.Errorf(codes.NotFound, "server %v is not in the cluster", msg.Id)
+	}
+	if err := node.raft.AddVoter(raft.ServerID(msg.Id), address, 0, raftTimeout).Error(); err != nil {
+		return nil, node.raftError(err)
+	}
+	return &pb.OkMsg{Ok: true}, nil
+}
+
+// localID returns the raft server ID of this node
+func (node *Node) localID() raft.ServerID {
+	return node.raftConfig.LocalID
+}
+
+// lastContact returns milliseconds since this node last heard from the leader,
+// 0 if it is the leader and -1 if it never has
+func (node *Node) lastContact() int64 {
+	if node.raft.State() == raft.Leader {
+		return 0
+	}
+	last := node.raft.LastContact()
+	if last.IsZero() {
+		return -1
+	}
+	return int64(time.Since(last) / time.Millisecond)
+}
+
+// isNonvoter returns true if this node is a nonvoter in the latest cluster
+// configuration
+func (node *Node) isNonvoter() bool {
+	f := node.raft.GetConfiguration()
+	if f.Error() != nil {
+		return false
+	}
+	for _, server := range f.Configuration().Servers {
+		if server.ID == node.localID() {
+			return server.Suffrage == raft.Nonvoter
+		}
+	}
+	return false
+}
+
+// replicationLag returns the number of entries up to commitIndex not applied
+// yet
+func replicationLag(commitIndex, appliedIndex uint64) uint64 {
+	if commitIndex > appliedIndex {
+		return commitIndex - appliedIndex
+	}
+	return 0
+}
+
+func suffrageToPb(suffrage raft.ServerSuffrage) pb.ServerStatus_Suffrage {
+	switch suffrage {
+	case raft.Nonvoter:
+		return pb.ServerStatus_NONVOTER
+	case raft.Staging:
+		return pb.ServerStatus_STAGING
+	default:
+		return pb.ServerStatus_VOTER
+	}
+}
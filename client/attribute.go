@@ -0,0 +1,170 @@
+package client
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+
+	pb "github.com/triplewy/simpledb/grpc"
+)
+
+// Attribute converts a Go value to a pb.Attribute. Supported types are bool,
+// signed and unsigned integers, float32, float64, string, []byte, and
+// map[string]interface{}, []interface{} and json.RawMessage for MAP, LIST
+// and JSON documents. Bools
+// and numbers are sent both as typed values and in their canonical encoding,
+// which nodes that predate typed values read.
+func Attribute(name string, v interface{}) (*pb.Attribute, error) {
+	attribute := &pb.Attribute{Name: name}
+	switch v := v.(type) {
+	case bool:
+		attribute.Typed = &pb.Attribute_BoolValue{BoolValue: v}
+	case int:
+		attribute.Typed = &pb.Attribute_IntValue{IntValue: int64(v)}
+	case int8:
+		attribute.Typed = &pb.Attribute_IntValue{IntValue: int64(v)}
+	case int16:
+		attribute.Typed = &pb.Attribute_IntValue{IntValue: int64(v)}
+	case int32:
+		attribute.Typed = &pb.Attribute_IntValue{IntValue: int64(v)}
+	case int64:
+		attribute.Typed = &pb.Attribute_IntValue{IntValue: v}
+	case uint:
+		attribute.Typed = &pb.Attribute_UintValue{UintValue: uint64(v)}
+	case uint8:
+		attribute.Typed = &pb.Attribute_UintValue{UintValue: uint64(v)}
+	case uint16:
+		attribute.Typed = &pb.Attribute_UintValue{UintValue: uint64(v)}
+	case uint32:
+		attribute.Typed = &pb.Attribute_UintValue{UintValue: uint64(v)}
+	case uint64:
+		attribute.Typed = &pb.Attribute_UintValue{UintValue: v}
+	case float32:
+		attribute.Typed = &pb.Attribute_FloatValue{FloatValue: float64(v)}
+	case float64:
+		attribute.Typed = &pb.Attribute_FloatValue{FloatValue: v}
+	case string:
+		attribute.Type, attribute.Value = pb.Attribute_STRING, []byte(v)
+		return attribute, nil
+	case []byte:
+		attribute.Type, attribute.Value = pb.Attribute_BYTES, v
+		return attribute, nil
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("attribute %v: %v", name, err)
+		}
+		attribute.Type, attribute.Value = pb.Attribute_LIST, data
+		if _, ok := v.(map[string]interface{}); ok {
+			attribute.Type = pb.Attribute_MAP
+		}
+		return attribute, nil
+	case json.RawMessage:
+		attribute.Type, attribute.Value = pb.Attribute_JSON, v
+		return attribute, nil
+	default:
+		return nil, fmt.Errorf("attribute %v has unsupported type %T", name, v)
+	}
+	switch v := attribute.Typed.(type) {
+	case *pb.Attribute_BoolValue:
+		attribute.Type = pb.Attribute_BOOL
+		if v.BoolValue {
+			attribute.Value = []byte{1}
+		} else {
+			attribute.Value = []byte{0}
+		}
+	case *pb.Attribute_IntValue:
+		attribute.Type, attribute.Value = pb.Attribute_INT, encodeUint64(uint64(v.IntValue))
+	case *pb.Attribute_UintValue:
+		attribute.Type, attribute.Value = pb.Attribute_UINT, encodeUint64(v.UintValue)
+	case *pb.Attribute_FloatValue:
+		attribute.Type, attribute.Value = pb.Attribute_FLOAT, encodeUint64(math.Float64bits(v.FloatValue))
+	}
+	return attribute, nil
+}
+
+// Attributes converts a map of Go values to attributes
+func Attributes(values map[string]interface{}) ([]*pb.Attribute, error) {
+	attributes := []*pb.Attribute{}
+	for name, v := range values {
+		attribute, err := Attribute(name, v)
+		if err != nil {
+			return nil, err
+		}
+		attributes = append(attributes, attribute)
+	}
+	return attributes, nil
+}
+
+// Value converts an attribute to a Go value: bool, int64, uint64, float64,
+// string or []byte depending on its type. Documents are decoded like
+// encoding/json does into an interface{}, with numbers as json.Number. The
+// typed value is used if set.
+func Value(attribute *pb.Attribute) (interface{}, error) {
+	switch v := attribute.Typed.(type) {
+	case *pb.Attribute_BoolValue:
+		return v.BoolValue, nil
+	case *pb.Attribute_IntValue:
+		return v.IntValue, nil
+	case *pb.Attribute_UintValue:
+		return v.UintValue, nil
+	case *pb.Attribute_FloatValue:
+		return v.FloatValue, nil
+	}
+	data := attribute.Value
+	switch attribute.Type {
+	case pb.Attribute_BOOL:
+		if len(data) != 1 || data[0] > 1 {
+			return nil, fmt.Errorf("attribute %v: bool must be 1 byte, 0 or 1", attribute.Name)
+		}
+		return data[0] == 1, nil
+	case pb.Attribute_INT, pb.Attribute_UINT, pb.Attribute_FLOAT:
+		if len(data) != 8 {
+			return nil, fmt.Errorf("attribute %v: %v must be 8 bytes, got %d", attribute.Name, attribute.Type, len(data))
+		}
+		u := binary.LittleEndian.Uint64(data)
+		switch attribute.Type {
+		case pb.Attribute_INT:
+			return int64(u), nil
+		case pb.Attribute_UINT:
+			return u, nil
+		default:
+			return math.Float64frombits(u), nil
+		}
+	case pb.Attribute_STRING:
+		return string(data), nil
+	case pb.Attribute_BYTES:
+		return data, nil
+	case pb.Attribute_MAP, pb.Attribute_LIST, pb.Attribute_JSON:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			return nil, fmt.Errorf("attribute %v: %v", attribute.Name, err)
+		}
+		return v, nil
+	default:
+		return nil, fmt.Errorf("attribute %v has invalid type: %v", attribute.Name, attribute.Type)
+	}
+}
+
+// Values converts attributes to a map of Go values
+func Values(attributes []*pb.Attribute) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	for _, attribute := range attributes {
+		v, err := Value(attribute)
+		if err != nil {
+			return nil, err
+		}
+		values[attribute.Name] = v
+	}
+	return values, nil
+}
+
+func encodeUint64(u uint64) []byte {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, u)
+	return buf
+}
@@ -0,0 +1,360 @@
+// Package client is a Go client for a SimpleDB cluster. It discovers and
+// caches the raft leader, sends requests to it and retries them when the
+// leader changes or is unreachable. Writes carry a client ID and sequence
+// number so that a retried write is applied at most once.
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	pb "github.com/triplewy/simpledb/grpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// leaderState is the raft state reported by StatusRPC on the leader
+const leaderState = "Leader"
+
+// ErrNoLeader is returned when no node reports itself as the leader
+var ErrNoLeader = errors.New("no leader found")
+
+// Config is configuration for a client
+type Config struct {
+	// Addrs are the rpc addresses of the nodes in the cluster
+	Addrs []string
+	// DialOptions are passed to grpc.Dial for every node
+	DialOptions []grpc.DialOption
+	// MaxRetries is the number of times a failed request is retried
+	MaxRetries int
+	// MinBackoff and MaxBackoff bound the exponential backoff between retries
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultConfig returns a config for the given addresses with plaintext
+// connections and default retry settings
+func DefaultConfig(addrs ...string) *Config {
+	return &Config{
+		Addrs:       addrs,
+		DialOptions: []grpc.DialOption{grpc.WithInsecure()},
+		MaxRetries:  5,
+		MinBackoff:  50 * time.Millisecond,
+		MaxBackoff:  2 * time.Second,
+	}
+}
+
+// Client sends requests to the leader of a SimpleDB cluster
+type Client struct {
+	config *Config
+
+	mu     sync.Mutex
+	conns  map[string]*grpc.ClientConn
+	leader string
+
+	id string
+	// seqMu guards the sequence numbers of writes
+	seqMu    sync.Mutex
+	nextSeq  uint64
+	inflight map[uint64]struct{}
+}
+
+// New creates a client. Connections are established lazily.
+func New(config *Config) (*Client, error) {
+	if len(config.Addrs) == 0 {
+		return nil, errors.New("client: no addresses given")
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	return &Client{
+		config:   config,
+		conns:    make(map[string]*grpc.ClientConn),
+		id:       hex.EncodeToString(buf),
+		nextSeq:  1,
+		inflight: make(map[uint64]struct{}),
+	}, nil
+}
+
+// ID returns the client ID identifying the writes of this client
+func (c *Client) ID() string {
+	return c.id
+}
+
+// Close closes all connections
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var err error
+	for addr, conn := range c.conns {
+		if e := conn.Close(); e != nil && err == nil {
+			err = e
+		}
+		delete(c.conns, addr)
+	}
+	c.leader = ""
+	return err
+}
+
+// Read returns the entry at key, limited to the given attributes if any
+func (c *Client) Read(ctx context.Context, key string, attributes ...string) (*pb.Entry, error) {
+	return c.Table("").Read(ctx, key, attributes...)
+}
+
+// ReadPaths returns the values at paths inside the document attributes of the
+// entry at key
+func (c *Client) ReadPaths(ctx context.Context, key string, paths ...string) (*pb.Entry, error) {
+	return c.Table("").ReadPaths(ctx, key, paths...)
+}
+
+// Scan returns the entries between startKey and endKey
+func (c *Client) Scan(ctx context.Context, startKey, endKey string, attributes ...string) ([]*pb.Entry, error) {
+	return c.Table("").Scan(ctx, startKey, endKey, attributes...)
+}
+
+// ScanFilter is like Scan but only returns the entries matching filter, e.g.
+// status = "active" AND age > 30, which is evaluated by the server
+func (c *Client) ScanFilter(ctx context.Context, startKey, endKey, filter string, attributes ...string) ([]*pb.Entry, error) {
+	return c.Table("").ScanFilter(ctx, startKey, endKey, filter, attributes...)
+}
+
+// Keys returns the keys between startKey and endKey
+func (c *Client) Keys(ctx context.Context, startKey, endKey string) ([]string, error) {
+	return c.Table("").Keys(ctx, startKey, endKey)
+}
+
+// Count returns the number of keys Keys would return
+func (c *Client) Count(ctx context.Context, startKey, endKey string) (uint64, error) {
+	return c.Table("").Count(ctx, startKey, endKey)
+}
+
+// CountPrefix returns the number of keys starting with prefix
+func (c *Client) CountPrefix(ctx context.Context, prefix string) (uint64, error) {
+	return c.Table("").CountPrefix(ctx, prefix)
+}
+
+// CreateIndex creates a secondary index on an attribute. Existing entries
+// are indexed in the background, and queries fail until that is done.
+func (c *Client) CreateIndex(ctx context.Context, attribute string) error {
+	return c.Table("").CreateIndex(ctx, attribute)
+}
+
+// DropIndex removes the secondary index on an attribute
+func (c *Client) DropIndex(ctx context.Context, attribute string) error {
+	return c.Table("").DropIndex(ctx, attribute)
+}
+
+// Indexes returns the secondary indexes
+func (c *Client) Indexes(ctx context.Context) ([]*pb.IndexInfo, error) {
+	return c.Table("").Indexes(ctx)
+}
+
+// SetSchema sets the schema of the keys starting with prefix
+func (c *Client) SetSchema(ctx context.Context, prefix string, fields []*pb.SchemaField, strict bool) error {
+	return c.Table("").SetSchema(ctx, prefix, fields, strict)
+}
+
+// DropSchema removes the schema of the keys starting with prefix
+func (c *Client) DropSchema(ctx context.Context, prefix string) error {
+	return c.Table("").DropSchema(ctx, prefix)
+}
+
+// Schemas returns the schemas, sorted by prefix
+func (c *Client) Schemas(ctx context.Context) ([]*pb.SchemaMsg, error) {
+	return c.Table("").Schemas(ctx)
+}
+
+// QueryIndex returns the entries whose attribute, which must be indexed,
+// equals value. The name of value is the attribute.
+func (c *Client) QueryIndex(ctx context.Context, value *pb.Attribute) ([]*pb.Entry, error) {
+	return c.Table("").QueryIndex(ctx, value)
+}
+
+// QueryIndexRange returns the entries whose indexed attribute is at least
+// start and less than end. Either bound may be nil.
+func (c *Client) QueryIndexRange(ctx context.Context, attribute string, start, end *pb.Attribute) ([]*pb.Entry, error) {
+	return c.Table("").QueryIndexRange(ctx, attribute, start, end)
+}
+
+// Insert creates an entry. It fails if the key already exists.
+func (c *Client) Insert(ctx context.Context, key string, attributes []*pb.Attribute) error {
+	return c.Table("").Insert(ctx, key, attributes)
+}
+
+// Update sets attributes of an existing entry
+func (c *Client) Update(ctx context.Context, key string, attributes []*pb.Attribute) error {
+	return c.Table("").Update(ctx, key, attributes)
+}
+
+// UpdatePaths sets values inside the document attributes of an existing
+// entry. The name of each value is its path, e.g. address.city.
+func (c *Client) UpdatePaths(ctx context.Context, key string, values []*pb.Attribute) error {
+	return c.Table("").UpdatePaths(ctx, key, values)
+}
+
+// Delete removes the entry at key
+func (c *Client) Delete(ctx context.Context, key string) error {
+	return c.Table("").Delete(ctx, key)
+}
+
+// DeleteRange removes the entries Scan returns for the same keys and returns
+// how many were removed
+func (c *Client) DeleteRange(ctx context.Context, startKey, endKey string) (uint64, error) {
+	return c.Table("").DeleteRange(ctx, startKey, endKey)
+}
+
+// DeletePrefix removes the entries whose key starts with prefix and returns
+// how many were removed
+func (c *Client) DeletePrefix(ctx context.Context, prefix string) (uint64, error) {
+	return c.Table("").DeletePrefix(ctx, prefix)
+}
+
+// write runs f with a new request ID. Every attempt carries the same ID, so
+// the cluster applies the write at most once and writes can be retried like
+// reads.
+func (c *Client) write(ctx context.Context, f func(pb.SimpleDbClient, *pb.RequestId) error) error {
+	id := c.startRequest()
+	defer c.finishRequest(id.Sequence)
+	return c.do(ctx, func(client pb.SimpleDbClient) error {
+		return f(client, id)
+	})
+}
+
+func (c *Client) startRequest() *pb.RequestId {
+	c.seqMu.Lock()
+	defer c.seqMu.Unlock()
+	seq := c.nextSeq
+	c.nextSeq++
+	c.inflight[seq] = struct{}{}
+	first := seq
+	for s := range c.inflight {
+		if s < first {
+			first = s
+		}
+	}
+	return &pb.RequestId{ClientId: c.id, Sequence: seq, FirstIncomplete: first}
+}
+
+// finishRequest marks a write as complete. Its result may then be discarded
+// by the cluster, so a delayed attempt of it is rejected without applying.
+func (c *Client) finishRequest(seq uint64) {
+	c.seqMu.Lock()
+	defer c.seqMu.Unlock()
+	delete(c.inflight, seq)
+}
+
+// do runs f against the leader, retrying with backoff on leader changes and
+// when the leader is unavailable
+func (c *Client) do(ctx context.Context, f func(pb.SimpleDbClient) error) error {
+	backoff := c.config.MinBackoff
+	var err error
+	for attempt := 0; attempt <= c.config.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+			if backoff > c.config.MaxBackoff {
+				backoff = c.config.MaxBackoff
+			}
+		}
+		var conn *grpc.ClientConn
+		conn, err = c.leaderConn(ctx)
+		if err != nil {
+			continue
+		}
+		err = f(pb.NewSimpleDbClient(conn))
+		if !retryable(err) {
+			return err
+		}
+		if !indexNotReady(err) {
+			c.resetLeader()
+		}
+	}
+	return err
+}
+
+func retryable(err error) bool {
+	switch status.Code(err) {
+	case codes.FailedPrecondition, codes.Unavailable:
+		return true
+	default:
+		return false
+	}
+}
+
+// indexNotReady returns true if err is the leader refusing a query on an
+// index that is still being backfilled, which is retried on the same leader.
+// The leader marks it with an IndexInfo detail of an index not ready.
+func indexNotReady(err error) bool {
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*pb.IndexInfo); ok && !info.Ready {
+			return true
+		}
+	}
+	return false
+}
+
+// leaderConn returns a connection to the cached leader, discovering it first
+// if necessary
+func (c *Client) leaderConn(ctx context.Context) (*grpc.ClientConn, error) {
+	c.mu.Lock()
+	leader := c.leader
+	c.mu.Unlock()
+	if leader == "" {
+		var err error
+		leader, err = c.discoverLeader(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c.conn(leader)
+}
+
+// discoverLeader asks each node for its raft state and caches the address of
+// the node that is leader
+func (c *Client) discoverLeader(ctx context.Context) (string, error) {
+	for _, addr := range c.config.Addrs {
+		conn, err := c.conn(addr)
+		if err != nil {
+			continue
+		}
+		msg, err := pb.NewAdminClient(conn).StatusRPC(ctx, &pb.EmptyMsg{})
+		if err != nil || msg.State != leaderState {
+			continue
+		}
+		c.mu.Lock()
+		c.leader = addr
+		c.mu.Unlock()
+		return addr, nil
+	}
+	return "", ErrNoLeader
+}
+
+func (c *Client) resetLeader() {
+	c.mu.Lock()
+	c.leader = ""
+	c.mu.Unlock()
+}
+
+func (c *Client) conn(addr string) (*grpc.ClientConn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if conn, ok := c.conns[addr]; ok {
+		return conn, nil
+	}
+	conn, err := grpc.Dial(addr, c.config.DialOptions...)
+	if err != nil {
+		return nil, err
+	}
+	c.conns[addr] = conn
+	return conn, nil
+}
@@ -0,0 +1,28 @@
+package client
+
+import (
+	"testing"
+
+	pb "github.com/triplewy/simpledb/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestIndexNotReady(t *testing.T) {
+	st, err := status.New(codes.Unavailable, "backfilling").WithDetails(&pb.IndexInfo{Attribute: "email"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !indexNotReady(st.Err()) {
+		t.Error("index not ready detail was not recognized")
+	}
+	for _, err := range []error{
+		status.Error(codes.Unavailable, "index on email is still being backfilled"),
+		status.Error(codes.FailedPrecondition, "node is not the leader"),
+		nil,
+	} {
+		if indexNotReady(err) {
+			t.Errorf("%v taken for an index not ready", err)
+		}
+	}
+}
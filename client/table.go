@@ -0,0 +1,285 @@
+package client
+
+import (
+	"context"
+
+	pb "github.com/triplewy/simpledb/grpc"
+)
+
+// Table sends requests for the entries of one table. Its methods are like
+// those of Client, which uses the default table.
+type Table struct {
+	c    *Client
+	name string
+}
+
+// Table returns a handle for the table with the given name. The table must
+// have been created with CreateTable; the empty name is the default table.
+func (c *Client) Table(name string) *Table {
+	return &Table{c: c, name: name}
+}
+
+// Name returns the name of the table
+func (t *Table) Name() string {
+	return t.name
+}
+
+// CreateTable creates a table
+func (c *Client) CreateTable(ctx context.Context, name string) error {
+	return c.do(ctx, func(client pb.SimpleDbClient) error {
+		_, err := client.CreateTableRPC(ctx, &pb.TableMsg{Name: name})
+		return err
+	})
+}
+
+// DropTable drops a table with all its entries and indexes
+func (c *Client) DropTable(ctx context.Context, name string) error {
+	return c.do(ctx, func(client pb.SimpleDbClient) error {
+		_, err := client.DropTableRPC(ctx, &pb.TableMsg{Name: name})
+		return err
+	})
+}
+
+// Tables returns the names of the tables, not including the default table
+func (c *Client) Tables(ctx context.Context) (names []string, err error) {
+	err = c.do(ctx, func(client pb.SimpleDbClient) error {
+		msg, err := client.ListTablesRPC(ctx, &pb.EmptyMsg{})
+		if err != nil {
+			return err
+		}
+		names = msg.Names
+		return nil
+	})
+	return names, err
+}
+
+// Read returns the entry at key, limited to the given attributes if any
+func (t *Table) Read(ctx context.Context, key string, attributes ...string) (entry *pb.Entry, err error) {
+	err = t.c.do(ctx, func(client pb.SimpleDbClient) error {
+		entry, err = client.ReadRPC(ctx, &pb.ReadMsg{Key: key, Attributes: attributes, Table: t.name, Linearizable: true})
+		return err
+	})
+	return entry, err
+}
+
+// ReadPaths returns the values at paths inside the document attributes of the
+// entry at key, e.g. address.city, as JSON attributes named by their path
+func (t *Table) ReadPaths(ctx context.Context, key string, paths ...string) (entry *pb.Entry, err error) {
+	err = t.c.do(ctx, func(client pb.SimpleDbClient) error {
+		entry, err = client.ReadRPC(ctx, &pb.ReadMsg{Key: key, Paths: paths, Table: t.name, Linearizable: true})
+		return err
+	})
+	return entry, err
+}
+
+// Scan returns the entries between startKey and endKey
+func (t *Table) Scan(ctx context.Context, startKey, endKey string, attributes ...string) (entries []*pb.Entry, err error) {
+	err = t.c.do(ctx, func(client pb.SimpleDbClient) error {
+		msg, err := client.ScanRPC(ctx, &pb.ScanMsg{StartKey: startKey, EndKey: endKey, Attributes: attributes, Table: t.name, Linearizable: true})
+		if err != nil {
+			return err
+		}
+		entries = msg.Entries
+		return nil
+	})
+	return entries, err
+}
+
+// ScanFilter is like Scan but only returns the entries matching filter, e.g.
+// status = "active" AND age > 30, which is evaluated by the server
+func (t *Table) ScanFilter(ctx context.Context, startKey, endKey, filter string, attributes ...string) (entries []*pb.Entry, err error) {
+	err = t.c.do(ctx, func(client pb.SimpleDbClient) error {
+		msg, err := client.ScanRPC(ctx, &pb.ScanMsg{StartKey: startKey, EndKey: endKey, Attributes: attributes, Filter: filter, Table: t.name, Linearizable: true})
+		if err != nil {
+			return err
+		}
+		entries = msg.Entries
+		return nil
+	})
+	return entries, err
+}
+
+// Keys returns the keys between startKey and endKey
+func (t *Table) Keys(ctx context.Context, startKey, endKey string) (keys []string, err error) {
+	err = t.c.do(ctx, func(client pb.SimpleDbClient) error {
+		msg, err := client.ScanRPC(ctx, &pb.ScanMsg{StartKey: startKey, EndKey: endKey, KeysOnly: true, Table: t.name, Linearizable: true})
+		if err != nil {
+			return err
+		}
+		keys = make([]string, 0, len(msg.Entries))
+		for _, entry := range msg.Entries {
+			keys = append(keys, entry.Key)
+		}
+		return nil
+	})
+	return keys, err
+}
+
+// Count returns the number of keys Keys would return
+func (t *Table) Count(ctx context.Context, startKey, endKey string) (count uint64, err error) {
+	return t.count(ctx, &pb.KeyRangeMsg{StartKey: startKey, EndKey: endKey, Table: t.name, Linearizable: true})
+}
+
+// CountPrefix returns the number of keys starting with prefix
+func (t *Table) CountPrefix(ctx context.Context, prefix string) (count uint64, err error) {
+	return t.count(ctx, &pb.KeyRangeMsg{Prefix: prefix, Table: t.name, Linearizable: true})
+}
+
+func (t *Table) count(ctx context.Context, msg *pb.KeyRangeMsg) (count uint64, err error) {
+	err = t.c.do(ctx, func(client pb.SimpleDbClient) error {
+		resp, err := client.CountRPC(ctx, msg)
+		if err != nil {
+			return err
+		}
+		count = resp.Count
+		return nil
+	})
+	return count, err
+}
+
+// CreateIndex creates a secondary index on an attribute. Existing entries
+// are indexed in the background, and queries fail until that is done.
+func (t *Table) CreateIndex(ctx context.Context, attribute string) error {
+	return t.c.do(ctx, func(client pb.SimpleDbClient) error {
+		_, err := client.CreateIndexRPC(ctx, &pb.IndexMsg{Attribute: attribute, Table: t.name})
+		return err
+	})
+}
+
+// DropIndex removes the secondary index on an attribute
+func (t *Table) DropIndex(ctx context.Context, attribute string) error {
+	return t.c.do(ctx, func(client pb.SimpleDbClient) error {
+		_, err := client.DropIndexRPC(ctx, &pb.IndexMsg{Attribute: attribute, Table: t.name})
+		return err
+	})
+}
+
+// Indexes returns the secondary indexes of the table
+func (t *Table) Indexes(ctx context.Context) (indexes []*pb.IndexInfo, err error) {
+	err = t.c.do(ctx, func(client pb.SimpleDbClient) error {
+		msg, err := client.ListIndexesRPC(ctx, &pb.TableMsg{Name: t.name})
+		if err != nil {
+			return err
+		}
+		indexes = msg.Indexes
+		return nil
+	})
+	return indexes, err
+}
+
+// SetSchema sets the schema of the keys of the table starting with prefix,
+// replacing the previous one if the change keeps existing entries valid.
+// Strict schemas reject attributes that are not fields.
+func (t *Table) SetSchema(ctx context.Context, prefix string, fields []*pb.SchemaField, strict bool) error {
+	return t.c.do(ctx, func(client pb.SimpleDbClient) error {
+		_, err := client.SetSchemaRPC(ctx, &pb.SchemaMsg{Table: t.name, Prefix: prefix, Fields: fields, Strict: strict})
+		return err
+	})
+}
+
+// DropSchema removes the schema of the keys of the table starting with prefix
+func (t *Table) DropSchema(ctx context.Context, prefix string) error {
+	return t.c.do(ctx, func(client pb.SimpleDbClient) error {
+		_, err := client.DropSchemaRPC(ctx, &pb.SchemaMsg{Table: t.name, Prefix: prefix})
+		return err
+	})
+}
+
+// Schemas returns the schemas of the table, sorted by prefix
+func (t *Table) Schemas(ctx context.Context) (schemas []*pb.SchemaMsg, err error) {
+	err = t.c.do(ctx, func(client pb.SimpleDbClient) error {
+		msg, err := client.ListSchemasRPC(ctx, &pb.TableMsg{Name: t.name})
+		if err != nil {
+			return err
+		}
+		schemas = msg.Schemas
+		return nil
+	})
+	return schemas, err
+}
+
+// QueryIndex returns the entries whose attribute, which must be indexed,
+// equals value. The name of value is the attribute.
+func (t *Table) QueryIndex(ctx context.Context, value *pb.Attribute) ([]*pb.Entry, error) {
+	return t.queryIndex(ctx, &pb.IndexQueryMsg{Attribute: value.Name, Value: value, Table: t.name})
+}
+
+// QueryIndexRange returns the entries whose indexed attribute is at least
+// start and less than end. Either bound may be nil.
+func (t *Table) QueryIndexRange(ctx context.Context, attribute string, start, end *pb.Attribute) ([]*pb.Entry, error) {
+	return t.queryIndex(ctx, &pb.IndexQueryMsg{Attribute: attribute, Start: start, End: end, Table: t.name})
+}
+
+func (t *Table) queryIndex(ctx context.Context, msg *pb.IndexQueryMsg) (entries []*pb.Entry, err error) {
+	err = t.c.do(ctx, func(client pb.SimpleDbClient) error {
+		resp, err := client.QueryIndexRPC(ctx, msg)
+		if err != nil {
+			return err
+		}
+		entries = resp.Entries
+		return nil
+	})
+	return entries, err
+}
+
+// Insert creates an entry. It fails if the key already exists.
+func (t *Table) Insert(ctx context.Context, key string, attributes []*pb.Attribute) error {
+	return t.c.write(ctx, func(client pb.SimpleDbClient, id *pb.RequestId) error {
+		_, err := client.InsertRPC(ctx, &pb.Entry{Key: key, Attributes: attributes, RequestId: id, Table: t.name})
+		return err
+	})
+}
+
+// Update sets attributes of an existing entry
+func (t *Table) Update(ctx context.Context, key string, attributes []*pb.Attribute) error {
+	return t.c.write(ctx, func(client pb.SimpleDbClient, id *pb.RequestId) error {
+		_, err := client.UpdateRPC(ctx, &pb.Entry{Key: key, Attributes: attributes, RequestId: id, Table: t.name})
+		return err
+	})
+}
+
+// UpdatePaths sets values inside the document attributes of an existing
+// entry. The name of each value is its path, e.g. address.city, and missing
+// objects on the way are created.
+func (t *Table) UpdatePaths(ctx context.Context, key string, values []*pb.Attribute) error {
+	return t.c.write(ctx, func(client pb.SimpleDbClient, id *pb.RequestId) error {
+		_, err := client.UpdateRPC(ctx, &pb.Entry{Key: key, Paths: values, RequestId: id, Table: t.name})
+		return err
+	})
+}
+
+// Delete removes the entry at key
+func (t *Table) Delete(ctx context.Context, key string) error {
+	return t.c.write(ctx, func(client pb.SimpleDbClient, id *pb.RequestId) error {
+		_, err := client.DeleteRPC(ctx, &pb.KeyMsg{Key: key, RequestId: id, Table: t.name})
+		return err
+	})
+}
+
+// DeleteRange removes the entries Scan returns for the same keys and returns
+// how many were removed
+func (t *Table) DeleteRange(ctx context.Context, startKey, endKey string) (count uint64, err error) {
+	err = t.c.write(ctx, func(client pb.SimpleDbClient, id *pb.RequestId) error {
+		msg, err := client.DeleteRangeRPC(ctx, &pb.RangeMsg{StartKey: startKey, EndKey: endKey, RequestId: id, Table: t.name})
+		if err != nil {
+			return err
+		}
+		count = msg.Count
+		return nil
+	})
+	return count, err
+}
+
+// DeletePrefix removes the entries whose key starts with prefix and returns
+// how many were removed
+func (t *Table) DeletePrefix(ctx context.Context, prefix string) (count uint64, err error) {
+	err = t.c.write(ctx, func(client pb.SimpleDbClient, id *pb.RequestId) error {
+		msg, err := client.DeletePrefixRPC(ctx, &pb.PrefixMsg{Prefix: prefix, RequestId: id, Table: t.name})
+		if err != nil {
+			return err
+		}
+		count = msg.Count
+		return nil
+	})
+	return count, err
+}
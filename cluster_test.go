@@ -0,0 +1,609 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	pb "github.com/triplewy/simpledb/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// testCluster runs nodes in one process connected by raft.InmemTransport so
+// that FSM, snapshot and membership code can be exercised by go test. Nodes
+// listen on ephemeral ports and store their data under a temporary directory.
+type testCluster struct {
+	dir        string
+	configs    []*Config
+	nodes      []*Node
+	transports []*raft.InmemTransport
+	// partitioned[i][j] is true when node i cannot reach node j
+	partitioned [][]bool
+}
+
+// newTestCluster starts an n node cluster. Every node is bootstrapped with the
+// same configuration, so one of them will be elected leader.
+func newTestCluster(n int) (*testCluster, error) {
+	dir, err := ioutil.TempDir("", "simpledb-cluster")
+	if err != nil {
+		return nil, err
+	}
+	c := &testCluster{
+		dir:         dir,
+		configs:     make([]*Config, n),
+		nodes:       make([]*Node, n),
+		transports:  make([]*raft.InmemTransport, n),
+		partitioned: make([][]bool, n),
+	}
+	servers := []raft.Server{}
+	for i := 0; i < n; i++ {
+		c.partitioned[i] = make([]bool, n)
+		c.configs[i] = &Config{
+			NodeID:  fmt.Sprintf("node%d", i),
+			DataDir: filepath.Join(dir, fmt.Sprintf("node%d", i)),
+			Raft: RaftConfig{
+				HeartbeatTimeout:   50 * time.Millisecond,
+				ElectionTimeout:    50 * time.Millisecond,
+				LeaderLeaseTimeout: 50 * time.Millisecond,
+				CommitTimeout:      5 * time.Millisecond,
+			},
+		}
+		servers = append(servers, raft.Server{
+			ID:      raft.ServerID(c.configs[i].NodeID),
+			Address: c.raftAddr(i),
+		})
+	}
+	for i := 0; i < n; i++ {
+		c.configs[i].servers = servers
+		if err := c.Start(i); err != nil {
+			c.Shutdown()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// AddLearner starts a new nonvoter node that joins the cluster through the
+// rpc addresses of the existing nodes, and returns its index
+func (c *testCluster) AddLearner() (int, error) {
+	i := len(c.nodes)
+	join := []string{}
+	for j := range c.nodes {
+		join = append(join, c.RPCAddr(j))
+	}
+	c.configs = append(c.configs, &Config{
+		NodeID:   fmt.Sprintf("node%d", i),
+		DataDir:  filepath.Join(c.dir, fmt.Sprintf("node%d", i)),
+		Nonvoter: true,
+		Join:     strings.Join(join, ","),
+		Raft:     c.configs[0].Raft,
+	})
+	c.nodes = append(c.nodes, nil)
+	c.transports = append(c.transports, nil)
+	for j := range c.partitioned {
+		c.partitioned[j] = append(c.partitioned[j], false)
+	}
+	c.partitioned = append(c.partitioned, make([]bool, i+1))
+	return i, c.Start(i)
+}
+
+func (c *testCluster) raftAddr(i int) raft.ServerAddress {
+	return raft.ServerAddress(c.configs[i].NodeID)
+}
+
+// Start starts node i with a fresh transport, keeping its data directory
+func (c *testCluster) Start(i int) error {
+	if c.nodes[i] != nil {
+		return fmt.Errorf("node %d is already running", i)
+	}
+	_, transport := raft.NewInmemTransport(c.raftAddr(i))
+	c.transports[i] = transport
+	c.configs[i].transport = transport
+	c.connect()
+	node, err := NewNode(c.configs[i])
+	if err != nil {
+		return err
+	}
+	c.nodes[i] = node
+	// Keep the rpc address stable across restarts so clients can reconnect
+	c.configs[i].RPCPort = node.rpcAddr.(*net.TCPAddr).Port
+	return nil
+}
+
+// Kill stops node i abruptly. Its data directory is kept so it can be
+// restarted.
+func (c *testCluster) Kill(i int) error {
+	node := c.nodes[i]
+	if node == nil {
+		return fmt.Errorf("node %d is not running", i)
+	}
+	c.nodes[i] = nil
+	c.transports[i] = nil
+	c.connect()
+	return node.kill()
+}
+
+// Stop shuts down node i gracefully, handing off leadership if it is the
+// leader. Its data directory is kept so it can be restarted.
+func (c *testCluster) Stop(i int) error {
+	node := c.nodes[i]
+	if node == nil {
+		return fmt.Errorf("node %d is not running", i)
+	}
+	err := node.Shutdown()
+	c.nodes[i] = nil
+	c.transports[i] = nil
+	c.connect()
+	return err
+}
+
+// Restart kills node i and starts it again from its data directory
+func (c *testCluster) Restart(i int) error {
+	if err := c.Kill(i); err != nil {
+		return err
+	}
+	return c.Start(i)
+}
+
+// Shutdown kills all running nodes and removes their data
+func (c *testCluster) Shutdown() error {
+	var err error
+	for i := range c.nodes {
+		if c.nodes[i] != nil {
+			if e := c.Kill(i); e != nil && err == nil {
+				err = e
+			}
+		}
+	}
+	if e := os.RemoveAll(c.dir); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
+
+// Partition splits the cluster so that nodes can only reach nodes in the same
+// group. Nodes not listed in any group are isolated.
+func (c *testCluster) Partition(groups ...[]int) {
+	group := make([]int, len(c.nodes))
+	for i := range group {
+		group[i] = -1 - i
+	}
+	for g, members := range groups {
+		for _, i := range members {
+			group[i] = g
+		}
+	}
+	for i := range c.partitioned {
+		for j := range c.partitioned[i] {
+			c.partitioned[i][j] = group[i] != group[j]
+		}
+	}
+	c.connect()
+}
+
+// Heal removes all partitions
+func (c *testCluster) Heal() {
+	for i := range c.partitioned {
+		for j := range c.partitioned[i] {
+			c.partitioned[i][j] = false
+		}
+	}
+	c.connect()
+}
+
+// connect wires up the transports of running nodes according to the current
+// partitions
+func (c *testCluster) connect() {
+	for i, from := range c.transports {
+		if from == nil {
+			continue
+		}
+		from.DisconnectAll()
+		for j, to := range c.transports {
+			if i != j && to != nil && !c.partitioned[i][j] {
+				from.Connect(c.raftAddr(j), to)
+			}
+		}
+	}
+}
+
+// Node returns node i, or nil if it is not running
+func (c *testCluster) Node(i int) *Node {
+	return c.nodes[i]
+}
+
+// RPCAddr returns the gRPC address of node i
+func (c *testCluster) RPCAddr(i int) string {
+	return c.nodes[i].rpcAddr.String()
+}
+
+// Leader returns the index of a running node that believes it is the leader,
+// or -1 if there is none
+func (c *testCluster) Leader() int {
+	for i, node := range c.nodes {
+		if node != nil && node.raft.State() == raft.Leader {
+			return i
+		}
+	}
+	return -1
+}
+
+// WaitForLeader waits until a running node is leader and every running node
+// that can reach it agrees
+func (c *testCluster) WaitForLeader(timeout time.Duration) (int, error) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if leader := c.Leader(); leader >= 0 && c.agreeOnLeader(leader) {
+			return leader, nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return -1, errors.New("timed out waiting for leader")
+}
+
+func (c *testCluster) agreeOnLeader(leader int) bool {
+	for i, node := range c.nodes {
+		if node == nil || i == leader || c.partitioned[i][leader] {
+			continue
+		}
+		if node.raft.Leader() != c.raftAddr(leader) {
+			return false
+		}
+	}
+	return true
+}
+
+// WaitForApplied waits until every running node has applied index
+func (c *testCluster) WaitForApplied(index uint64, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		caughtUp := true
+		for _, node := range c.nodes {
+			if node != nil && node.raft.AppliedIndex() < index {
+				caughtUp = false
+			}
+		}
+		if caughtUp {
+			return nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return fmt.Errorf("timed out waiting for index %d to be applied", index)
+}
+
+func testAttributes(value string) []*pb.Attribute {
+	return []*pb.Attribute{{Name: "value", Type: pb.Attribute_STRING, Value: []byte(value)}}
+}
+
+// readValue reads key from the local state of node i
+func (c *testCluster) readValue(i int, key string) (string, error) {
+	entry, err := c.Node(i).ReadRPC(context.Background(), &pb.ReadMsg{Key: key, Attributes: []string{"value"}})
+	if err != nil {
+		return "", err
+	}
+	if len(entry.Attributes) != 1 {
+		return "", fmt.Errorf("unexpected attributes: %v", entry.Attributes)
+	}
+	return string(entry.Attributes[0].Value), nil
+}
+
+func TestLeaderElection(t *testing.T) {
+	c, err := newTestCluster(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Shutdown()
+	leader, err := c.WaitForLeader(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	term := c.Node(leader).raft.CurrentTerm()
+	for i := 0; i < 3; i++ {
+		if i != leader && c.Node(i).raft.State() == raft.Leader {
+			t.Fatalf("nodes %d and %d are both leader", leader, i)
+		}
+	}
+
+	if err := c.Kill(leader); err != nil {
+		t.Fatal(err)
+	}
+	next, err := c.WaitForLeader(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next == leader {
+		t.Fatalf("killed node %d is still leader", leader)
+	}
+	if c.Node(next).raft.CurrentTerm() <= term {
+		t.Fatalf("new leader has term %d, expected more than %d", c.Node(next).raft.CurrentTerm(), term)
+	}
+}
+
+func TestReplicationAfterRestart(t *testing.T) {
+	c, err := newTestCluster(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Shutdown()
+	leader, err := c.WaitForLeader(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := c.Node(leader).InsertRPC(ctx, &pb.Entry{Key: "before", Attributes: testAttributes("1")}); err != nil {
+		t.Fatal(err)
+	}
+	follower := (leader + 1) % 3
+	if err := c.Kill(follower); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Node(leader).InsertRPC(ctx, &pb.Entry{Key: "during", Attributes: testAttributes("2")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Start(follower); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WaitForApplied(c.Node(leader).raft.AppliedIndex(), 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{"before": "1", "during": "2"} {
+		if value, err := c.readValue(follower, key); err != nil || value != want {
+			t.Fatalf("%v on restarted follower: got %q, %v, want %q", key, value, err, want)
+		}
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	c, err := newTestCluster(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Shutdown()
+	leader, err := c.WaitForLeader(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	follower := (leader + 1) % 3
+	if err := c.Kill(follower); err != nil {
+		t.Fatal(err)
+	}
+	const keys = 20
+	for i := 0; i < keys; i++ {
+		if _, err := c.Node(leader).InsertRPC(ctx, &pb.Entry{Key: fmt.Sprint(i), Attributes: testAttributes(fmt.Sprint(i))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Compact the log so that the follower can only catch up from a snapshot
+	rc := c.Node(leader).raft.ReloadableConfig()
+	rc.TrailingLogs = 1
+	if err := c.Node(leader).raft.ReloadConfig(rc); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Node(leader).TriggerSnapshotRPC(ctx, &pb.EmptyMsg{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Start(follower); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WaitForApplied(c.Node(leader).raft.AppliedIndex(), 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if c.Node(follower).raft.Stats()["last_snapshot_index"] == "0" {
+		t.Fatal("follower caught up without installing a snapshot")
+	}
+	// Restarting the leader restores its state from its own snapshot
+	if err := c.Restart(leader); err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range []int{follower, leader} {
+		for k := 0; k < keys; k++ {
+			if value, err := c.readValue(i, fmt.Sprint(k)); err != nil || value != fmt.Sprint(k) {
+				t.Fatalf("key %d on node %d: got %q, %v", k, i, value, err)
+			}
+		}
+	}
+}
+
+// TestCompactedSnapshotRestore checks that a snapshot taken after the log was
+// compacted still holds the writes before the compaction
+func TestCompactedSnapshotRestore(t *testing.T) {
+	c, err := newTestCluster(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Shutdown()
+	leader, err := c.WaitForLeader(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WaitForFeatures(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	node := c.Node(leader)
+	rc := node.raft.ReloadableConfig()
+	rc.TrailingLogs = 1
+	if err := node.raft.ReloadConfig(rc); err != nil {
+		t.Fatal(err)
+	}
+	const keys = 10
+	tables := []string{"", "first", "second"}
+	// Each round creates a table, writes to every table created so far and
+	// snapshots, compacting the log
+	for round := 1; round < len(tables); round++ {
+		if _, err := node.CreateTableRPC(ctx, &pb.TableMsg{Name: tables[round]}); err != nil {
+			t.Fatal(err)
+		}
+		for _, table := range tables[:round+1] {
+			for k := 0; k < keys; k++ {
+				key := fmt.Sprintf("%d/%d", round, k)
+				if _, err := node.InsertRPC(ctx, &pb.Entry{Key: key, Attributes: testAttributes(key), Table: table}); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		if _, err := node.TriggerSnapshotRPC(ctx, &pb.EmptyMsg{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Replace a follower with a fresh node, which can only catch up from the
+	// last snapshot
+	follower := (leader + 1) % 3
+	if err := c.Kill(follower); err != nil {
+		t.Fatal(err)
+	}
+	c.configs[follower].DataDir = filepath.Join(c.dir, "fresh")
+	if err := c.Start(follower); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WaitForApplied(node.raft.AppliedIndex(), 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if c.Node(follower).raft.Stats()["last_snapshot_index"] == "0" {
+		t.Fatal("fresh node caught up without installing a snapshot")
+	}
+	for round := 1; round < len(tables); round++ {
+		for i, table := range tables[:round+1] {
+			if i > 0 {
+				want, _, err := readTable(node.store.db.StartTxn(), table)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if id, exists, err := readTable(c.Node(follower).store.db.StartTxn(), table); err != nil || !exists || id != want {
+					t.Fatalf("table %v on the fresh node: %v, %v, %v; want %v", table, id, exists, err, want)
+				}
+			}
+			for k := 0; k < keys; k++ {
+				key := fmt.Sprintf("%d/%d", round, k)
+				entry, err := c.Node(follower).ReadRPC(ctx, &pb.ReadMsg{Key: key, Table: table, Attributes: []string{"value"}})
+				if err != nil || len(entry.Attributes) != 1 || string(entry.Attributes[0].Value) != key {
+					t.Fatalf("key %v of table %q on the fresh node: %v, %v", key, table, entry, err)
+				}
+			}
+		}
+	}
+}
+
+func TestLearnerPromotion(t *testing.T) {
+	c, err := newTestCluster(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Shutdown()
+	leader, err := c.WaitForLeader(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	learner, err := c.AddLearner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !c.Node(learner).inConfiguration() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the learner to join")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !c.Node(learner).isNonvoter() {
+		t.Fatal("learner joined as a voter")
+	}
+	if _, err := c.Node(leader).InsertRPC(ctx, &pb.Entry{Key: "key", Attributes: testAttributes("1")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WaitForApplied(c.Node(leader).raft.AppliedIndex(), 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := c.readValue(learner, "key"); err != nil || value != "1" {
+		t.Fatalf("learner read: got %q, %v", value, err)
+	}
+	_, err = c.Node(learner).InsertRPC(ctx, &pb.Entry{Key: "other", Attributes: testAttributes("2")})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected learner to reject writes, got %v", err)
+	}
+
+	if _, err := c.Node(leader).PromoteRPC(ctx, &pb.ServerMsg{Id: c.configs[learner].NodeID}); err != nil {
+		t.Fatal(err)
+	}
+	for c.Node(learner).isNonvoter() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the learner to be promoted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAdminErrors(t *testing.T) {
+	c, err := newTestCluster(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Shutdown()
+	leader, err := c.WaitForLeader(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The leader hint is the rpc address it registered
+	if err := c.WaitForFeatures(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	follower := c.Node((leader + 1) % 3)
+	unknown := &pb.ServerMsg{Id: "x", Address: "x:1"}
+	other := &pb.ServerMsg{Id: c.configs[(leader+2)%3].NodeID, Address: string(c.raftAddr((leader + 2) % 3))}
+	calls := []struct {
+		name string
+		call func() error
+		code codes.Code
+	}{
+		{"remove without id", func() error { _, err := c.Node(leader).RemoveServerRPC(ctx, &pb.ServerMsg{}); return err }, codes.InvalidArgument},
+		{"add without address", func() error { _, err := c.Node(leader).AddNonvoterRPC(ctx, &pb.ServerMsg{Id: "x"}); return err }, codes.InvalidArgument},
+		{"promote without id", func() error { _, err := c.Node(leader).PromoteRPC(ctx, &pb.ServerMsg{}); return err }, codes.InvalidArgument},
+		{"promote unknown server", func() error { _, err := c.Node(leader).PromoteRPC(ctx, &pb.ServerMsg{Id: "x"}); return err }, codes.NotFound},
+		{"remove on follower", func() error { _, err := follower.RemoveServerRPC(ctx, other); return err }, codes.FailedPrecondition},
+		{"add on follower", func() error { _, err := follower.AddNonvoterRPC(ctx, unknown); return err }, codes.FailedPrecondition},
+		{"promote on follower", func() error { _, err := follower.PromoteRPC(ctx, other); return err }, codes.FailedPrecondition},
+		{"transfer on follower", func() error { _, err := follower.TransferLeadershipRPC(ctx, &pb.ServerMsg{}); return err }, codes.FailedPrecondition},
+	}
+	for _, call := range calls {
+		err := call.call()
+		if status.Code(err) != call.code {
+			t.Errorf("%v: got %v, want %v", call.name, err, call.code)
+		}
+		if call.code == codes.FailedPrecondition && !strings.Contains(status.Convert(err).Message(), "leader is "+c.Node(leader).rpcAdvertise) {
+			t.Errorf("%v: no leader hint in %v", call.name, err)
+		}
+	}
+}
+
+// WaitForFeatures waits until every running node has seen that the cluster
+// supports every feature version, which happens once all have registered
+func (c *testCluster) WaitForFeatures(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		ready := true
+		for _, node := range c.nodes {
+			if node != nil && node.cachedFeatureVersion() < featureVersion {
+				ready = false
+			}
+		}
+		if ready {
+			return nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return fmt.Errorf("timed out waiting for feature version %d", featureVersion)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/triplewy/simpledb/client"
+	pb "github.com/triplewy/simpledb/grpc"
+)
+
+// parseAttribute parses an attribute of the form name:type=value, e.g. age:int=42.
+// The type defaults to string when omitted.
+func parseAttribute(arg string) (*pb.Attribute, error) {
+	i := strings.Index(arg, "=")
+	if i < 0 {
+		return nil, fmt.Errorf("invalid attribute %q: expected name[:type]=value", arg)
+	}
+	name, raw := arg[:i], arg[i+1:]
+	typeName := "string"
+	if j := strings.LastIndex(name, ":"); j >= 0 {
+		name, typeName = name[:j], name[j+1:]
+	}
+	if name == "" {
+		return nil, fmt.Errorf("invalid attribute %q: empty name", arg)
+	}
+	switch t := pb.Attribute_Type(pb.Attribute_Type_value[strings.ToUpper(typeName)]); t {
+	case pb.Attribute_MAP, pb.Attribute_LIST, pb.Attribute_JSON:
+		return &pb.Attribute{Name: name, Type: t, Value: []byte(raw)}, nil
+	}
+	v, err := parseValue(typeName, raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid attribute %q: %v", arg, err)
+	}
+	return client.Attribute(name, v)
+}
+
+// parseField parses a schema field of the form name:type[!][=default], e.g.
+// age:int!=0. A trailing ! on the type marks the field as required.
+func parseField(arg string) (*pb.SchemaField, error) {
+	spec, raw, hasDefault := arg, "", false
+	if i := strings.Index(arg, "="); i >= 0 {
+		spec, raw, hasDefault = arg[:i], arg[i+1:], true
+	}
+	j := strings.LastIndex(spec, ":")
+	if j < 0 {
+		return nil, fmt.Errorf("invalid field %q: expected name:type[!][=default]", arg)
+	}
+	name, typeName := spec[:j], spec[j+1:]
+	field := &pb.SchemaField{Name: name}
+	if strings.HasSuffix(typeName, "!") {
+		field.Required, typeName = true, strings.TrimSuffix(typeName, "!")
+	}
+	t, ok := pb.Attribute_Type_value[strings.ToUpper(typeName)]
+	if name == "" || !ok {
+		return nil, fmt.Errorf("invalid field %q: expected name:type[!][=default]", arg)
+	}
+	field.Type = pb.Attribute_Type(t)
+	if hasDefault {
+		value, err := parseAttribute(name + ":" + typeName + "=" + raw)
+		if err != nil {
+			return nil, err
+		}
+		field.Default = value
+	}
+	return field, nil
+}
+
+func parseValue(typeName, raw string) (interface{}, error) {
+	switch strings.ToUpper(typeName) {
+	case pb.Attribute_BOOL.String():
+		return strconv.ParseBool(raw)
+	case pb.Attribute_INT.String():
+		return strconv.ParseInt(raw, 10, 64)
+	case pb.Attribute_UINT.String():
+		return strconv.ParseUint(raw, 10, 64)
+	case pb.Attribute_FLOAT.String():
+		return strconv.ParseFloat(raw, 64)
+	case pb.Attribute_STRING.String():
+		return raw, nil
+	case pb.Attribute_BYTES.String():
+		return []byte(raw), nil
+	default:
+		return nil, fmt.Errorf("unknown type %q", typeName)
+	}
+}
+
+// decodeValue converts an attribute to a Go value for display, falling back
+// to its raw bytes if it is not validly encoded
+func decodeValue(attribute *pb.Attribute) interface{} {
+	v, err := client.Value(attribute)
+	if err != nil {
+		return attribute.Value
+	}
+	return v
+}
@@ -0,0 +1,439 @@
+// Command simpledb-cli is a command-line client for SimpleDB.
+//
+// Usage:
+//
+//	simpledb-cli [flags] <command> [args...]
+//
+// Commands:
+//
+//	get <key> [attribute...]           read an entry, optionally only some attributes
+//	get-path <key> <path>...           read values inside documents, e.g. address.city
+//	put <key> <name[:type]=value>...   insert an entry or update it if it exists
+//	insert <key> <name[:type]=value>...
+//	update <key> <name[:type]=value>...
+//	set-path <key> <path[:type]=value>...  set values inside documents
+//	delete <key>
+//	delete-range <startKey> <endKey>    delete the entries scan returns, printing the count
+//	delete-prefix <prefix>
+//	scan <startKey> <endKey> [attribute...]
+//	keys <startKey> <endKey>            list keys without attributes
+//	count <startKey> <endKey>
+//	count-prefix <prefix>
+//	query <name[:type]=value>           get entries by the value of an indexed attribute
+//	query-range <name[:type]> <start> <end>  an empty bound is unbounded
+//	index list
+//	index create <attribute>
+//	index drop <attribute>
+//	schema list
+//	schema set <prefix> <name:type[!][=default]>...  ! marks a required field
+//	schema drop <prefix>
+//	table list
+//	table create <name>
+//	table drop <name>
+//	admin status
+//	admin transfer-leadership [id address]
+//	admin snapshot
+//	admin remove-server <id>
+//	admin add-nonvoter <id> <address>
+//	admin promote <id>
+//
+// Attribute types are bool, int, uint, float, string, bytes, and map, list and
+// json for documents, e.g. age:int=42 or address:map='{"city":"Paris"}'.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	pb "github.com/triplewy/simpledb/grpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+var addr string
+var cert string
+var output string
+var timeout time.Duration
+var maxStaleness time.Duration
+var maxLagEntries uint64
+var filter string
+var table string
+var strict bool
+
+func init() {
+	flag.StringVar(&addr, "addr", "localhost:30000", "rpc address of a simpleDB node")
+	flag.StringVar(&cert, "cert", "", "TLS certificate file; plaintext if empty")
+	flag.StringVar(&output, "o", "table", "output format: table or json")
+	flag.DurationVar(&timeout, "timeout", 10*time.Second, "request timeout")
+	flag.DurationVar(&maxStaleness, "max-staleness", 0, "reads: forward to the leader if the node last heard from it longer ago")
+	flag.Uint64Var(&maxLagEntries, "max-lag-entries", 0, "reads: forward to the leader if the node is more log entries behind the leader's commit index")
+	flag.StringVar(&filter, "filter", "", `scan and keys: only return entries matching an expression, e.g. 'status = "active" AND age > 30'`)
+	flag.StringVar(&table, "table", "", "table of the entries, index and schema commands apply to; the default table if empty")
+	flag.BoolVar(&strict, "strict", false, "schema set: reject attributes that are not fields")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] <command> [args...]\n\n", os.Args[0])
+		fmt.Fprintln(flag.CommandLine.Output(), "Commands: get, get-path, set-path, put, insert, update, delete, delete-range, delete-prefix, scan, keys, count, count-prefix, query, query-range, index, schema, table, admin")
+		flag.PrintDefaults()
+	}
+}
+
+func main() {
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	conn, err := dial()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := run(ctx, conn, flag.Arg(0), flag.Args()[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func dial() (*grpc.ClientConn, error) {
+	opts := []grpc.DialOption{}
+	if cert == "" {
+		opts = append(opts, grpc.WithInsecure())
+	} else {
+		creds, err := credentials.NewClientTLSFromFile(cert, "")
+		if err != nil {
+			return nil, fmt.Errorf("could not create credentials: %v", err)
+		}
+		opts = append(opts, grpc.WithTransportCredentials(creds))
+	}
+	return grpc.Dial(addr, opts...)
+}
+
+func run(ctx context.Context, conn *grpc.ClientConn, cmd string, args []string) error {
+	client := pb.NewSimpleDbClient(conn)
+	switch cmd {
+	case "get":
+		if len(args) < 1 {
+			return errors.New("usage: get <key> [attribute...]")
+		}
+		entry, err := client.ReadRPC(ctx, &pb.ReadMsg{Key: args[0], Attributes: args[1:], MaxStaleness: staleness(), Table: table})
+		if err != nil {
+			return err
+		}
+		return printEntries(os.Stdout, output, []*pb.Entry{entry})
+	case "get-path":
+		if len(args) < 2 {
+			return errors.New("usage: get-path <key> <path>...")
+		}
+		entry, err := client.ReadRPC(ctx, &pb.ReadMsg{Key: args[0], Paths: args[1:], MaxStaleness: staleness(), Table: table})
+		if err != nil {
+			return err
+		}
+		return printEntries(os.Stdout, output, []*pb.Entry{entry})
+	case "set-path":
+		if len(args) < 2 {
+			return errors.New("usage: set-path <key> <path[:type]=value>...")
+		}
+		entry := &pb.Entry{Key: args[0], Table: table}
+		for _, arg := range args[1:] {
+			attribute, err := parseAttribute(arg)
+			if err != nil {
+				return err
+			}
+			entry.Paths = append(entry.Paths, attribute)
+		}
+		_, err := client.UpdateRPC(ctx, entry)
+		return err
+	case "put", "insert", "update":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: %s <key> <name[:type]=value>...", cmd)
+		}
+		entry := &pb.Entry{Key: args[0], Table: table}
+		for _, arg := range args[1:] {
+			attribute, err := parseAttribute(arg)
+			if err != nil {
+				return err
+			}
+			entry.Attributes = append(entry.Attributes, attribute)
+		}
+		var err error
+		switch cmd {
+		case "insert":
+			_, err = client.InsertRPC(ctx, entry)
+		case "update":
+			_, err = client.UpdateRPC(ctx, entry)
+		default:
+			_, err = client.InsertRPC(ctx, entry)
+			if err != nil && strings.Contains(err.Error(), "already exists") {
+				_, err = client.UpdateRPC(ctx, entry)
+			}
+		}
+		return err
+	case "delete":
+		if len(args) != 1 {
+			return errors.New("usage: delete <key>")
+		}
+		_, err := client.DeleteRPC(ctx, &pb.KeyMsg{Key: args[0], Table: table})
+		return err
+	case "delete-range":
+		if len(args) != 2 {
+			return errors.New("usage: delete-range <startKey> <endKey>")
+		}
+		msg, err := client.DeleteRangeRPC(ctx, &pb.RangeMsg{StartKey: args[0], EndKey: args[1], Table: table})
+		if err != nil {
+			return err
+		}
+		return printCount(os.Stdout, output, msg)
+	case "delete-prefix":
+		if len(args) != 1 {
+			return errors.New("usage: delete-prefix <prefix>")
+		}
+		msg, err := client.DeletePrefixRPC(ctx, &pb.PrefixMsg{Prefix: args[0], Table: table})
+		if err != nil {
+			return err
+		}
+		return printCount(os.Stdout, output, msg)
+	case "scan":
+		if len(args) < 2 {
+			return errors.New("usage: scan <startKey> <endKey> [attribute...]")
+		}
+		entries, err := client.ScanRPC(ctx, &pb.ScanMsg{StartKey: args[0], EndKey: args[1], Attributes: args[2:], MaxStaleness: staleness(), Filter: filter, Table: table})
+		if err != nil {
+			return err
+		}
+		return printEntries(os.Stdout, output, entries.Entries)
+	case "keys":
+		if len(args) != 2 {
+			return errors.New("usage: keys <startKey> <endKey>")
+		}
+		entries, err := client.ScanRPC(ctx, &pb.ScanMsg{StartKey: args[0], EndKey: args[1], MaxStaleness: staleness(), KeysOnly: true, Filter: filter, Table: table})
+		if err != nil {
+			return err
+		}
+		return printEntries(os.Stdout, output, entries.Entries)
+	case "count", "count-prefix":
+		msg := &pb.KeyRangeMsg{MaxStaleness: staleness(), Table: table}
+		switch {
+		case cmd == "count" && len(args) == 2:
+			msg.StartKey, msg.EndKey = args[0], args[1]
+		case cmd == "count-prefix" && len(args) == 1:
+			msg.Prefix = args[0]
+		case cmd == "count":
+			return errors.New("usage: count <startKey> <endKey>")
+		default:
+			return errors.New("usage: count-prefix <prefix>")
+		}
+		count, err := client.CountRPC(ctx, msg)
+		if err != nil {
+			return err
+		}
+		return printCount(os.Stdout, output, count)
+	case "query":
+		if len(args) != 1 {
+			return errors.New("usage: query <name[:type]=value>")
+		}
+		value, err := parseAttribute(args[0])
+		if err != nil {
+			return err
+		}
+		entries, err := client.QueryIndexRPC(ctx, &pb.IndexQueryMsg{Attribute: value.Name, Value: value, MaxStaleness: staleness(), Table: table})
+		if err != nil {
+			return err
+		}
+		return printEntries(os.Stdout, output, entries.Entries)
+	case "query-range":
+		if len(args) != 3 {
+			return errors.New("usage: query-range <name[:type]> <start> <end>")
+		}
+		msg := &pb.IndexQueryMsg{Attribute: args[0], MaxStaleness: staleness(), Table: table}
+		if i := strings.LastIndex(args[0], ":"); i >= 0 {
+			msg.Attribute = args[0][:i]
+		}
+		for i, bound := range []**pb.Attribute{&msg.Start, &msg.End} {
+			if args[i+1] == "" {
+				continue
+			}
+			value, err := parseAttribute(args[0] + "=" + args[i+1])
+			if err != nil {
+				return err
+			}
+			*bound = value
+		}
+		entries, err := client.QueryIndexRPC(ctx, msg)
+		if err != nil {
+			return err
+		}
+		return printEntries(os.Stdout, output, entries.Entries)
+	case "index":
+		return runIndex(ctx, client, args)
+	case "schema":
+		return runSchema(ctx, client, args)
+	case "table":
+		return runTable(ctx, client, args)
+	case "admin":
+		return runAdmin(ctx, pb.NewAdminClient(conn), args)
+	default:
+		return fmt.Errorf("unknown command: %v", cmd)
+	}
+}
+
+// staleness returns the read staleness bounds given by flags, or nil to read
+// from the node at addr
+func staleness() *pb.Staleness {
+	if maxStaleness == 0 && maxLagEntries == 0 {
+		return nil
+	}
+	return &pb.Staleness{
+		MaxLagMs:      int64(maxStaleness / time.Millisecond),
+		MaxLagEntries: maxLagEntries,
+	}
+}
+
+func runIndex(ctx context.Context, client pb.SimpleDbClient, args []string) error {
+	if len(args) < 1 {
+		return errors.New("usage: index <list|create|drop> [attribute]")
+	}
+	cmd, args := args[0], args[1:]
+	var err error
+	switch cmd {
+	case "list":
+		indexes, err := client.ListIndexesRPC(ctx, &pb.TableMsg{Name: table})
+		if err != nil {
+			return err
+		}
+		return printIndexes(os.Stdout, output, indexes)
+	case "create":
+		if len(args) != 1 {
+			return errors.New("usage: index create <attribute>")
+		}
+		_, err = client.CreateIndexRPC(ctx, &pb.IndexMsg{Attribute: args[0], Table: table})
+	case "drop":
+		if len(args) != 1 {
+			return errors.New("usage: index drop <attribute>")
+		}
+		_, err = client.DropIndexRPC(ctx, &pb.IndexMsg{Attribute: args[0], Table: table})
+	default:
+		return fmt.Errorf("unknown index command: %v", cmd)
+	}
+	return err
+}
+
+func runSchema(ctx context.Context, client pb.SimpleDbClient, args []string) error {
+	if len(args) < 1 {
+		return errors.New("usage: schema <list|set|drop> [prefix] [field...]")
+	}
+	cmd, args := args[0], args[1:]
+	var err error
+	switch cmd {
+	case "list":
+		schemas, err := client.ListSchemasRPC(ctx, &pb.TableMsg{Name: table})
+		if err != nil {
+			return err
+		}
+		return printSchemas(os.Stdout, output, schemas)
+	case "set":
+		if len(args) < 1 {
+			return errors.New("usage: schema set <prefix> <name:type[!][=default]>...")
+		}
+		msg := &pb.SchemaMsg{Table: table, Prefix: args[0], Strict: strict}
+		for _, arg := range args[1:] {
+			field, err := parseField(arg)
+			if err != nil {
+				return err
+			}
+			msg.Fields = append(msg.Fields, field)
+		}
+		_, err = client.SetSchemaRPC(ctx, msg)
+	case "drop":
+		if len(args) != 1 {
+			return errors.New("usage: schema drop <prefix>")
+		}
+		_, err = client.DropSchemaRPC(ctx, &pb.SchemaMsg{Table: table, Prefix: args[0]})
+	default:
+		return fmt.Errorf("unknown schema command: %v", cmd)
+	}
+	return err
+}
+
+func runTable(ctx context.Context, client pb.SimpleDbClient, args []string) error {
+	if len(args) < 1 {
+		return errors.New("usage: table <list|create|drop> [name]")
+	}
+	cmd, args := args[0], args[1:]
+	var err error
+	switch cmd {
+	case "list":
+		tables, err := client.ListTablesRPC(ctx, &pb.EmptyMsg{})
+		if err != nil {
+			return err
+		}
+		return printTables(os.Stdout, output, tables)
+	case "create":
+		if len(args) != 1 {
+			return errors.New("usage: table create <name>")
+		}
+		_, err = client.CreateTableRPC(ctx, &pb.TableMsg{Name: args[0]})
+	case "drop":
+		if len(args) != 1 {
+			return errors.New("usage: table drop <name>")
+		}
+		_, err = client.DropTableRPC(ctx, &pb.TableMsg{Name: args[0]})
+	default:
+		return fmt.Errorf("unknown table command: %v", cmd)
+	}
+	return err
+}
+
+func runAdmin(ctx context.Context, client pb.AdminClient, args []string) error {
+	if len(args) < 1 {
+		return errors.New("usage: admin <status|transfer-leadership|snapshot|remove-server|add-nonvoter|promote> [args...]")
+	}
+	cmd, args := args[0], args[1:]
+	var err error
+	switch cmd {
+	case "status":
+		status, err := client.StatusRPC(ctx, &pb.EmptyMsg{})
+		if err != nil {
+			return err
+		}
+		return printStatus(os.Stdout, output, status)
+	case "transfer-leadership":
+		msg := &pb.ServerMsg{}
+		switch len(args) {
+		case 0:
+		case 2:
+			msg.Id, msg.Address = args[0], args[1]
+		default:
+			return errors.New("usage: admin transfer-leadership [id address]")
+		}
+		_, err = client.TransferLeadershipRPC(ctx, msg)
+	case "snapshot":
+		_, err = client.TriggerSnapshotRPC(ctx, &pb.EmptyMsg{})
+	case "remove-server":
+		if len(args) != 1 {
+			return errors.New("usage: admin remove-server <id>")
+		}
+		_, err = client.RemoveServerRPC(ctx, &pb.ServerMsg{Id: args[0]})
+	case "add-nonvoter":
+		if len(args) != 2 {
+			return errors.New("usage: admin add-nonvoter <id> <address>")
+		}
+		_, err = client.AddNonvoterRPC(ctx, &pb.ServerMsg{Id: args[0], Address: args[1]})
+	case "promote":
+		if len(args) != 1 {
+			return errors.New("usage: admin promote <id>")
+		}
+		_, err = client.PromoteRPC(ctx, &pb.ServerMsg{Id: args[0]})
+	default:
+		return fmt.Errorf("unknown admin command: %v", cmd)
+	}
+	return err
+}
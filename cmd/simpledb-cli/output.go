@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	pb "github.com/triplewy/simpledb/grpc"
+)
+
+type jsonEntry struct {
+	Key        string                 `json:"key"`
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+func toJSONEntry(entry *pb.Entry) *jsonEntry {
+	attributes := make(map[string]interface{})
+	for _, attribute := range entry.Attributes {
+		attributes[attribute.Name] = decodeValue(attribute)
+	}
+	return &jsonEntry{Key: entry.Key, Attributes: attributes}
+}
+
+// printEntries writes entries to w in the given format, one attribute per table row
+func printEntries(w io.Writer, format string, entries []*pb.Entry) error {
+	switch format {
+	case "json":
+		result := []*jsonEntry{}
+		for _, entry := range entries {
+			result = append(result, toJSONEntry(entry))
+		}
+		return printJSON(w, result)
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "KEY\tATTRIBUTE\tTYPE\tVALUE")
+		for _, entry := range entries {
+			attributes := append([]*pb.Attribute{}, entry.Attributes...)
+			sort.Slice(attributes, func(i, j int) bool { return attributes[i].Name < attributes[j].Name })
+			if len(attributes) == 0 {
+				fmt.Fprintf(tw, "%s\t\t\t\n", entry.Key)
+			}
+			for _, attribute := range attributes {
+				value := decodeValue(attribute)
+				switch attribute.Type {
+				case pb.Attribute_MAP, pb.Attribute_LIST, pb.Attribute_JSON:
+					value = string(attribute.Value)
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%v\n", entry.Key, attribute.Name,
+					strings.ToLower(attribute.Type.String()), value)
+			}
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown output format: %v", format)
+	}
+}
+
+// printStatus writes cluster status to w in the given format
+func printStatus(w io.Writer, format string, status *pb.StatusMsg) error {
+	switch format {
+	case "json":
+		return printJSON(w, status)
+	case "table":
+		fmt.Fprintf(w, "id: %s\nrpc address: %s\nstate: %s\nleader: %s\nterm: %d\ncommit index: %d\napplied index: %d\nreplication lag: %d\nfeature version: %d (cluster %d)\n\n",
+			status.Id, status.RpcAddress, status.State, status.Leader, status.Term, status.CommitIndex, status.AppliedIndex, status.ReplicationLag,
+			status.FeatureVersion, status.ClusterFeatureVersion)
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tADDRESS\tSUFFRAGE\tLEADER\tLAST CONTACT\tLAG")
+		for _, server := range status.Servers {
+			lastContact, lag := "-", "-"
+			if server.LastContact >= 0 {
+				lastContact = fmt.Sprintf("%dms", server.LastContact)
+			}
+			if server.ReplicationLag >= 0 {
+				lag = fmt.Sprint(server.ReplicationLag)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%v\t%s\t%s\n", server.Id, server.Address,
+				strings.ToLower(server.Suffrage.String()), server.Leader, lastContact, lag)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown output format: %v", format)
+	}
+}
+
+// printCount writes a count to w in the given format
+func printCount(w io.Writer, format string, msg *pb.CountMsg) error {
+	switch format {
+	case "json":
+		return printJSON(w, msg)
+	case "table":
+		_, err := fmt.Fprintln(w, msg.Count)
+		return err
+	default:
+		return fmt.Errorf("unknown output format: %v", format)
+	}
+}
+
+// printIndexes writes secondary indexes to w in the given format
+func printIndexes(w io.Writer, format string, msg *pb.IndexesMsg) error {
+	switch format {
+	case "json":
+		return printJSON(w, msg.Indexes)
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ATTRIBUTE\tREADY")
+		for _, index := range msg.Indexes {
+			fmt.Fprintf(tw, "%s\t%v\n", index.Attribute, index.Ready)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown output format: %v", format)
+	}
+}
+
+// printSchemas writes schemas to w in the given format, one field per table row
+func printSchemas(w io.Writer, format string, msg *pb.SchemasMsg) error {
+	switch format {
+	case "json":
+		return printJSON(w, msg.Schemas)
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "PREFIX\tSTRICT\tFIELD\tTYPE\tREQUIRED\tDEFAULT")
+		for _, schema := range msg.Schemas {
+			if len(schema.Fields) == 0 {
+				fmt.Fprintf(tw, "%q\t%v\t\t\t\t\n", schema.Prefix, schema.Strict)
+			}
+			for _, field := range schema.Fields {
+				def := ""
+				if field.Default != nil {
+					def = fmt.Sprint(decodeValue(field.Default))
+				}
+				fmt.Fprintf(tw, "%q\t%v\t%s\t%s\t%v\t%s\n", schema.Prefix, schema.Strict, field.Name, strings.ToLower(field.Type.String()), field.Required, def)
+			}
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown output format: %v", format)
+	}
+}
+
+// printTables writes table names to w in the given format
+func printTables(w io.Writer, format string, msg *pb.TablesMsg) error {
+	switch format {
+	case "json":
+		return printJSON(w, msg.Names)
+	case "table":
+		for _, name := range msg.Names {
+			if _, err := fmt.Fprintln(w, name); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown output format: %v", format)
+	}
+}
+
+func printJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
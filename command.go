@@ -0,0 +1,274 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	simpledb "github.com/triplewy/simpledb-embedded"
+)
+
+// Feature versions gate changes to the replicated command format. A node
+// supports every version up to featureVersion, and the leader only proposes
+// what every server in the cluster supports.
+const (
+	// featureLegacy commands are plain msgpack encoded
+	featureLegacy uint8 = 1
+	// featureEnvelope commands are wrapped in a versioned envelope
+	featureEnvelope uint8 = 2
+	// featureDeleteRange adds the DeleteRange and DeletePrefix ops
+	featureDeleteRange uint8 = 3
+	// featureIndexes adds secondary indexes
+	featureIndexes uint8 = 4
+	// featureTables adds tables
+	featureTables uint8 = 5
+	// featureSchemas adds schemas
+	featureSchemas uint8 = 6
+	// featureDocuments adds document attributes and the UpdatePaths op
+	featureDocuments uint8 = 7
+	// featureSessionExpiry adds the ExpireSessions op
+	featureSessionExpiry uint8 = 8
+
+	// featureVersion is the highest feature version supported by this node
+	featureVersion = featureSessionExpiry
+)
+
+// envelopeMagic starts a versioned command. It is never used by msgpack, so
+// it cannot start a legacy command.
+const envelopeMagic byte = 0xc1
+
+// opHandler applies an op within a transaction and returns an op specific
+// count, e.g. the number of keys removed by a range delete. It must not write
+// anything if it returns an error.
+type opHandler struct {
+	name string
+	// version is the feature version that introduced the op
+	version uint8
+	// dropped ops may apply to a table that was dropped
+	dropped bool
+	apply   func(txn *simpledb.Txn, c *Command) (uint64, error)
+}
+
+// opHandlers is the registry of ops the FSM can apply
+var opHandlers = map[uint8]*opHandler{
+	Insert:   {name: "insert", version: featureLegacy, apply: applyInsert},
+	Update:   {name: "update", version: featureLegacy, apply: applyUpdate},
+	Delete:   {name: "delete", version: featureLegacy, apply: applyDelete},
+	Announce: {name: "announce", version: featureLegacy, apply: applyPut},
+	Register: {name: "register", version: featureLegacy, apply: applyPut},
+
+	DeleteRange:  {name: "delete range", version: featureDeleteRange, apply: applyDeleteRange},
+	DeletePrefix: {name: "delete prefix", version: featureDeleteRange, apply: applyDeletePrefix},
+
+	CreateIndex:   {name: "create index", version: featureIndexes, apply: applyCreateIndex},
+	DropIndex:     {name: "drop index", version: featureIndexes, apply: applyDropIndex},
+	BackfillIndex: {name: "backfill index", version: featureIndexes, apply: applyBackfillIndex},
+
+	CreateTable: {name: "create table", version: featureTables, apply: applyCreateTable},
+	DropTable:   {name: "drop table", version: featureTables, apply: applyDropTable},
+	PurgeTable:  {name: "purge table", version: featureTables, dropped: true, apply: applyPurgeTable},
+
+	SetSchema:  {name: "set schema", version: featureSchemas, apply: applySetSchema},
+	DropSchema: {name: "drop schema", version: featureSchemas, apply: applyDropSchema},
+
+	UpdatePaths: {name: "update paths", version: featureDocuments, apply: applyUpdate},
+
+	ExpireSessions: {name: "expire sessions", version: featureSessionExpiry, apply: applyExpireSessions},
+}
+
+// encodeCommand encodes c in the format of the given cluster feature version.
+// The envelope carries the feature version needed to apply c, so that a node
+// that does not support it stops instead of applying it wrong.
+func encodeCommand(c *Command, version uint8) ([]byte, error) {
+	required, err := commandVersion(c)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := encodeMsgPack(c)
+	if err != nil {
+		return nil, err
+	}
+	if version < featureEnvelope {
+		return buf.Bytes(), nil
+	}
+	return append([]byte{envelopeMagic, required}, buf.Bytes()...), nil
+}
+
+// commandVersion returns the feature version that introduced the op of c or
+// any of the fields it sets
+func commandVersion(c *Command) (uint8, error) {
+	handler, ok := opHandlers[c.Op]
+	if !ok {
+		return 0, fmt.Errorf("unknown command: %v", c.Op)
+	}
+	version := featureEnvelope
+	if handler.version > version {
+		version = handler.version
+	}
+	if c.Table != 0 && version < featureTables {
+		version = featureTables
+	}
+	if (len(c.Paths) > 0 || hasDocuments(c.Values)) && version < featureDocuments {
+		version = featureDocuments
+	}
+	return version, nil
+}
+
+// decodeCommand decodes a command in any supported format
+func decodeCommand(data []byte) (*Command, error) {
+	if len(data) > 0 && data[0] == envelopeMagic {
+		if len(data) < 2 {
+			return nil, fmt.Errorf("truncated command envelope")
+		}
+		if data[1] > featureVersion {
+			return nil, fmt.Errorf("command version %d is newer than supported version %d", data[1], featureVersion)
+		}
+		data = data[2:]
+	}
+	var c Command
+	if err := decodeMsgPack(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to decode command: %v", err)
+	}
+	return &c, nil
+}
+
+func applyInsert(txn *simpledb.Txn, c *Command) (uint64, error) {
+	exists, err := txn.Exists(c.Key)
+	if err != nil {
+		return 0, err
+	}
+	if exists {
+		return 0, fmt.Errorf("key: %v already exists", c.Key)
+	}
+	values, err := enforceSchema(txn, c, c.Values, c.Values)
+	if err != nil {
+		return 0, err
+	}
+	defs, err := readIndexes(txn, tableID(c.Table))
+	if err != nil {
+		return 0, err
+	}
+	txn.Write(c.Key, values)
+	planIndexUpdate(defs, c.Key, nil, values).apply(txn)
+	return 0, nil
+}
+
+func applyUpdate(txn *simpledb.Txn, c *Command) (uint64, error) {
+	entry, err := txn.Read(c.Key)
+	if err != nil {
+		return 0, err
+	}
+	defs, err := readIndexes(txn, tableID(c.Table))
+	if err != nil {
+		return 0, err
+	}
+	attributes := make(map[string]*simpledb.Value, len(entry.Attributes)+len(c.Values))
+	for name, value := range entry.Attributes {
+		attributes[name] = value
+	}
+	for name, value := range c.Values {
+		attributes[name] = value
+	}
+	written := c.Values
+	if len(c.Paths) > 0 {
+		changed, err := applyPaths(attributes, c.Paths)
+		if err != nil {
+			return 0, err
+		}
+		written = make(map[string]*simpledb.Value, len(c.Values)+len(changed))
+		for _, values := range []map[string]*simpledb.Value{c.Values, changed} {
+			for name, value := range values {
+				written[name] = value
+			}
+		}
+	}
+	attributes, err = enforceSchema(txn, c, written, attributes)
+	if err != nil {
+		return 0, err
+	}
+	txn.Write(c.Key, attributes)
+	planIndexUpdate(defs, c.Key, entry.Attributes, attributes).apply(txn)
+	return 0, nil
+}
+
+func applyDelete(txn *simpledb.Txn, c *Command) (uint64, error) {
+	defs, err := readIndexes(txn, tableID(c.Table))
+	if err != nil {
+		return 0, err
+	}
+	if len(defs) > 0 {
+		entry, err := txn.Read(c.Key)
+		if err == nil {
+			planIndexUpdate(defs, c.Key, entry.Attributes, nil).apply(txn)
+		} else if _, ok := err.(*simpledb.ErrKeyNotFound); !ok {
+			return 0, err
+		}
+	}
+	txn.Delete(c.Key)
+	return 0, nil
+}
+
+// applyPut overwrites the entry at the key
+func applyPut(txn *simpledb.Txn, c *Command) (uint64, error) {
+	txn.Write(c.Key, c.Values)
+	return 0, nil
+}
+
+// applyDeleteRange deletes the entries of Table a scan from Key to EndKey
+// returns
+func applyDeleteRange(txn *simpledb.Txn, c *Command) (uint64, error) {
+	table := tableID(c.Table)
+	entries, err := txn.Scan(c.Key, c.EndKey)
+	if err != nil {
+		return 0, err
+	}
+	defs, err := readIndexes(txn, tableID(c.Table))
+	if err != nil {
+		return 0, err
+	}
+	count := uint64(0)
+	for _, entry := range entries {
+		if !table.contains(entry.Key) {
+			continue
+		}
+		planIndexUpdate(defs, entry.Key, entry.Attributes, nil).apply(txn)
+		txn.Delete(entry.Key)
+		count++
+	}
+	return count, nil
+}
+
+// applyDeletePrefix deletes the entries of Table whose key starts with Key
+func applyDeletePrefix(txn *simpledb.Txn, c *Command) (uint64, error) {
+	table := tableID(c.Table)
+	entries, err := txn.Scan(c.Key, prefixEnd(c.Key))
+	if err != nil {
+		return 0, err
+	}
+	defs, err := readIndexes(txn, tableID(c.Table))
+	if err != nil {
+		return 0, err
+	}
+	count := uint64(0)
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Key, c.Key) || !table.contains(entry.Key) {
+			continue
+		}
+		planIndexUpdate(defs, entry.Key, entry.Attributes, nil).apply(txn)
+		txn.Delete(entry.Key)
+		count++
+	}
+	return count, nil
+}
+
+// prefixEnd returns the smallest key greater than every key starting with
+// prefix, or a key of 0xff bytes if there is none
+func prefixEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+	return prefix + strings.Repeat("\xff", 8)
+}
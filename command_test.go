@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	simpledb "github.com/triplewy/simpledb-embedded"
+	pb "github.com/triplewy/simpledb/grpc"
+)
+
+func TestEncodeCommandVersion(t *testing.T) {
+	doc := map[string]*simpledb.Value{"d": documentValue(pb.Attribute_MAP, []byte(`{}`))}
+	cases := []struct {
+		c    *Command
+		want uint8
+	}{
+		{&Command{Op: Insert, Key: "a"}, featureEnvelope},
+		{&Command{Op: Insert, Key: "a", Table: 1}, featureTables},
+		{&Command{Op: Insert, Key: "a", Values: doc}, featureDocuments},
+		{&Command{Op: DeleteRange, Key: "a", EndKey: "b"}, featureDeleteRange},
+		{&Command{Op: CreateIndex, Key: "a"}, featureIndexes},
+		{&Command{Op: ExpireSessions}, featureSessionExpiry},
+	}
+	for _, tc := range cases {
+		data, err := encodeCommand(tc.c, featureVersion)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data[0] != envelopeMagic || data[1] != tc.want {
+			t.Errorf("op %d encoded with version %d, want %d", tc.c.Op, data[1], tc.want)
+		}
+		if _, err := decodeCommand(data); err != nil {
+			t.Errorf("op %d: %v", tc.c.Op, err)
+		}
+		// A node that does not support the version refuses the command
+		data[1] = featureVersion + 1
+		if _, err := decodeCommand(data); err == nil {
+			t.Errorf("op %d decoded with an unsupported version", tc.c.Op)
+		}
+	}
+
+	data, err := encodeCommand(&Command{Op: Insert, Key: "a"}, featureLegacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data[0] == envelopeMagic {
+		t.Error("legacy cluster got an envelope")
+	}
+	if _, err := encodeCommand(&Command{Op: 255}, featureVersion); err == nil {
+		t.Error("encoded an unknown op")
+	}
+}
+
+func TestDeleteRange(t *testing.T) {
+	tests := []struct {
+		name  string
+		c     *Command
+		count uint64
+		kept  string
+	}{
+		// Like a scan, the range includes its end key
+		{"range", &Command{Op: DeleteRange, Key: "b", EndKey: "d"}, 4, "[a e\xff \xff \xff\xff]"},
+		{"empty range", &Command{Op: DeleteRange, Key: "bb", EndKey: "bc"}, 0, "[a b b0 c d e\xff \xff \xff\xff]"},
+		{"reversed range", &Command{Op: DeleteRange, Key: "d", EndKey: "b"}, 0, "[a b b0 c d e\xff \xff \xff\xff]"},
+		{"range to the end", &Command{Op: DeleteRange, Key: "e", EndKey: keyspaceEnd}, 3, "[a b b0 c d]"},
+		{"prefix", &Command{Op: DeletePrefix, Key: "b"}, 2, "[a c d e\xff \xff \xff\xff]"},
+		{"missing prefix", &Command{Op: DeletePrefix, Key: "x"}, 0, "[a b b0 c d e\xff \xff \xff\xff]"},
+		{"prefix ending in 0xff", &Command{Op: DeletePrefix, Key: "e\xff"}, 1, "[a b b0 c d \xff \xff\xff]"},
+		{"prefix of 0xff", &Command{Op: DeletePrefix, Key: "\xff"}, 2, "[a b b0 c d e\xff]"},
+	}
+	for _, test := range tests {
+		s := newTestStore(t)
+		for _, key := range []string{"a", "b", "b0", "c", "d", "e\xff", "\xff", "\xff\xff"} {
+			if resp := s.execute(&Command{Op: Insert, Key: key}, 0); resp.err != nil {
+				t.Fatal(resp.err)
+			}
+		}
+		// Keys of other tables and internal keys are never deleted
+		if resp := s.execute(&Command{Op: CreateTable, Key: "other"}, 0); resp.err != nil {
+			t.Fatal(resp.err)
+		}
+		if resp := s.execute(&Command{Op: Insert, Key: tableID(1).key("b"), Table: 1}, 0); resp.err != nil {
+			t.Fatal(resp.err)
+		}
+
+		resp := s.execute(test.c, 0)
+		if resp.err != nil || resp.count != test.count {
+			t.Errorf("%v: deleted %d keys, %v", test.name, resp.count, resp.err)
+		}
+		var kept []string
+		entries, err := s.db.StartTxn().Scan("", keyspaceEnd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range entries {
+			if defaultTable.contains(entry.Key) {
+				kept = append(kept, entry.Key)
+			}
+		}
+		if fmt.Sprint(kept) != test.kept {
+			t.Errorf("%v: kept %q", test.name, kept)
+		}
+		if exists, err := s.db.StartTxn().Exists(tableID(1).key("b")); err != nil || !exists {
+			t.Errorf("%v: deleted a key of another table", test.name)
+		}
+	}
+}
+
+func TestPrefixEnd(t *testing.T) {
+	tests := []struct {
+		prefix string
+		end    string
+	}{
+		{"a", "b"},
+		{"ab", "ac"},
+		{"a\xff", "b"},
+		{"a\xff\xff", "b"},
+		{"\x00", "\x01"},
+		{"\xff", "\xff" + keyspaceEnd},
+		{"\xff\xff", "\xff\xff" + keyspaceEnd},
+		{"", keyspaceEnd},
+	}
+	for _, test := range tests {
+		if end := prefixEnd(test.prefix); end != test.end {
+			t.Errorf("prefix end of %q is %q, expected %q", test.prefix, end, test.end)
+		}
+	}
+}
@@ -1,14 +1,319 @@
 package main
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/raft"
+	yaml "gopkg.in/yaml.v2"
+)
 
 const dirPerm = 0700
 const filePerm = 0600
-const applyTimeout = 10 * time.Second
+const defaultApplyTimeout = 10 * time.Second
+const defaultRetainSnapshots = 2
+const defaultLogCacheSize = 512
+
+// envPrefix prefixes environment variables overriding config fields, e.g.
+// SIMPLEDB_RAFT_HEARTBEAT_TIMEOUT overrides raft.heartbeat_timeout
+const envPrefix = "SIMPLEDB_"
 
-// Config is configuration for db
+// Config is configuration for db. It is loaded from defaults, then an
+// optional YAML file, then SIMPLEDB_* environment variables, then flags.
+// The embedded DB has no settings: simpledb.NewDB only takes the directory,
+// which is data under DataDir.
 type Config struct {
-	dataDir  string
-	rpcPort  int
-	raftPort int
+	// NodeID is the raft server ID. It is persisted in DataDir on first start
+	// and derived from the host's ip if empty.
+	NodeID  string `yaml:"node_id"`
+	DataDir string `yaml:"data_dir"`
+
+	// BindAddr is the host the rpc, raft and http listeners bind to.
+	// Binds to all interfaces if empty.
+	BindAddr string `yaml:"bind_addr"`
+	RPCPort  int    `yaml:"rpc_port"`
+	RaftPort int    `yaml:"raft_port"`
+	HTTPPort int    `yaml:"http_port"`
+	// RPCAdvertise and RaftAdvertise are the host:port other nodes and
+	// clients use to reach this node. Default to the host's ip and the port.
+	RPCAdvertise  string `yaml:"rpc_advertise"`
+	RaftAdvertise string `yaml:"raft_advertise"`
+
+	// Nonvoter starts the node as a read-only learner. It does not bootstrap
+	// a cluster and must be added with AddNonvoterRPC, or ask to be added by
+	// setting Join.
+	Nonvoter bool `yaml:"nonvoter"`
+	// Join is a comma-separated list of rpc addresses of cluster members that
+	// a nonvoter asks to add it on startup
+	Join string `yaml:"join"`
+
+	Raft RaftConfig `yaml:"raft"`
+	TLS  TLSConfig  `yaml:"tls"`
+
+	// transport overrides the raft TCP transport on RaftPort, e.g. with a
+	// raft.InmemTransport for in-process clusters
+	transport raft.Transport
+	// servers is the configuration to bootstrap a new cluster with. A
+	// single-node cluster of this node is bootstrapped if empty.
+	servers []raft.Server
+}
+
+// RaftConfig tunes raft. Zero values use the defaults of raft.DefaultConfig()
+// and DefaultConfig().
+type RaftConfig struct {
+	HeartbeatTimeout   time.Duration `yaml:"heartbeat_timeout"`
+	ElectionTimeout    time.Duration `yaml:"election_timeout"`
+	LeaderLeaseTimeout time.Duration `yaml:"leader_lease_timeout"`
+	CommitTimeout      time.Duration `yaml:"commit_timeout"`
+	// ApplyTimeout bounds how long a write waits to be committed
+	ApplyTimeout time.Duration `yaml:"apply_timeout"`
+	// MaxAppendEntries is the maximum number of log entries sent to a
+	// follower in one AppendEntries request
+	MaxAppendEntries int `yaml:"max_append_entries"`
+	// SnapshotInterval is how often raft checks whether to snapshot, and
+	// SnapshotThreshold how many new log entries trigger one
+	SnapshotInterval  time.Duration `yaml:"snapshot_interval"`
+	SnapshotThreshold uint64        `yaml:"snapshot_threshold"`
+	// TrailingLogs is the number of log entries kept after a snapshot.
+	// Snapshots hold the whole state of the FSM, so no value loses writes;
+	// fewer entries make lagging followers catch up from a snapshot instead.
+	TrailingLogs uint64 `yaml:"trailing_logs"`
+	// RetainSnapshots is the number of snapshots kept on disk
+	RetainSnapshots int `yaml:"retain_snapshots"`
+	// LogCacheSize is the number of recent log entries cached in memory
+	LogCacheSize int `yaml:"log_cache_size"`
+}
+
+// TLSConfig enables TLS on the gRPC server when both files are set
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+// DefaultConfig returns the default configuration
+func DefaultConfig() *Config {
+	raftConfig := raft.DefaultConfig()
+	return &Config{
+		DataDir:  "/tmp/simpledb",
+		RPCPort:  30000,
+		RaftPort: 30001,
+		HTTPPort: 30002,
+		Raft: RaftConfig{
+			HeartbeatTimeout:   raftConfig.HeartbeatTimeout,
+			ElectionTimeout:    raftConfig.ElectionTimeout,
+			LeaderLeaseTimeout: raftConfig.LeaderLeaseTimeout,
+			CommitTimeout:      raftConfig.CommitTimeout,
+			ApplyTimeout:       defaultApplyTimeout,
+			MaxAppendEntries:   raftConfig.MaxAppendEntries,
+			SnapshotInterval:   raftConfig.SnapshotInterval,
+			SnapshotThreshold:  raftConfig.SnapshotThreshold,
+			TrailingLogs:       raftConfig.TrailingLogs,
+			RetainSnapshots:    defaultRetainSnapshots,
+			LogCacheSize:       defaultLogCacheSize,
+		},
+	}
+}
+
+// LoadFile overrides config with the fields set in a YAML file
+func (config *Config) LoadFile(path string) error {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := yaml.UnmarshalStrict(buf, config); err != nil {
+		return fmt.Errorf("config file %v: %v", path, err)
+	}
+	return nil
+}
+
+// LoadEnv overrides config with SIMPLEDB_* environment variables named after
+// the YAML keys of its fields
+func (config *Config) LoadEnv() error {
+	return loadEnv(reflect.ValueOf(config).Elem(), envPrefix)
+}
+
+func loadEnv(v reflect.Value, prefix string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("yaml")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		name := prefix + strings.ToUpper(tag)
+		if field.Type.Kind() == reflect.Struct {
+			if err := loadEnv(v.Field(i), name+"_"); err != nil {
+				return err
+			}
+			continue
+		}
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setField(v.Field(i), value); err != nil {
+			return fmt.Errorf("%v: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// Marshal returns config as YAML with durations written like 500ms, so that
+// it can be loaded again
+func (config *Config) Marshal() ([]byte, error) {
+	return yaml.Marshal(marshalFields(reflect.ValueOf(config).Elem()))
+}
+
+func marshalFields(v reflect.Value) yaml.MapSlice {
+	t := v.Type()
+	fields := yaml.MapSlice{}
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("yaml")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		field := v.Field(i)
+		var value interface{}
+		switch {
+		case field.Type() == reflect.TypeOf(time.Duration(0)):
+			value = time.Duration(field.Int()).String()
+		case field.Kind() == reflect.Struct:
+			value = marshalFields(field)
+		default:
+			value = field.Interface()
+		}
+		fields = append(fields, yaml.MapItem{Key: tag, Value: value})
+	}
+	return fields
+}
+
+func setField(field reflect.Value, value string) error {
+	if field.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int:
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(i))
+	case reflect.Uint64:
+		u, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetUint(u)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported config type %v", field.Type())
+	}
+	return nil
+}
+
+// Validate checks that config is usable
+func (config *Config) Validate() error {
+	if config.DataDir == "" {
+		return errors.New("data_dir is required")
+	}
+	for name, port := range map[string]int{"rpc_port": config.RPCPort, "raft_port": config.RaftPort, "http_port": config.HTTPPort} {
+		if port < 0 || port > 65535 {
+			return fmt.Errorf("%v out of range: %d", name, port)
+		}
+	}
+	if (config.TLS.CertFile == "") != (config.TLS.KeyFile == "") {
+		return errors.New("tls.cert_file and tls.key_file must be set together")
+	}
+	if config.Join != "" && !config.Nonvoter {
+		return errors.New("join requires nonvoter; promote learners to voters with PromoteRPC")
+	}
+	if config.Raft.ApplyTimeout < 0 {
+		return errors.New("raft.apply_timeout must not be negative")
+	}
+	if config.Raft.RetainSnapshots < 0 {
+		return errors.New("raft.retain_snapshots must not be negative")
+	}
+	if config.Raft.LogCacheSize < 0 {
+		return errors.New("raft.log_cache_size must not be negative")
+	}
+	raftConfig := config.raftConfig()
+	// The node ID may still be derived at startup
+	if raftConfig.LocalID == "" {
+		raftConfig.LocalID = "unset"
+	}
+	return raft.ValidateConfig(raftConfig)
+}
+
+// raftConfig returns raft.DefaultConfig() overridden by the non-zero fields
+// of config.Raft
+func (config *Config) raftConfig() *raft.Config {
+	raftConfig := raft.DefaultConfig()
+	raftConfig.LocalID = raft.ServerID(config.NodeID)
+	if config.Raft.HeartbeatTimeout > 0 {
+		raftConfig.HeartbeatTimeout = config.Raft.HeartbeatTimeout
+	}
+	if config.Raft.ElectionTimeout > 0 {
+		raftConfig.ElectionTimeout = config.Raft.ElectionTimeout
+	}
+	if config.Raft.LeaderLeaseTimeout > 0 {
+		raftConfig.LeaderLeaseTimeout = config.Raft.LeaderLeaseTimeout
+	}
+	if config.Raft.CommitTimeout > 0 {
+		raftConfig.CommitTimeout = config.Raft.CommitTimeout
+	}
+	if config.Raft.MaxAppendEntries > 0 {
+		raftConfig.MaxAppendEntries = config.Raft.MaxAppendEntries
+	}
+	if config.Raft.SnapshotInterval > 0 {
+		raftConfig.SnapshotInterval = config.Raft.SnapshotInterval
+	}
+	if config.Raft.SnapshotThreshold > 0 {
+		raftConfig.SnapshotThreshold = config.Raft.SnapshotThreshold
+	}
+	if config.Raft.TrailingLogs > 0 {
+		raftConfig.TrailingLogs = config.Raft.TrailingLogs
+	}
+	return raftConfig
+}
+
+// applyTimeout returns how long writes wait to be committed
+func (config *Config) applyTimeout() time.Duration {
+	if config.Raft.ApplyTimeout > 0 {
+		return config.Raft.ApplyTimeout
+	}
+	return defaultApplyTimeout
+}
+
+// retainSnapshots returns the number of snapshots kept on disk
+func (config *Config) retainSnapshots() int {
+	if config.Raft.RetainSnapshots > 0 {
+		return config.Raft.RetainSnapshots
+	}
+	return defaultRetainSnapshots
+}
+
+// logCacheSize returns the number of recent log entries cached in memory
+func (config *Config) logCacheSize() int {
+	if config.Raft.LogCacheSize > 0 {
+		return config.Raft.LogCacheSize
+	}
+	return defaultLogCacheSize
 }
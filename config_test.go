@@ -0,0 +1,40 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigMarshal(t *testing.T) {
+	config := DefaultConfig()
+	config.Raft.HeartbeatTimeout = 500 * time.Millisecond
+	buf, err := config.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(buf), "heartbeat_timeout: 500ms") {
+		t.Fatalf("expected durations as strings:\n%s", buf)
+	}
+
+	dir, err := ioutil.TempDir("", "simpledb-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yml")
+	if err := ioutil.WriteFile(path, buf, filePerm); err != nil {
+		t.Fatal(err)
+	}
+	loaded := &Config{}
+	if err := loaded.LoadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, config) {
+		t.Fatalf("loaded %+v, expected %+v", loaded, config)
+	}
+}
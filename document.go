@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	simpledb "github.com/triplewy/simpledb-embedded"
+	pb "github.com/triplewy/simpledb/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Documents are MAP, LIST and JSON attributes. Their canonical encoding is
+// compact JSON with sorted object keys and normalized numbers, and MAP and
+// LIST attributes must hold an object and an array. A document is stored as a value of data type
+// documentDataType holding its attribute type followed by its JSON.
+//
+// A path names a value inside a document: the attribute name followed by
+// object keys or list indexes, separated by dots, e.g. address.city or
+// phones.0. Updates set values at paths in the FSM, creating missing objects
+// on the way, and reads can project paths instead of whole attributes.
+
+// documentDataType is the embedded DB data type of documents. Entries written
+// before documents existed only hold the data types of scalar attributes, so
+// none of their values, whatever its bytes, is mistaken for a document.
+const documentDataType = 0x80
+
+// PathValue sets the value at Path inside the document attribute Name
+type PathValue struct {
+	Name string
+	Path []string
+	// Value is canonical JSON
+	Value []byte
+}
+
+func isDocumentType(t pb.Attribute_Type) bool {
+	return t == pb.Attribute_MAP || t == pb.Attribute_LIST || t == pb.Attribute_JSON
+}
+
+// documentType returns the type of a stored document, or false if value is
+// not one
+func documentType(value *simpledb.Value) (pb.Attribute_Type, bool) {
+	if value.DataType != documentDataType || len(value.Data) < 1 {
+		return 0, false
+	}
+	t := pb.Attribute_Type(value.Data[0])
+	return t, isDocumentType(t)
+}
+
+// documentJSON returns the JSON of a stored document
+func documentJSON(value *simpledb.Value) []byte {
+	return value.Data[1:]
+}
+
+// documentValue returns the stored form of a document of type t
+func documentValue(t pb.Attribute_Type, data []byte) *simpledb.Value {
+	return &simpledb.Value{
+		DataType: documentDataType,
+		Data:     append([]byte{byte(t)}, data...),
+	}
+}
+
+// hasDocuments returns true if any of values is a document
+func hasDocuments(values map[string]*simpledb.Value) bool {
+	for _, value := range values {
+		if _, ok := documentType(value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeJSON decodes a single JSON value, keeping numbers as json.Number so
+// that integers beyond the precision of a float64 are not rounded
+func decodeJSON(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("invalid JSON: trailing data")
+	}
+	return v, nil
+}
+
+// encodeJSON returns the canonical encoding of a decoded JSON value
+func encodeJSON(v interface{}) ([]byte, error) {
+	v, err := normalizeNumbers(v)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// normalizeNumbers replaces the numbers in v by their canonical form, so that
+// e.g. 1, 1.0 and 1e0 are encoded alike. Integers that fit in 64 bits are
+// written in decimal and other numbers as the shortest float64 that reads
+// back the same.
+func normalizeNumbers(v interface{}) (interface{}, error) {
+	switch d := v.(type) {
+	case map[string]interface{}:
+		for key, child := range d {
+			child, err := normalizeNumbers(child)
+			if err != nil {
+				return nil, err
+			}
+			d[key] = child
+		}
+	case []interface{}:
+		for i, child := range d {
+			child, err := normalizeNumbers(child)
+			if err != nil {
+				return nil, err
+			}
+			d[i] = child
+		}
+	case json.Number:
+		return normalizeNumber(string(d))
+	}
+	return v, nil
+}
+
+func normalizeNumber(text string) (json.Number, error) {
+	if i, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return json.Number(strconv.FormatInt(i, 10)), nil
+	}
+	if u, err := strconv.ParseUint(text, 10, 64); err == nil {
+		return json.Number(strconv.FormatUint(u, 10)), nil
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid JSON number %v", text)
+	}
+	if f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+		return json.Number(strconv.FormatInt(int64(f), 10)), nil
+	}
+	if f == math.Trunc(f) && f >= 0 && f < math.MaxUint64 {
+		return json.Number(strconv.FormatUint(uint64(f), 10)), nil
+	}
+	return json.Number(strconv.FormatFloat(f, 'g', -1, 64)), nil
+}
+
+// canonicalJSON checks that data is a document of type t and returns its
+// canonical encoding
+func canonicalJSON(t pb.Attribute_Type, data []byte) ([]byte, error) {
+	v, err := decodeJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := v.(map[string]interface{}); t == pb.Attribute_MAP && !ok {
+		return nil, fmt.Errorf("map must be a JSON object")
+	}
+	if _, ok := v.([]interface{}); t == pb.Attribute_LIST && !ok {
+		return nil, fmt.Errorf("list must be a JSON array")
+	}
+	return encodeJSON(v)
+}
+
+// valueToJSON converts a stored value to a decoded JSON value. Bytes have no
+// JSON form.
+func valueToJSON(value *simpledb.Value) (interface{}, error) {
+	t, ok := attributeType(value)
+	if !ok {
+		return nil, fmt.Errorf("invalid DataType: %v", value.DataType)
+	}
+	data := value.Data
+	if isDocumentType(t) {
+		return decodeJSON(documentJSON(value))
+	}
+	if err := checkEncoding(t, data); err != nil {
+		return nil, err
+	}
+	switch t {
+	case pb.Attribute_BOOL:
+		return data[0] == 1, nil
+	case pb.Attribute_INT:
+		return json.Number(strconv.FormatInt(int64(bytesToUint64(data)), 10)), nil
+	case pb.Attribute_UINT:
+		return json.Number(strconv.FormatUint(bytesToUint64(data), 10)), nil
+	case pb.Attribute_FLOAT:
+		f := math.Float64frombits(bytesToUint64(data))
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("%v has no JSON form", f)
+		}
+		return json.Number(strconv.FormatFloat(f, 'g', -1, 64)), nil
+	case pb.Attribute_STRING:
+		return string(data), nil
+	default:
+		return nil, fmt.Errorf("%v has no JSON form", t)
+	}
+}
+
+// parsePath splits a path into the attribute name and the path inside it
+func parsePath(path string) (string, []string) {
+	parts := strings.Split(path, ".")
+	return parts[0], parts[1:]
+}
+
+// getPath returns the value at path inside doc, or false if there is none
+func getPath(doc interface{}, path []string) (interface{}, bool) {
+	for _, part := range path {
+		switch d := doc.(type) {
+		case map[string]interface{}:
+			v, ok := d[part]
+			if !ok {
+				return nil, false
+			}
+			doc = v
+		case []interface{}:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(d) {
+				return nil, false
+			}
+			doc = d[i]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// setPath returns doc with the value at path set to v. Missing objects are
+// created, and a list index may be the length of the list to append.
+func setPath(doc interface{}, path []string, v interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return v, nil
+	}
+	switch d := doc.(type) {
+	case nil:
+		child, err := setPath(nil, path[1:], v)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{path[0]: child}, nil
+	case map[string]interface{}:
+		child, err := setPath(d[path[0]], path[1:], v)
+		if err != nil {
+			return nil, err
+		}
+		d[path[0]] = child
+		return d, nil
+	case []interface{}:
+		i, err := strconv.Atoi(path[0])
+		if err != nil || i < 0 || i > len(d) {
+			return nil, fmt.Errorf("invalid list index %q", path[0])
+		}
+		if i == len(d) {
+			d = append(d, nil)
+		}
+		child, err := setPath(d[i], path[1:], v)
+		if err != nil {
+			return nil, err
+		}
+		d[i] = child
+		return d, nil
+	default:
+		return nil, fmt.Errorf("cannot set %q inside a JSON %T", path[0], doc)
+	}
+}
+
+// applyPaths sets the values of paths in attributes and returns the
+// documents it changed. A missing attribute becomes a MAP.
+func applyPaths(attributes map[string]*simpledb.Value, paths []*PathValue) (map[string]*simpledb.Value, error) {
+	changed := make(map[string]*simpledb.Value)
+	for _, p := range paths {
+		t, doc := pb.Attribute_MAP, interface{}(nil)
+		if value, ok := attributes[p.Name]; ok {
+			var isDocument bool
+			if t, isDocument = documentType(value); !isDocument {
+				return nil, fmt.Errorf("attribute %v is not a document", p.Name)
+			}
+			var err error
+			if doc, err = decodeJSON(documentJSON(value)); err != nil {
+				return nil, fmt.Errorf("attribute %v: %v", p.Name, err)
+			}
+		}
+		v, err := decodeJSON(p.Value)
+		if err != nil {
+			return nil, err
+		}
+		if doc, err = setPath(doc, p.Path, v); err != nil {
+			return nil, fmt.Errorf("attribute %v: %v", p.Name, err)
+		}
+		data, err := encodeJSON(doc)
+		if err != nil {
+			return nil, err
+		}
+		attributes[p.Name] = documentValue(t, data)
+		changed[p.Name] = attributes[p.Name]
+	}
+	return changed, nil
+}
+
+// documentValues converts the attributes of a write, which may only contain
+// documents once the cluster supports them
+func (node *Node) documentValues(attributes []*pb.Attribute) (map[string]*simpledb.Value, error) {
+	values, err := attributesToValues(attributes)
+	if err != nil {
+		return nil, err
+	}
+	if hasDocuments(values) {
+		if err := node.checkVersion("document attributes", featureDocuments); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// pathValues converts the path updates of a client to their replicated form
+func pathValues(attributes []*pb.Attribute) ([]*PathValue, error) {
+	var result []*PathValue
+	for _, attribute := range attributes {
+		name, path := parsePath(attribute.Name)
+		if name == "" || len(path) == 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid path %q: expected attribute.path", attribute.Name)
+		}
+		values, err := attributesToValues([]*pb.Attribute{attribute})
+		if err != nil {
+			return nil, err
+		}
+		v, err := valueToJSON(values[attribute.Name])
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "path %v: %v", attribute.Name, err)
+		}
+		data, err := encodeJSON(v)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, &PathValue{Name: name, Path: path, Value: data})
+	}
+	return result, nil
+}
+
+// projectPaths returns the values at paths inside the attributes of an entry
+// as JSON attributes named by their path. A path without dots returns the
+// whole attribute, and paths without a value are skipped.
+func projectPaths(attributes map[string]*simpledb.Value, paths []string) ([]*pb.Attribute, error) {
+	var result []*pb.Attribute
+	for _, p := range paths {
+		name, path := parsePath(p)
+		value, ok := attributes[name]
+		if !ok {
+			continue
+		}
+		if len(path) == 0 {
+			attribute, err := valuesToAttributes(map[string]*simpledb.Value{p: value})
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, attribute...)
+			continue
+		}
+		if _, isDocument := documentType(value); !isDocument {
+			continue
+		}
+		doc, err := decodeJSON(documentJSON(value))
+		if err != nil {
+			return nil, fmt.Errorf("attribute %v: %v", name, err)
+		}
+		v, ok := getPath(doc, path)
+		if !ok {
+			continue
+		}
+		data, err := encodeJSON(v)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, &pb.Attribute{Name: p, Type: pb.Attribute_JSON, Value: data})
+	}
+	return result, nil
+}
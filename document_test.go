@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	simpledb "github.com/triplewy/simpledb-embedded"
+	pb "github.com/triplewy/simpledb/grpc"
+)
+
+func TestLegacyStringIsNotDocument(t *testing.T) {
+	// Written before documents existed, when strings were not checked to be
+	// UTF-8, and shaped like the string encoding documents once had
+	legacy := []byte("\xff\x06{\"a\":1}")
+	values := map[string]*simpledb.Value{
+		"legacy": {DataType: simpledb.String, Data: legacy},
+		"doc":    documentValue(pb.Attribute_MAP, []byte(`{"a":1}`)),
+	}
+	attributes, err := valuesToAttributes(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, attribute := range attributes {
+		switch attribute.Name {
+		case "legacy":
+			if attribute.Type != pb.Attribute_STRING || !bytes.Equal(attribute.Value, legacy) {
+				t.Errorf("legacy string read as %v %q", attribute.Type, attribute.Value)
+			}
+		case "doc":
+			if attribute.Type != pb.Attribute_MAP || string(attribute.Value) != `{"a":1}` {
+				t.Errorf("document read as %v %q", attribute.Type, attribute.Value)
+			}
+		}
+	}
+	if hasDocuments(map[string]*simpledb.Value{"legacy": values["legacy"]}) {
+		t.Error("legacy string counted as a document")
+	}
+}
+
+func TestCanonicalJSON(t *testing.T) {
+	tests := []struct {
+		t    pb.Attribute_Type
+		data string
+		want string
+	}{
+		{pb.Attribute_MAP, `{ "b": 1, "a": [true, null] }`, `{"a":[true,null],"b":1}`},
+		{pb.Attribute_LIST, `[ "<&>" ]`, `["<&>"]`},
+		{pb.Attribute_JSON, `"x"`, `"x"`},
+		{pb.Attribute_JSON, `[1, 1.0, 1e0, 10E-1, -0, -0.0]`, `[1,1,1,1,0,0]`},
+		{pb.Attribute_JSON, `[1.5, 150e-2, -2.50]`, `[1.5,1.5,-2.5]`},
+		{pb.Attribute_JSON, `[9223372036854775807, 18446744073709551615, -9223372036854775808]`, `[9223372036854775807,18446744073709551615,-9223372036854775808]`},
+		{pb.Attribute_JSON, `[1e19, 1e20, 100000000000000000000]`, `[10000000000000000000,1e+20,1e+20]`},
+		{pb.Attribute_JSON, `{"a": {"b": [2.0]}}`, `{"a":{"b":[2]}}`},
+		// Rejected
+		{pb.Attribute_MAP, `[]`, ""},
+		{pb.Attribute_MAP, `"x"`, ""},
+		{pb.Attribute_LIST, `{}`, ""},
+		{pb.Attribute_JSON, `{"a":1} {"b":2}`, ""},
+		{pb.Attribute_JSON, `1 2`, ""},
+		{pb.Attribute_JSON, `{"a":1`, ""},
+		{pb.Attribute_JSON, ``, ""},
+		{pb.Attribute_JSON, `1e400`, ""},
+	}
+	for _, test := range tests {
+		data, err := canonicalJSON(test.t, []byte(test.data))
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("%v %v: accepted as %s", test.t, test.data, data)
+			}
+			continue
+		}
+		if err != nil || string(data) != test.want {
+			t.Errorf("%v %v: got %s, %v, expected %v", test.t, test.data, data, err, test.want)
+		}
+	}
+}
+
+func TestSetPath(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		path []string
+		v    string
+		want string
+	}{
+		{"missing document", "", []string{"a", "b"}, `1`, `{"a":{"b":1}}`},
+		{"missing objects", `{"x":1}`, []string{"a", "b", "c"}, `true`, `{"a":{"b":{"c":true}},"x":1}`},
+		{"replace", `{"a":{"b":1}}`, []string{"a", "b"}, `[2]`, `{"a":{"b":[2]}}`},
+		{"list element", `{"a":[1,2]}`, []string{"a", "0"}, `3`, `{"a":[3,2]}`},
+		{"append", `{"a":[1,2]}`, []string{"a", "2"}, `3`, `{"a":[1,2,3]}`},
+		{"append object", `{"a":[]}`, []string{"a", "0", "b"}, `1`, `{"a":[{"b":1}]}`},
+		{"whole document", `{"a":1}`, nil, `[]`, `[]`},
+		{"index past end", `{"a":[1]}`, []string{"a", "2"}, `3`, ""},
+		{"negative index", `{"a":[1]}`, []string{"a", "-1"}, `3`, ""},
+		{"key in list", `{"a":[1]}`, []string{"a", "b"}, `3`, ""},
+		{"inside a scalar", `{"a":1}`, []string{"a", "b"}, `3`, ""},
+	}
+	for _, test := range tests {
+		var doc interface{}
+		if test.doc != "" {
+			var err error
+			if doc, err = decodeJSON([]byte(test.doc)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		v, err := decodeJSON([]byte(test.v))
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc, err = setPath(doc, test.path, v)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("%v: set", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", test.name, err)
+			continue
+		}
+		if data, err := encodeJSON(doc); err != nil || string(data) != test.want {
+			t.Errorf("%v: got %s, %v, expected %v", test.name, data, err, test.want)
+		}
+	}
+}
+
+func TestProjectPaths(t *testing.T) {
+	attributes := map[string]*simpledb.Value{
+		"doc":    documentValue(pb.Attribute_MAP, []byte(`{"a":{"b":[1,{"c":"x"}]},"d":true}`)),
+		"list":   documentValue(pb.Attribute_LIST, []byte(`[10,20]`)),
+		"string": {DataType: simpledb.String, Data: []byte("s")},
+	}
+	tests := []struct {
+		paths []string
+		want  string
+	}{
+		{[]string{"doc.a.b.1.c"}, `[doc.a.b.1.c JSON "x"]`},
+		{[]string{"doc.a", "list.1"}, `[doc.a JSON {"b":[1,{"c":"x"}]} list.1 JSON 20]`},
+		{[]string{"doc"}, `[doc MAP {"a":{"b":[1,{"c":"x"}]},"d":true}]`},
+		{[]string{"string"}, `[string STRING s]`},
+		// Paths without a value are skipped
+		{[]string{"missing", "missing.a", "doc.x", "doc.a.b.2", "list.a", "doc.d.e", "string.a"}, `[]`},
+	}
+	for _, test := range tests {
+		result, err := projectPaths(attributes, test.paths)
+		if err != nil {
+			t.Errorf("%v: %v", test.paths, err)
+			continue
+		}
+		got := []string{}
+		for _, attribute := range result {
+			got = append(got, fmt.Sprintf("%v %v %s", attribute.Name, attribute.Type, attribute.Value))
+		}
+		if fmt.Sprint(got) != test.want {
+			t.Errorf("%v: got %v, expected %v", test.paths, got, test.want)
+		}
+	}
+}
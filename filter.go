@@ -0,0 +1,401 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	simpledb "github.com/triplewy/simpledb-embedded"
+	pb "github.com/triplewy/simpledb/grpc"
+)
+
+// Filter expressions select the entries a scan returns, e.g.
+//
+//	status = "active" AND (age > 30 OR NOT admin = false)
+//
+// A comparison takes an attribute name on the left and a string, number or
+// bool literal on the right. It is evaluated against the attribute's type:
+// strings and bytes compare bytewise, numbers numerically and bools with =
+// and != only. Comparisons against a missing attribute or a literal of a
+// different type are false.
+type filter interface {
+	match(attributes map[string]*simpledb.Value) bool
+}
+
+type andFilter struct {
+	left, right filter
+}
+
+func (f *andFilter) match(attributes map[string]*simpledb.Value) bool {
+	return f.left.match(attributes) && f.right.match(attributes)
+}
+
+type orFilter struct {
+	left, right filter
+}
+
+func (f *orFilter) match(attributes map[string]*simpledb.Value) bool {
+	return f.left.match(attributes) || f.right.match(attributes)
+}
+
+type notFilter struct {
+	f filter
+}
+
+func (f *notFilter) match(attributes map[string]*simpledb.Value) bool {
+	return !f.f.match(attributes)
+}
+
+// literal is the right hand side of a comparison. Numbers are of kind FLOAT
+// and keep their text so they can be parsed as the type of the attribute they
+// are compared to.
+type literal struct {
+	kind pb.Attribute_Type
+	text string
+}
+
+type comparison struct {
+	name  string
+	op    string
+	value literal
+}
+
+func (f *comparison) match(attributes map[string]*simpledb.Value) bool {
+	value, ok := attributes[f.name]
+	if !ok {
+		return false
+	}
+	cmp, ok := compareValue(value, f.value)
+	if !ok {
+		return false
+	}
+	switch f.op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	}
+	if value.DataType == simpledb.Bool {
+		return false
+	}
+	switch f.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	default:
+		return cmp >= 0
+	}
+}
+
+// compareValue returns -1, 0 or 1 as value is less than, equal to or greater
+// than lit, or false if they cannot be compared
+func compareValue(value *simpledb.Value, lit literal) (int, bool) {
+	if _, ok := documentType(value); ok {
+		return 0, false
+	}
+	data := value.Data
+	switch value.DataType {
+	case simpledb.String, simpledb.Bytes:
+		if lit.kind != pb.Attribute_STRING {
+			return 0, false
+		}
+		return strings.Compare(string(data), lit.text), true
+	case simpledb.Bool:
+		if lit.kind != pb.Attribute_BOOL || len(data) != 1 {
+			return 0, false
+		}
+		b := data[0] != 0
+		if b == (lit.text == "true") {
+			return 0, true
+		}
+		return 1, true
+	case simpledb.Int, simpledb.Uint, simpledb.Float:
+		if lit.kind != pb.Attribute_FLOAT || len(data) != 8 {
+			return 0, false
+		}
+		u := bytesToUint64(data)
+		switch value.DataType {
+		case simpledb.Int:
+			if i, err := strconv.ParseInt(lit.text, 10, 64); err == nil {
+				return compareInt64(int64(u), i), true
+			}
+			return compareFloat(float64(int64(u)), lit.text)
+		case simpledb.Uint:
+			if i, err := strconv.ParseUint(lit.text, 10, 64); err == nil {
+				return compareUint64(u, i), true
+			}
+			return compareFloat(float64(u), lit.text)
+		default:
+			return compareFloat(math.Float64frombits(u), lit.text)
+		}
+	}
+	return 0, false
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareUint64(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareFloat(a float64, text string) (int, bool) {
+	b, err := strconv.ParseFloat(text, 64)
+	if err != nil || math.IsNaN(a) || math.IsNaN(b) {
+		return 0, false
+	}
+	switch {
+	case a < b:
+		return -1, true
+	case a > b:
+		return 1, true
+	}
+	return 0, true
+}
+
+const (
+	// maxFilterLength bounds the size of a filter expression in bytes
+	maxFilterLength = 4096
+	// maxFilterDepth bounds how deeply NOT and parentheses may nest
+	maxFilterDepth = 64
+)
+
+// parseFilter parses a filter expression. The grammar, with AND binding
+// tighter than OR and keywords matched case insensitively, is
+//
+//	expr       = and { "OR" and }
+//	and        = unary { "AND" unary }
+//	unary      = "NOT" unary | "(" expr ")" | comparison
+//	comparison = name ( "=" | "!=" | "<" | "<=" | ">" | ">=" ) literal
+//	literal    = string | number | "true" | "false"
+//
+// Strings are double quoted with Go escapes.
+func parseFilter(expr string) (filter, error) {
+	tokens, err := tokenizeFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q at end of filter", p.tokens[p.pos].text)
+	}
+	return f, nil
+}
+
+type tokenKind int
+
+const (
+	identToken tokenKind = iota
+	stringToken
+	numberToken
+	opToken
+	parenToken
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func tokenizeFilter(expr string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, token{parenToken, string(c)})
+			i++
+		case c == '"':
+			j := i + 1
+			for ; j < len(expr) && expr[j] != '"'; j++ {
+				if expr[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(expr) {
+				return nil, fmt.Errorf("unterminated string at offset %d", i)
+			}
+			s, err := strconv.Unquote(expr[i : j+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at offset %d: %v", i, err)
+			}
+			tokens = append(tokens, token{stringToken, s})
+			i = j + 1
+		case strings.IndexByte("=!<>", c) >= 0:
+			j := i + 1
+			if j < len(expr) && expr[j] == '=' {
+				j++
+			}
+			op := expr[i:j]
+			if op == "!" || op == "==" {
+				return nil, fmt.Errorf("invalid operator %q at offset %d", op, i)
+			}
+			tokens = append(tokens, token{opToken, op})
+			i = j
+		case c == '-' || c == '+' || c == '.' || isDigit(c):
+			j := i + 1
+			for j < len(expr) && (isDigit(expr[j]) || strings.IndexByte(".eE", expr[j]) >= 0 ||
+				(strings.IndexByte("+-", expr[j]) >= 0 && strings.IndexByte("eE", expr[j-1]) >= 0)) {
+				j++
+			}
+			if _, err := strconv.ParseFloat(expr[i:j], 64); err != nil {
+				return nil, fmt.Errorf("invalid number %q at offset %d", expr[i:j], i)
+			}
+			tokens = append(tokens, token{numberToken, strings.TrimPrefix(expr[i:j], "+")})
+			i = j
+		case c == '_' || unicode.IsLetter(rune(c)):
+			j := i + 1
+			for j < len(expr) && (expr[j] == '_' || expr[j] == '.' || expr[j] == '-' || isDigit(expr[j]) || unicode.IsLetter(rune(expr[j]))) {
+				j++
+			}
+			tokens = append(tokens, token{identToken, expr[i:j]})
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected character %q at offset %d", c, i)
+		}
+	}
+	return tokens, nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+type filterParser struct {
+	tokens []token
+	pos    int
+	// depth is the nesting of the unary being parsed
+	depth int
+}
+
+func (p *filterParser) peek() *token {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+// keyword consumes the next token if it is the keyword kw
+func (p *filterParser) keyword(kw string) bool {
+	if t := p.peek(); t != nil && t.kind == identToken && strings.EqualFold(t.text, kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) parseOr() (filter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orFilter{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filter, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("AND") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &andFilter{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (filter, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > maxFilterDepth {
+		return nil, fmt.Errorf("filter nests NOT and parentheses more than %d deep", maxFilterDepth)
+	}
+	if p.keyword("NOT") {
+		f, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notFilter{f}, nil
+	}
+	t := p.peek()
+	if t == nil {
+		return nil, fmt.Errorf("unexpected end of filter")
+	}
+	if t.kind == parenToken && t.text == "(" {
+		p.pos++
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.peek(); t == nil || t.text != ")" || t.kind != parenToken {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		p.pos++
+		return f, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (filter, error) {
+	name := p.peek()
+	if name.kind != identToken {
+		return nil, fmt.Errorf("expected attribute name, got %q", name.text)
+	}
+	p.pos++
+	op := p.peek()
+	if op == nil || op.kind != opToken {
+		return nil, fmt.Errorf("expected comparison operator after %q", name.text)
+	}
+	p.pos++
+	t := p.peek()
+	if t == nil {
+		return nil, fmt.Errorf("expected value after %q %v", name.text, op.text)
+	}
+	p.pos++
+	var value literal
+	switch {
+	case t.kind == stringToken:
+		value = literal{pb.Attribute_STRING, t.text}
+	case t.kind == numberToken:
+		value = literal{pb.Attribute_FLOAT, t.text}
+	case t.kind == identToken && (strings.EqualFold(t.text, "true") || strings.EqualFold(t.text, "false")):
+		value = literal{pb.Attribute_BOOL, strings.ToLower(t.text)}
+	default:
+		return nil, fmt.Errorf("expected string, number or bool after %q %v, got %q", name.text, op.text, t.text)
+	}
+	return &comparison{name: name.text, op: op.text, value: value}, nil
+}
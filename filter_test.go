@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+
+	simpledb "github.com/triplewy/simpledb-embedded"
+	pb "github.com/triplewy/simpledb/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestParseFilterDepth(t *testing.T) {
+	nested := func(depth int) string {
+		return strings.Repeat("NOT (", depth) + "age > 1" + strings.Repeat(")", depth)
+	}
+	// Each NOT ( nests two levels and the comparison one more
+	if _, err := parseFilter(nested((maxFilterDepth - 1) / 2)); err != nil {
+		t.Fatalf("filter within depth limit: %v", err)
+	}
+	if _, err := parseFilter(nested(maxFilterDepth)); err == nil {
+		t.Fatal("filter beyond depth limit parsed")
+	}
+}
+
+func TestScanFilterLength(t *testing.T) {
+	node := &Node{}
+	filter := "a = \"" + strings.Repeat("x", maxFilterLength) + "\""
+	_, err := node.ScanRPC(context.Background(), &pb.ScanMsg{Filter: filter})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("scan with a filter of %d bytes: %v", len(filter), err)
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"age",
+		"age >",
+		"age == 1",
+		"age ! 1",
+		"age > abc",
+		"1 > age",
+		"(age > 1",
+		"age > 1)",
+		"age > 1 AND",
+		"NOT",
+		`name = "unterminated`,
+		`name = "bad \q escape"`,
+		"age > 1.2.3",
+		"age > 1 # 2",
+	} {
+		if _, err := parseFilter(expr); err == nil {
+			t.Errorf("parsed %q", expr)
+		}
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	attributes := map[string]*simpledb.Value{
+		"int":    intValue(-5),
+		"uint":   {DataType: simpledb.Uint, Data: uint64ToBytes(math.MaxUint64)},
+		"float":  floatValue(2.5),
+		"bool":   {DataType: simpledb.Bool, Data: []byte{1}},
+		"string": {DataType: simpledb.String, Data: []byte("b")},
+		"bytes":  {DataType: simpledb.Bytes, Data: []byte{0xff}},
+	}
+	tests := []struct {
+		expr  string
+		match bool
+	}{
+		// INT
+		{"int = -5", true},
+		{"int < -4", true},
+		{"int >= -5", true},
+		{"int > -5", false},
+		{"int < -4.5", true},
+		{"int != 5", true},
+		// UINT beyond the range of INT and exact float
+		{"uint = 18446744073709551615", true},
+		{"uint > 18446744073709551614", true},
+		{"uint > -1", true},
+		{"uint <= 1e10", false},
+		// FLOAT
+		{"float = 2.5", true},
+		{"float > 2", true},
+		{"float <= 25e-1", true},
+		{"float < 2.5", false},
+		// BOOL compares with = and != only
+		{"bool = true", true},
+		{"bool = TRUE", true},
+		{"bool != false", true},
+		{"bool = false", false},
+		{"bool > false", false},
+		// STRING and BYTES compare bytewise
+		{`string = "b"`, true},
+		{`string > "a"`, true},
+		{`string < "ba"`, true},
+		{`string >= "c"`, false},
+		{`bytes = "\xff"`, true},
+		{`bytes > "\xfe"`, true},
+		// Missing attributes never match
+		{"missing = 1", false},
+		{"missing != 1", false},
+		{"NOT missing = 1", true},
+		// Type mismatches never match
+		{`int = "-5"`, false},
+		{"int != true", false},
+		{"string != 1", false},
+		{`bool = "true"`, false},
+		{"float = false", false},
+		// AND binds tighter than OR, and NOT tighter than both
+		{"bool = false AND int = 1 OR float = 2.5", true},
+		{"float = 2.5 OR bool = false AND int = 1", true},
+		{"(float = 2.5 OR bool = false) AND int = 1", false},
+		{"NOT bool = true AND int = -5", false},
+		{"NOT (bool = true AND int = 1)", true},
+		{"NOT NOT bool = true", true},
+		{"bool = true and not int = 1 or string = \"x\"", true},
+	}
+	for _, test := range tests {
+		f, err := parseFilter(test.expr)
+		if err != nil {
+			t.Errorf("%v: %v", test.expr, err)
+			continue
+		}
+		if f.match(attributes) != test.match {
+			t.Errorf("%v: expected match %v", test.expr, test.match)
+		}
+	}
+}
@@ -1,29 +1,83 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	stdlog "log"
+	"strings"
+	"time"
 
 	"github.com/hashicorp/raft"
 	simpledb "github.com/triplewy/simpledb-embedded"
 )
 
-// Types of Ops
+// Types of Ops. Each has a handler in opHandlers.
 const (
 	Insert uint8 = iota
 	Update
 	Delete
+	// Announce records the raft and rpc addresses of a new leader
+	Announce
+	// Register records the rpc address and feature version of a server
+	Register
+	// DeleteRange deletes the entries between Key and EndKey
+	DeleteRange
+	// DeletePrefix deletes the entries whose key starts with Key
+	DeletePrefix
+	// CreateIndex defines a secondary index on the attribute in Key
+	CreateIndex
+	// DropIndex removes the index on the attribute in Key
+	DropIndex
+	// BackfillIndex indexes existing entries up to EndKey
+	BackfillIndex
+	// CreateTable creates the table named Key
+	CreateTable
+	// DropTable drops the table named Key
+	DropTable
+	// PurgeTable deletes the keys of a dropped table between Key and EndKey
+	PurgeTable
+	// SetSchema sets the schema of the keys starting with Key
+	SetSchema
+	// DropSchema removes the schema of the keys starting with Key
+	DropSchema
+	// UpdatePaths is an Update that also sets values inside documents
+	UpdatePaths
+	// ExpireSessions discards the sessions of clients that have not written
+	// for a while, as of the leader's clock in Values
+	ExpireSessions
 )
 
-// Command is placed in logs for snapshot purposes
+// Command is placed in logs for snapshot purposes. Commands with a ClientID
+// are applied at most once per Sequence.
 type Command struct {
 	Op     uint8
 	Key    string
 	Values map[string]*simpledb.Value
+	// EndKey bounds range ops
+	EndKey string
+	// Table is the ID of the table Key belongs to, which Key and EndKey are
+	// already prefixed with
+	Table uint64
+	// Paths are set after Values by UpdatePaths
+	Paths []*PathValue
+
+	ClientID        string
+	Sequence        uint64
+	FirstIncomplete uint64
 }
 
+// appliedKey holds the index of the last log entry applied to the DB. Raft
+// replays its log to the FSM on restart, and the DB already holds the effect
+// of the entries up to it.
+const appliedKey = internalPrefix + "meta/applied"
+
+const indexAttribute = "index"
+
 type fsmResponse struct {
 	err error
+	// count is the op specific count returned by its handler
+	count uint64
 }
 
 // Apply log is invoked once a log entry is committed.
@@ -31,48 +85,163 @@ type fsmResponse struct {
 // ApplyFuture returned by Raft.Apply method if that
 // method was called on the same Raft node as the FSM.
 func (store *store) Apply(log *raft.Log) interface{} {
-	var c Command
-	err := decodeMsgPack(log.Data, &c)
+	defer observeSince(fsmApplyDuration, time.Now())
+	if log.Index <= store.applied {
+		// Replayed on restart; the DB already holds its effect
+		return &fsmResponse{}
+	}
+	c, err := decodeCommand(log.Data)
 	if err != nil {
-		panic(fmt.Sprintf("failed to decode command: %v", err))
+		// Applying later entries without this one would diverge from the
+		// other servers, so the node stops until it is upgraded or repaired
+		stdlog.Fatalf("fsm: cannot apply log entry %d: %v", log.Index, err)
 	}
-	switch c.Op {
-	case Insert:
-		txn := store.db.StartTxn()
-		exists, err := txn.Exists(c.Key)
-		if err != nil {
+	return store.execute(c, log.Index)
+}
+
+// execute applies c, the log entry at index, to the db in a single
+// transaction that also records index as applied. If c belongs to a client
+// session, its result is recorded in the same transaction and a command that
+// was applied before returns the recorded result instead.
+func (store *store) execute(c *Command, index uint64) *fsmResponse {
+	txn := store.db.StartTxn()
+	resp, err := store.executeSession(txn, c)
+	if err != nil {
+		return &fsmResponse{err: err}
+	}
+	// A failed op has not written anything, so only its result, if any, and
+	// the applied index are committed
+	if index > 0 {
+		txn.Write(appliedKey, map[string]*simpledb.Value{
+			indexAttribute: {DataType: simpledb.Uint, Data: uint64ToBytes(index)},
+		})
+	}
+	if err := txn.Commit(); err != nil {
+		return &fsmResponse{err: err}
+	}
+	if index > 0 {
+		store.applied = index
+	}
+	return resp
+}
+
+// executeSession applies c within txn, once per sequence if it belongs to a
+// client session
+func (store *store) executeSession(txn *simpledb.Txn, c *Command) (*fsmResponse, error) {
+	if c.ClientID == "" {
+		return executeOp(txn, c), nil
+	}
+	s, err := readSession(txn, c.ClientID)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.result(txn, c.Sequence)
+	if err != nil || resp != nil {
+		return resp, err
+	}
+	resp = executeOp(txn, c)
+	if err := s.record(txn, c, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// readApplied returns the index of the last log entry applied to the DB
+func readApplied(txn *simpledb.Txn) (uint64, error) {
+	entry, err := txn.Read(appliedKey)
+	if err != nil {
+		if _, ok := err.(*simpledb.ErrKeyNotFound); ok {
+			return 0, nil
+		}
+		return 0, err
+	}
+	value, ok := entry.Attributes[indexAttribute]
+	if !ok || len(value.Data) != 8 {
+		return 0, fmt.Errorf("invalid applied index: %v", entry.Attributes)
+	}
+	return bytesToUint64(value.Data), nil
+}
+
+func executeOp(txn *simpledb.Txn, c *Command) *fsmResponse {
+	handler, ok := opHandlers[c.Op]
+	if !ok {
+		// Like a command that cannot be decoded, skipping it would diverge
+		// from the servers that know the op
+		stdlog.Fatalf("fsm: unknown command op %d", c.Op)
+	}
+	if !handler.dropped {
+		if err := checkTable(txn, tableID(c.Table)); err != nil {
 			return &fsmResponse{err: err}
 		}
-		if exists {
-			return &fsmResponse{err: fmt.Errorf("key: %v already exists", c.Key)}
+	}
+	count, err := handler.apply(txn, c)
+	return &fsmResponse{err: err, count: count}
+}
+
+// A snapshot is a stream of the FSM's entries, which is every key of the DB
+// except raft's own. It starts with snapshotMagic, followed by each entry as
+// its msgpack encoding prefixed with its size. Snapshots of earlier versions
+// are a stream of raft logs in the same framing, without the magic.
+const snapshotMagic = "simpledb"
+
+// restoreBatchSize is the number of keys written or deleted by one
+// transaction during a restore
+const restoreBatchSize = 1000
+
+// legacyStableKeys are the keys raft's stable store used before stablePrefix
+var legacyStableKeys = map[string]bool{"CurrentTerm": true, "LastVoteTerm": true, "LastVoteCand": true}
+
+// isRaftKey returns true if key belongs to raft's log or stable store rather
+// than to the FSM
+func isRaftKey(key string) bool {
+	return strings.HasPrefix(key, raftPrefix) || legacyStableKeys[key]
+}
+
+// fsmRanges returns the key ranges holding the FSM's entries, one for each
+// first byte of a key so that no range is scanned whole, leaving out raft's
+// keys
+func fsmRanges() [][2]string {
+	ranges := [][2]string{{internalPrefix, raftPrefix}, {prefixEnd(raftPrefix), prefixEnd(internalPrefix)}}
+	for b := 1; b < 256; b++ {
+		start := string([]byte{byte(b)})
+		ranges = append(ranges, [2]string{start, prefixEnd(start)})
+	}
+	return ranges
+}
+
+// scanFSM calls fn with the entries of the FSM in key order, a range of
+// fsmRanges at a time
+func scanFSM(txn *simpledb.Txn, fn func(entries []*simpledb.Entry) error) error {
+	// The empty key sorts before every range
+	entry, err := txn.Read("")
+	if err == nil {
+		if err := fn([]*simpledb.Entry{entry}); err != nil {
+			return err
 		}
-		txn.Write(c.Key, c.Values)
-		err = txn.Commit()
-		return &fsmResponse{err: err}
-	case Update:
-		txn := store.db.StartTxn()
-		entry, err := txn.Read(c.Key)
+	} else if _, ok := err.(*simpledb.ErrKeyNotFound); !ok {
+		return err
+	}
+	for _, r := range fsmRanges() {
+		entries, err := txn.Scan(r[0], r[1])
 		if err != nil {
-			return &fsmResponse{err: err}
+			return err
 		}
-		for name, value := range c.Values {
-			entry.Attributes[name] = value
+		batch := entries[:0]
+		for _, entry := range entries {
+			if entry.Key >= r[0] && entry.Key < r[1] && !isRaftKey(entry.Key) {
+				batch = append(batch, entry)
+			}
+		}
+		if err := fn(batch); err != nil {
+			return err
 		}
-		txn.Write(c.Key, entry.Attributes)
-		err = txn.Commit()
-		return &fsmResponse{err: err}
-	case Delete:
-		txn := store.db.StartTxn()
-		txn.Delete(c.Key)
-		err := txn.Commit()
-		return &fsmResponse{err: err}
-	default:
-		return &fsmResponse{err: fmt.Errorf("unknown command: %v", c.Op)}
 	}
+	return nil
 }
 
 type fsmSnapshot struct {
-	logs []*raft.Log
+	// txn reads the DB as of the snapshot, while Apply goes on writing
+	txn *simpledb.Txn
 }
 
 // Snapshot is used to support log compaction. This call should
@@ -82,91 +251,141 @@ type fsmSnapshot struct {
 // the FSM should be implemented in a fashion that allows for concurrent
 // updates while a snapshot is happening.
 func (store *store) Snapshot() (raft.FSMSnapshot, error) {
-	logs, err := store.RangeLogs()
-	return &fsmSnapshot{logs: logs}, err
+	defer observeSince(snapshotDuration.WithLabelValues("snapshot"), time.Now())
+	return &fsmSnapshot{txn: store.db.StartTxn()}, nil
 }
 
 // Restore is used to restore an FSM from a snapshot. It is not called
 // concurrently with any other command. The FSM must discard all previous
 // state.
 func (store *store) Restore(rc io.ReadCloser) error {
+	defer observeSince(snapshotDuration.WithLabelValues("restore"), time.Now())
+	if err := store.clear(); err != nil {
+		return err
+	}
+	store.applied = 0
+	header := make([]byte, len(snapshotMagic))
+	if _, err := io.ReadFull(rc, header); err == io.EOF {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if string(header) != snapshotMagic {
+		// The header is the size of the first log of a legacy snapshot
+		return store.restoreLogs(io.MultiReader(bytes.NewReader(header), rc))
+	}
+	if err := store.restoreEntries(rc); err != nil {
+		return err
+	}
 	var err error
-	sizeBuf := make([]byte, 8)
-	_, err = rc.Read(sizeBuf)
-	for err == nil {
-		size := bytesToUint64(sizeBuf)
-		buf := make([]byte, size)
-		_, err := rc.Read(buf)
-		if err != nil {
+	store.applied, err = readApplied(store.db.StartTxn())
+	return err
+}
+
+// restoreEntries writes the entries of a snapshot
+func (store *store) restoreEntries(rc io.Reader) error {
+	txn := store.db.StartTxn()
+	n := 0
+	err := readSnapshotRecords(rc, func(buf []byte) error {
+		var entry simpledb.Entry
+		if err := decodeMsgPack(buf, &entry); err != nil {
 			return err
 		}
+		txn.Write(entry.Key, entry.Attributes)
+		if n++; n%restoreBatchSize == 0 {
+			if err := txn.Commit(); err != nil {
+				return err
+			}
+			txn = store.db.StartTxn()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return txn.Commit()
+}
+
+// clear deletes every entry of the FSM
+func (store *store) clear() error {
+	return scanFSM(store.db.StartTxn(), func(entries []*simpledb.Entry) error {
+		txn := store.db.StartTxn()
+		for i, entry := range entries {
+			txn.Delete(entry.Key)
+			if (i+1)%restoreBatchSize == 0 {
+				if err := txn.Commit(); err != nil {
+					return err
+				}
+				txn = store.db.StartTxn()
+			}
+		}
+		return txn.Commit()
+	})
+}
+
+// restoreLogs replays the commands of a legacy snapshot
+func (store *store) restoreLogs(r io.Reader) error {
+	return readSnapshotRecords(r, func(buf []byte) error {
 		var log raft.Log
-		err = decodeMsgPack(buf, &log)
-		if err != nil {
+		if err := decodeMsgPack(buf, &log); err != nil {
 			return err
 		}
-		var c Command
-		err = decodeMsgPack(log.Data, &c)
+		if log.Type != raft.LogCommand {
+			return nil
+		}
+		c, err := decodeCommand(log.Data)
 		if err != nil {
 			return err
 		}
-		switch c.Op {
-		case Insert:
-			txn := store.db.StartTxn()
-			exists, err := txn.Exists(c.Key)
-			if err != nil {
-				return err
-			}
-			if exists {
-				return fmt.Errorf("key: %v already exists", c.Key)
-			}
-			txn.Write(c.Key, c.Values)
-			err = txn.Commit()
-			if err != nil {
-				return err
-			}
-		case Update:
-			txn := store.db.StartTxn()
-			entry, err := txn.Read(c.Key)
-			if err != nil {
-				return err
-			}
-			for name, value := range c.Values {
-				entry.Attributes[name] = value
-			}
-			txn.Write(c.Key, entry.Attributes)
-			err = txn.Commit()
-			if err != nil {
-				return err
-			}
-		case Delete:
-			txn := store.db.StartTxn()
-			txn.Delete(c.Key)
-			err := txn.Commit()
-			if err != nil {
-				return err
-			}
-		default:
-			return fmt.Errorf("unknown command: %v", c.Op)
+		// Errors are results of commands, e.g. inserting an existing key,
+		// which were returned when the command was first applied
+		store.execute(c, log.Index)
+		return nil
+	})
+}
+
+// readSnapshotRecords calls fn with each size prefixed record of r
+func readSnapshotRecords(r io.Reader, fn func(buf []byte) error) error {
+	sizeBuf := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, sizeBuf); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		buf := make([]byte, bytesToUint64(sizeBuf))
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return err
+		}
+		if err := fn(buf); err != nil {
+			return err
 		}
-		_, err = rc.Read(sizeBuf)
 	}
-	return nil
 }
 
 // Persist should dump all necessary state to the InsertCloser 'sink',
 // and call sink.Close() when finished or call sink.Cancel() on error.
 func (f *fsmSnapshot) Persist(sink raft.SnapshotSink) error {
+	defer observeSince(snapshotDuration.WithLabelValues("persist"), time.Now())
 	err := func() error {
-		for _, log := range f.logs {
-			buf, err := encodeMsgPack(log)
-			if err != nil {
-				return err
-			}
-			size := uint64ToBytes(uint64(len(buf.Bytes())))
-			if _, err := sink.Write(append(size, buf.Bytes()...)); err != nil {
-				return err
+		if _, err := io.WriteString(sink, snapshotMagic); err != nil {
+			return err
+		}
+		err := scanFSM(f.txn, func(entries []*simpledb.Entry) error {
+			for _, entry := range entries {
+				buf, err := encodeMsgPack(entry)
+				if err != nil {
+					return err
+				}
+				size := uint64ToBytes(uint64(buf.Len()))
+				if _, err := sink.Write(append(size, buf.Bytes()...)); err != nil {
+					return err
+				}
 			}
+			return nil
+		})
+		if err != nil {
+			return err
 		}
 		return sink.Close()
 	}()
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	simpledb "github.com/triplewy/simpledb-embedded"
+)
+
+// memorySink is a raft.SnapshotSink that keeps the snapshot in memory
+type memorySink struct {
+	bytes.Buffer
+}
+
+func (s *memorySink) ID() string    { return "memory" }
+func (s *memorySink) Close() error  { return nil }
+func (s *memorySink) Cancel() error { return nil }
+
+// snapshotStore persists a snapshot of s to memory
+func snapshotStore(t *testing.T, s *store) *memorySink {
+	snapshot, err := s.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := new(memorySink)
+	if err := snapshot.Persist(sink); err != nil {
+		t.Fatal(err)
+	}
+	snapshot.Release()
+	return sink
+}
+
+func TestFSMSnapshotRestore(t *testing.T) {
+	source := newTestStore(t)
+	for _, c := range []*Command{
+		{Op: CreateTable, Key: "users"},
+		{Op: Insert, Key: "a", Values: map[string]*simpledb.Value{"v": {DataType: simpledb.String, Data: []byte("a")}}, ClientID: "c1", Sequence: 1, FirstIncomplete: 1},
+	} {
+		if resp := source.execute(c, 0); resp.err != nil {
+			t.Fatal(resp.err)
+		}
+	}
+	if err := source.SetUint64([]byte("CurrentTerm"), 5); err != nil {
+		t.Fatal(err)
+	}
+	sink := snapshotStore(t, source)
+
+	target := newTestStore(t)
+	if resp := target.execute(&Command{Op: Insert, Key: "stale"}, 0); resp.err != nil {
+		t.Fatal(resp.err)
+	}
+	if err := target.SetUint64([]byte("CurrentTerm"), 7); err != nil {
+		t.Fatal(err)
+	}
+	if err := target.Restore(ioutil.NopCloser(&sink.Buffer)); err != nil {
+		t.Fatal(err)
+	}
+
+	txn := target.db.StartTxn()
+	for key, want := range map[string]bool{"a": true, "stale": false, sessionKey("c1"): true} {
+		if exists, err := txn.Exists(key); err != nil || exists != want {
+			t.Errorf("%q exists: %v, %v", key, exists, err)
+		}
+	}
+	if id, exists, err := readTable(txn, "users"); err != nil || !exists || id != 1 {
+		t.Errorf("table users: %v, %v, %v", id, exists, err)
+	}
+	// Raft's own state is not part of the snapshot
+	if term, err := target.GetUint64([]byte("CurrentTerm")); err != nil || term != 7 {
+		t.Errorf("current term %v, %v", term, err)
+	}
+}
@@ -34,6 +34,11 @@ const (
 	Attribute_FLOAT  Attribute_Type = 3
 	Attribute_STRING Attribute_Type = 4
 	Attribute_BYTES  Attribute_Type = 5
+	// MAP, LIST and JSON are documents encoded as JSON. MAP must be an
+	// object and LIST an array.
+	Attribute_MAP  Attribute_Type = 6
+	Attribute_LIST Attribute_Type = 7
+	Attribute_JSON Attribute_Type = 8
 )
 
 var Attribute_Type_name = map[int32]string{
@@ -43,6 +48,9 @@ var Attribute_Type_name = map[int32]string{
 	3: "FLOAT",
 	4: "STRING",
 	5: "BYTES",
+	6: "MAP",
+	7: "LIST",
+	8: "JSON",
 }
 
 var Attribute_Type_value = map[string]int32{
@@ -52,6 +60,9 @@ var Attribute_Type_value = map[string]int32{
 	"FLOAT":  3,
 	"STRING": 4,
 	"BYTES":  5,
+	"MAP":    6,
+	"LIST":   7,
+	"JSON":   8,
 }
 
 func (x Attribute_Type) String() string {
@@ -59,12 +70,105 @@ func (x Attribute_Type) String() string {
 }
 
 func (Attribute_Type) EnumDescriptor() ([]byte, []int) {
-	return fileDescriptor_748391160b9263c4, []int{3, 0}
+	return fileDescriptor_748391160b9263c4, []int{5, 0}
+}
+
+type ServerStatus_Suffrage int32
+
+const (
+	ServerStatus_VOTER    ServerStatus_Suffrage = 0
+	ServerStatus_NONVOTER ServerStatus_Suffrage = 1
+	ServerStatus_STAGING  ServerStatus_Suffrage = 2
+)
+
+var ServerStatus_Suffrage_name = map[int32]string{
+	0: "VOTER",
+	1: "NONVOTER",
+	2: "STAGING",
+}
+
+var ServerStatus_Suffrage_value = map[string]int32{
+	"VOTER":    0,
+	"NONVOTER": 1,
+	"STAGING":  2,
+}
+
+func (x ServerStatus_Suffrage) String() string {
+	return proto.EnumName(ServerStatus_Suffrage_name, int32(x))
+}
+
+func (ServerStatus_Suffrage) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_748391160b9263c4, []int{15, 0}
+}
+
+// Staleness bounds how far behind the leader a follower may be to serve a
+// read locally. Zero fields are unbounded. Reads that exceed a bound are
+// forwarded to the leader.
+type Staleness struct {
+	// maxLagMs bounds the milliseconds since the follower last heard from the leader
+	MaxLagMs int64 `protobuf:"varint,1,opt,name=maxLagMs,proto3" json:"maxLagMs,omitempty"`
+	// maxLagEntries bounds the log entries committed by the leader that the
+	// follower has not applied. Followers that have not heard the leader's
+	// commit index recently forward the read.
+	MaxLagEntries        uint64   `protobuf:"varint,2,opt,name=maxLagEntries,proto3" json:"maxLagEntries,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Staleness) Reset()         { *m = Staleness{} }
+func (m *Staleness) String() string { return proto.CompactTextString(m) }
+func (*Staleness) ProtoMessage()    {}
+func (*Staleness) Descriptor() ([]byte, []int) {
+	return fileDescriptor_748391160b9263c4, []int{0}
+}
+
+func (m *Staleness) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Staleness.Unmarshal(m, b)
+}
+func (m *Staleness) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Staleness.Marshal(b, m, deterministic)
+}
+func (m *Staleness) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Staleness.Merge(m, src)
+}
+func (m *Staleness) XXX_Size() int {
+	return xxx_messageInfo_Staleness.Size(m)
+}
+func (m *Staleness) XXX_DiscardUnknown() {
+	xxx_messageInfo_Staleness.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Staleness proto.InternalMessageInfo
+
+func (m *Staleness) GetMaxLagMs() int64 {
+	if m != nil {
+		return m.MaxLagMs
+	}
+	return 0
+}
+
+func (m *Staleness) GetMaxLagEntries() uint64 {
+	if m != nil {
+		return m.MaxLagEntries
+	}
+	return 0
 }
 
 type ReadMsg struct {
-	Key                  string   `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
-	Attributes           []string `protobuf:"bytes,2,rep,name=attributes,proto3" json:"attributes,omitempty"`
+	Key        string   `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Attributes []string `protobuf:"bytes,2,rep,name=attributes,proto3" json:"attributes,omitempty"`
+	// maxStaleness is unset to read from the node receiving the request
+	MaxStaleness *Staleness `protobuf:"bytes,3,opt,name=maxStaleness,proto3" json:"maxStaleness,omitempty"`
+	// table is empty for the default table
+	Table string `protobuf:"bytes,4,opt,name=table,proto3" json:"table,omitempty"`
+	// paths project values inside document attributes, e.g. address.city.
+	// They are returned as JSON attributes named by their path.
+	Paths []string `protobuf:"bytes,5,rep,name=paths,proto3" json:"paths,omitempty"`
+	// linearizable reads are only served by the leader once it has confirmed
+	// its leadership and applied every committed write. Ignored if
+	// maxStaleness is set.
+	Linearizable         bool     `protobuf:"varint,6,opt,name=linearizable,proto3" json:"linearizable,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -74,7 +178,7 @@ func (m *ReadMsg) Reset()         { *m = ReadMsg{} }
 func (m *ReadMsg) String() string { return proto.CompactTextString(m) }
 func (*ReadMsg) ProtoMessage()    {}
 func (*ReadMsg) Descriptor() ([]byte, []int) {
-	return fileDescriptor_748391160b9263c4, []int{0}
+	return fileDescriptor_748391160b9263c4, []int{1}
 }
 
 func (m *ReadMsg) XXX_Unmarshal(b []byte) error {
@@ -109,10 +213,51 @@ func (m *ReadMsg) GetAttributes() []string {
 	return nil
 }
 
+func (m *ReadMsg) GetMaxStaleness() *Staleness {
+	if m != nil {
+		return m.MaxStaleness
+	}
+	return nil
+}
+
+func (m *ReadMsg) GetTable() string {
+	if m != nil {
+		return m.Table
+	}
+	return ""
+}
+
+func (m *ReadMsg) GetPaths() []string {
+	if m != nil {
+		return m.Paths
+	}
+	return nil
+}
+
+func (m *ReadMsg) GetLinearizable() bool {
+	if m != nil {
+		return m.Linearizable
+	}
+	return false
+}
+
 type ScanMsg struct {
-	StartKey             string   `protobuf:"bytes,1,opt,name=startKey,proto3" json:"startKey,omitempty"`
-	EndKey               string   `protobuf:"bytes,2,opt,name=endKey,proto3" json:"endKey,omitempty"`
-	Attributes           []string `protobuf:"bytes,3,rep,name=attributes,proto3" json:"attributes,omitempty"`
+	StartKey   string   `protobuf:"bytes,1,opt,name=startKey,proto3" json:"startKey,omitempty"`
+	EndKey     string   `protobuf:"bytes,2,opt,name=endKey,proto3" json:"endKey,omitempty"`
+	Attributes []string `protobuf:"bytes,3,rep,name=attributes,proto3" json:"attributes,omitempty"`
+	// maxStaleness is unset to scan the node receiving the request
+	MaxStaleness *Staleness `protobuf:"bytes,4,opt,name=maxStaleness,proto3" json:"maxStaleness,omitempty"`
+	// keysOnly returns entries without attributes
+	KeysOnly bool `protobuf:"varint,5,opt,name=keysOnly,proto3" json:"keysOnly,omitempty"`
+	// filter is an expression entries must match, e.g. status = "active"
+	Filter string `protobuf:"bytes,6,opt,name=filter,proto3" json:"filter,omitempty"`
+	// table is empty for the default table
+	Table string `protobuf:"bytes,7,opt,name=table,proto3" json:"table,omitempty"`
+	// paths limit the attributes returned to values inside documents, as in
+	// ReadMsg
+	Paths []string `protobuf:"bytes,8,rep,name=paths,proto3" json:"paths,omitempty"`
+	// linearizable is as in ReadMsg
+	Linearizable         bool     `protobuf:"varint,9,opt,name=linearizable,proto3" json:"linearizable,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -122,7 +267,7 @@ func (m *ScanMsg) Reset()         { *m = ScanMsg{} }
 func (m *ScanMsg) String() string { return proto.CompactTextString(m) }
 func (*ScanMsg) ProtoMessage()    {}
 func (*ScanMsg) Descriptor() ([]byte, []int) {
-	return fileDescriptor_748391160b9263c4, []int{1}
+	return fileDescriptor_748391160b9263c4, []int{2}
 }
 
 func (m *ScanMsg) XXX_Unmarshal(b []byte) error {
@@ -164,6 +309,132 @@ func (m *ScanMsg) GetAttributes() []string {
 	return nil
 }
 
+func (m *ScanMsg) GetMaxStaleness() *Staleness {
+	if m != nil {
+		return m.MaxStaleness
+	}
+	return nil
+}
+
+func (m *ScanMsg) GetKeysOnly() bool {
+	if m != nil {
+		return m.KeysOnly
+	}
+	return false
+}
+
+func (m *ScanMsg) GetFilter() string {
+	if m != nil {
+		return m.Filter
+	}
+	return ""
+}
+
+func (m *ScanMsg) GetTable() string {
+	if m != nil {
+		return m.Table
+	}
+	return ""
+}
+
+func (m *ScanMsg) GetPaths() []string {
+	if m != nil {
+		return m.Paths
+	}
+	return nil
+}
+
+func (m *ScanMsg) GetLinearizable() bool {
+	if m != nil {
+		return m.Linearizable
+	}
+	return false
+}
+
+// KeyRangeMsg selects the keys a ScanMsg from startKey to endKey returns, or
+// the keys starting with prefix if it is set. CountRPC counts the whole table
+// if no key is set.
+type KeyRangeMsg struct {
+	StartKey     string     `protobuf:"bytes,1,opt,name=startKey,proto3" json:"startKey,omitempty"`
+	EndKey       string     `protobuf:"bytes,2,opt,name=endKey,proto3" json:"endKey,omitempty"`
+	Prefix       string     `protobuf:"bytes,3,opt,name=prefix,proto3" json:"prefix,omitempty"`
+	MaxStaleness *Staleness `protobuf:"bytes,4,opt,name=maxStaleness,proto3" json:"maxStaleness,omitempty"`
+	// table is empty for the default table
+	Table string `protobuf:"bytes,5,opt,name=table,proto3" json:"table,omitempty"`
+	// linearizable is as in ReadMsg
+	Linearizable         bool     `protobuf:"varint,6,opt,name=linearizable,proto3" json:"linearizable,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *KeyRangeMsg) Reset()         { *m = KeyRangeMsg{} }
+func (m *KeyRangeMsg) String() string { return proto.CompactTextString(m) }
+func (*KeyRangeMsg) ProtoMessage()    {}
+func (*KeyRangeMsg) Descriptor() ([]byte, []int) {
+	return fileDescriptor_748391160b9263c4, []int{3}
+}
+
+func (m *KeyRangeMsg) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_KeyRangeMsg.Unmarshal(m, b)
+}
+func (m *KeyRangeMsg) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_KeyRangeMsg.Marshal(b, m, deterministic)
+}
+func (m *KeyRangeMsg) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_KeyRangeMsg.Merge(m, src)
+}
+func (m *KeyRangeMsg) XXX_Size() int {
+	return xxx_messageInfo_KeyRangeMsg.Size(m)
+}
+func (m *KeyRangeMsg) XXX_DiscardUnknown() {
+	xxx_messageInfo_KeyRangeMsg.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_KeyRangeMsg proto.InternalMessageInfo
+
+func (m *KeyRangeMsg) GetStartKey() string {
+	if m != nil {
+		return m.StartKey
+	}
+	return ""
+}
+
+func (m *KeyRangeMsg) GetEndKey() string {
+	if m != nil {
+		return m.EndKey
+	}
+	return ""
+}
+
+func (m *KeyRangeMsg) GetPrefix() string {
+	if m != nil {
+		return m.Prefix
+	}
+	return ""
+}
+
+func (m *KeyRangeMsg) GetMaxStaleness() *Staleness {
+	if m != nil {
+		return m.MaxStaleness
+	}
+	return nil
+}
+
+func (m *KeyRangeMsg) GetTable() string {
+	if m != nil {
+		return m.Table
+	}
+	return ""
+}
+
+func (m *KeyRangeMsg) GetLinearizable() bool {
+	if m != nil {
+		return m.Linearizable
+	}
+	return false
+}
+
 type EntriesMsg struct {
 	Entries              []*Entry `protobuf:"bytes,1,rep,name=entries,proto3" json:"entries,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
@@ -175,7 +446,7 @@ func (m *EntriesMsg) Reset()         { *m = EntriesMsg{} }
 func (m *EntriesMsg) String() string { return proto.CompactTextString(m) }
 func (*EntriesMsg) ProtoMessage()    {}
 func (*EntriesMsg) Descriptor() ([]byte, []int) {
-	return fileDescriptor_748391160b9263c4, []int{2}
+	return fileDescriptor_748391160b9263c4, []int{4}
 }
 
 func (m *EntriesMsg) XXX_Unmarshal(b []byte) error {
@@ -204,19 +475,33 @@ func (m *EntriesMsg) GetEntries() []*Entry {
 }
 
 type Attribute struct {
-	Name                 string         `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
-	Type                 Attribute_Type `protobuf:"varint,2,opt,name=type,proto3,enum=simpledb.Attribute_Type" json:"type,omitempty"`
-	Value                []byte         `protobuf:"bytes,3,opt,name=value,proto3" json:"value,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}       `json:"-"`
-	XXX_unrecognized     []byte         `json:"-"`
-	XXX_sizecache        int32          `json:"-"`
+	Name string         `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Type Attribute_Type `protobuf:"varint,2,opt,name=type,proto3,enum=simpledb.Attribute_Type" json:"type,omitempty"`
+	// value is the canonical encoding of the attribute: 1 byte, 0 or 1, for
+	// BOOL, 8 bytes little endian for INT, UINT and FLOAT (IEEE 754), valid
+	// UTF-8 for STRING and any bytes for BYTES. Writes with any other
+	// encoding are rejected.
+	Value []byte `protobuf:"bytes,3,opt,name=value,proto3" json:"value,omitempty"`
+	// typed sets a bool or number without encoding it. A write may set type
+	// and value as well, and is rejected if they do not match it. Responses
+	// set it for bool and number attributes as well as type and value.
+	//
+	// Types that are valid to be assigned to Typed:
+	//	*Attribute_BoolValue
+	//	*Attribute_IntValue
+	//	*Attribute_UintValue
+	//	*Attribute_FloatValue
+	Typed                isAttribute_Typed `protobuf_oneof:"typed"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
 }
 
 func (m *Attribute) Reset()         { *m = Attribute{} }
 func (m *Attribute) String() string { return proto.CompactTextString(m) }
 func (*Attribute) ProtoMessage()    {}
 func (*Attribute) Descriptor() ([]byte, []int) {
-	return fileDescriptor_748391160b9263c4, []int{3}
+	return fileDescriptor_748391160b9263c4, []int{5}
 }
 
 func (m *Attribute) XXX_Unmarshal(b []byte) error {
@@ -258,9 +543,89 @@ func (m *Attribute) GetValue() []byte {
 	return nil
 }
 
+type isAttribute_Typed interface {
+	isAttribute_Typed()
+}
+
+type Attribute_BoolValue struct {
+	BoolValue bool `protobuf:"varint,4,opt,name=bool_value,json=boolValue,proto3,oneof"`
+}
+
+type Attribute_IntValue struct {
+	IntValue int64 `protobuf:"zigzag64,5,opt,name=int_value,json=intValue,proto3,oneof"`
+}
+
+type Attribute_UintValue struct {
+	UintValue uint64 `protobuf:"varint,6,opt,name=uint_value,json=uintValue,proto3,oneof"`
+}
+
+type Attribute_FloatValue struct {
+	FloatValue float64 `protobuf:"fixed64,7,opt,name=float_value,json=floatValue,proto3,oneof"`
+}
+
+func (*Attribute_BoolValue) isAttribute_Typed() {}
+
+func (*Attribute_IntValue) isAttribute_Typed() {}
+
+func (*Attribute_UintValue) isAttribute_Typed() {}
+
+func (*Attribute_FloatValue) isAttribute_Typed() {}
+
+func (m *Attribute) GetTyped() isAttribute_Typed {
+	if m != nil {
+		return m.Typed
+	}
+	return nil
+}
+
+func (m *Attribute) GetBoolValue() bool {
+	if x, ok := m.GetTyped().(*Attribute_BoolValue); ok {
+		return x.BoolValue
+	}
+	return false
+}
+
+func (m *Attribute) GetIntValue() int64 {
+	if x, ok := m.GetTyped().(*Attribute_IntValue); ok {
+		return x.IntValue
+	}
+	return 0
+}
+
+func (m *Attribute) GetUintValue() uint64 {
+	if x, ok := m.GetTyped().(*Attribute_UintValue); ok {
+		return x.UintValue
+	}
+	return 0
+}
+
+func (m *Attribute) GetFloatValue() float64 {
+	if x, ok := m.GetTyped().(*Attribute_FloatValue); ok {
+		return x.FloatValue
+	}
+	return 0
+}
+
+// XXX_OneofWrappers is for the internal use of the proto package.
+func (*Attribute) XXX_OneofWrappers() []interface{} {
+	return []interface{}{
+		(*Attribute_BoolValue)(nil),
+		(*Attribute_IntValue)(nil),
+		(*Attribute_UintValue)(nil),
+		(*Attribute_FloatValue)(nil),
+	}
+}
+
 type Entry struct {
-	Key                  string       `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
-	Attributes           []*Attribute `protobuf:"bytes,2,rep,name=attributes,proto3" json:"attributes,omitempty"`
+	Key        string       `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Attributes []*Attribute `protobuf:"bytes,2,rep,name=attributes,proto3" json:"attributes,omitempty"`
+	// requestId makes a write idempotent. Ignored in responses.
+	RequestId *RequestId `protobuf:"bytes,3,opt,name=requestId,proto3" json:"requestId,omitempty"`
+	// table is empty for the default table. Ignored in responses.
+	Table string `protobuf:"bytes,4,opt,name=table,proto3" json:"table,omitempty"`
+	// paths set values inside document attributes on update, creating
+	// missing objects. Each name is a path, e.g. address.city.
+	Paths                []*Attribute `protobuf:"bytes,5,rep,name=paths,proto3" json:"paths,omitempty"`
 	XXX_NoUnkeyedLiteral struct{}     `json:"-"`
 	XXX_unrecognized     []byte       `json:"-"`
 	XXX_sizecache        int32        `json:"-"`
@@ -270,7 +635,7 @@ func (m *Entry) Reset()         { *m = Entry{} }
 func (m *Entry) String() string { return proto.CompactTextString(m) }
 func (*Entry) ProtoMessage()    {}
 func (*Entry) Descriptor() ([]byte, []int) {
-	return fileDescriptor_748391160b9263c4, []int{4}
+	return fileDescriptor_748391160b9263c4, []int{6}
 }
 
 func (m *Entry) XXX_Unmarshal(b []byte) error {
@@ -305,6 +670,27 @@ func (m *Entry) GetAttributes() []*Attribute {
 	return nil
 }
 
+func (m *Entry) GetRequestId() *RequestId {
+	if m != nil {
+		return m.RequestId
+	}
+	return nil
+}
+
+func (m *Entry) GetTable() string {
+	if m != nil {
+		return m.Table
+	}
+	return ""
+}
+
+func (m *Entry) GetPaths() []*Attribute {
+	if m != nil {
+		return m.Paths
+	}
+	return nil
+}
+
 type OkMsg struct {
 	Ok                   bool     `protobuf:"varint,1,opt,name=Ok,proto3" json:"Ok,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
@@ -316,7 +702,7 @@ func (m *OkMsg) Reset()         { *m = OkMsg{} }
 func (m *OkMsg) String() string { return proto.CompactTextString(m) }
 func (*OkMsg) ProtoMessage()    {}
 func (*OkMsg) Descriptor() ([]byte, []int) {
-	return fileDescriptor_748391160b9263c4, []int{5}
+	return fileDescriptor_748391160b9263c4, []int{7}
 }
 
 func (m *OkMsg) XXX_Unmarshal(b []byte) error {
@@ -345,7 +731,11 @@ func (m *OkMsg) GetOk() bool {
 }
 
 type KeyMsg struct {
-	Key                  string   `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Key string `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	// requestId makes a write idempotent
+	RequestId *RequestId `protobuf:"bytes,2,opt,name=requestId,proto3" json:"requestId,omitempty"`
+	// table is empty for the default table
+	Table                string   `protobuf:"bytes,3,opt,name=table,proto3" json:"table,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -355,7 +745,7 @@ func (m *KeyMsg) Reset()         { *m = KeyMsg{} }
 func (m *KeyMsg) String() string { return proto.CompactTextString(m) }
 func (*KeyMsg) ProtoMessage()    {}
 func (*KeyMsg) Descriptor() ([]byte, []int) {
-	return fileDescriptor_748391160b9263c4, []int{6}
+	return fileDescriptor_748391160b9263c4, []int{8}
 }
 
 func (m *KeyMsg) XXX_Unmarshal(b []byte) error {
@@ -383,87 +773,1306 @@ func (m *KeyMsg) GetKey() string {
 	return ""
 }
 
-func init() {
-	proto.RegisterEnum("simpledb.Attribute_Type", Attribute_Type_name, Attribute_Type_value)
-	proto.RegisterType((*ReadMsg)(nil), "simpledb.ReadMsg")
-	proto.RegisterType((*ScanMsg)(nil), "simpledb.ScanMsg")
-	proto.RegisterType((*EntriesMsg)(nil), "simpledb.EntriesMsg")
-	proto.RegisterType((*Attribute)(nil), "simpledb.Attribute")
-	proto.RegisterType((*Entry)(nil), "simpledb.Entry")
-	proto.RegisterType((*OkMsg)(nil), "simpledb.OkMsg")
-	proto.RegisterType((*KeyMsg)(nil), "simpledb.KeyMsg")
+func (m *KeyMsg) GetRequestId() *RequestId {
+	if m != nil {
+		return m.RequestId
+	}
+	return nil
 }
 
-func init() { proto.RegisterFile("simpledb.proto", fileDescriptor_748391160b9263c4) }
-
-var fileDescriptor_748391160b9263c4 = []byte{
-	// 416 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x53, 0xcf, 0x8f, 0x93, 0x50,
-	0x10, 0x96, 0xdf, 0x30, 0x6b, 0x2a, 0x3e, 0x37, 0x4a, 0x38, 0x18, 0xc2, 0x09, 0x13, 0xcb, 0x81,
-	0x3d, 0x78, 0xf0, 0xb4, 0xeb, 0x56, 0xd3, 0xec, 0x5a, 0xcc, 0x83, 0x3d, 0x78, 0xf0, 0x00, 0x32,
-	0x31, 0x0d, 0x5d, 0x96, 0xc0, 0xab, 0x09, 0xff, 0x92, 0xff, 0xa2, 0x17, 0xf3, 0x1e, 0x94, 0xb6,
-	0xb4, 0x07, 0x6f, 0xf3, 0xe3, 0x9b, 0x6f, 0x66, 0xbe, 0x37, 0x0f, 0x66, 0xed, 0xfa, 0xb1, 0xde,
-	0x60, 0x91, 0x87, 0x75, 0xf3, 0xc4, 0x9e, 0x88, 0xb9, 0xf3, 0xfd, 0x8f, 0x60, 0x50, 0xcc, 0x8a,
-	0xaf, 0xed, 0x2f, 0x62, 0x83, 0x52, 0x62, 0xe7, 0x48, 0x9e, 0x14, 0x58, 0x94, 0x9b, 0xe4, 0x2d,
-	0x40, 0xc6, 0x58, 0xb3, 0xce, 0xb7, 0x0c, 0x5b, 0x47, 0xf6, 0x94, 0xc0, 0xa2, 0x07, 0x11, 0xff,
-	0x07, 0x18, 0xc9, 0xcf, 0xac, 0xe2, 0xc5, 0x2e, 0x98, 0x2d, 0xcb, 0x1a, 0x76, 0x37, 0x32, 0x8c,
-	0x3e, 0x79, 0x0d, 0x3a, 0x56, 0x05, 0xcf, 0xc8, 0x22, 0x33, 0x78, 0x13, 0x7a, 0xe5, 0x84, 0xfe,
-	0x03, 0xc0, 0xa2, 0x62, 0xcd, 0x1a, 0x5b, 0xde, 0xe1, 0x1d, 0x18, 0xd8, 0x7b, 0x8e, 0xe4, 0x29,
-	0xc1, 0x45, 0xf4, 0x22, 0x1c, 0xb7, 0xe2, 0xb0, 0x8e, 0xee, 0xf2, 0xfe, 0x1f, 0x09, 0xac, 0xeb,
-	0x1d, 0x0f, 0x21, 0xa0, 0x56, 0xd9, 0x23, 0x0e, 0x63, 0x09, 0x9b, 0xbc, 0x07, 0x95, 0x75, 0x35,
-	0x8a, 0x81, 0x66, 0x91, 0xb3, 0x67, 0x1a, 0xcb, 0xc2, 0xb4, 0xab, 0x91, 0x0a, 0x14, 0xb9, 0x04,
-	0xed, 0x77, 0xb6, 0xd9, 0xa2, 0xa3, 0x78, 0x52, 0xf0, 0x9c, 0xf6, 0x8e, 0xbf, 0x00, 0x95, 0x63,
-	0x88, 0x09, 0xea, 0x4d, 0x1c, 0xdf, 0xdb, 0xcf, 0x88, 0x01, 0xca, 0x72, 0x95, 0xda, 0x12, 0x0f,
-	0x3d, 0x70, 0x4b, 0x26, 0x16, 0x68, 0x9f, 0xef, 0xe3, 0xeb, 0xd4, 0x56, 0x08, 0x80, 0x9e, 0xa4,
-	0x74, 0xb9, 0xfa, 0x62, 0xab, 0x3c, 0x7c, 0xf3, 0x3d, 0x5d, 0x24, 0xb6, 0xe6, 0xaf, 0x40, 0x13,
-	0xe3, 0x9f, 0xd1, 0xff, 0xea, 0x44, 0xff, 0x8b, 0xe8, 0xd5, 0x99, 0x59, 0x8f, 0x54, 0x7b, 0x03,
-	0x5a, 0x5c, 0x72, 0xc1, 0x66, 0x20, 0xc7, 0xa5, 0xa0, 0x33, 0xa9, 0x1c, 0x97, 0xbe, 0x0b, 0xfa,
-	0x1d, 0x76, 0x67, 0x5f, 0x3a, 0xfa, 0x2b, 0x81, 0x99, 0x08, 0xde, 0xdb, 0x9c, 0xcc, 0xfb, 0x9b,
-	0xa0, 0xdf, 0x3e, 0x91, 0x97, 0xfb, 0x6e, 0xc3, 0x99, 0xb8, 0x53, 0xd9, 0x49, 0xd4, 0x5f, 0xc1,
-	0x04, 0x3e, 0x1c, 0x86, 0x7b, 0x79, 0x0c, 0x1f, 0x1e, 0x73, 0x0e, 0xd6, 0x43, 0x5d, 0x64, 0x0c,
-	0x79, 0xd5, 0x94, 0xf1, 0xb0, 0x45, 0xbf, 0xca, 0x1c, 0xac, 0x65, 0xd5, 0x62, 0xc3, 0xfe, 0x0f,
-	0x1e, 0x82, 0x75, 0x8b, 0x1b, 0xec, 0xd9, 0xed, 0x7d, 0xb6, 0x5f, 0xff, 0x04, 0x9f, 0xeb, 0xe2,
-	0x57, 0x5c, 0xfd, 0x0b, 0x00, 0x00, 0xff, 0xff, 0x51, 0x1e, 0x74, 0x87, 0x27, 0x03, 0x00, 0x00,
+func (m *KeyMsg) GetTable() string {
+	if m != nil {
+		return m.Table
+	}
+	return ""
 }
 
-// Reference imports to suppress errors if they are not otherwise used.
-var _ context.Context
-var _ grpc.ClientConn
-
-// This is a compile-time assertion to ensure that this generated file
-// is compatible with the grpc package it is being compiled against.
-const _ = grpc.SupportPackageIsVersion4
+// RangeMsg deletes the entries a ScanMsg with the same keys returns
+type RangeMsg struct {
+	StartKey  string     `protobuf:"bytes,1,opt,name=startKey,proto3" json:"startKey,omitempty"`
+	EndKey    string     `protobuf:"bytes,2,opt,name=endKey,proto3" json:"endKey,omitempty"`
+	RequestId *RequestId `protobuf:"bytes,3,opt,name=requestId,proto3" json:"requestId,omitempty"`
+	// table is empty for the default table
+	Table                string   `protobuf:"bytes,4,opt,name=table,proto3" json:"table,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
 
-// SimpleDbClient is the client API for SimpleDb service.
-//
-// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
-type SimpleDbClient interface {
-	ReadRPC(ctx context.Context, in *ReadMsg, opts ...grpc.CallOption) (*Entry, error)
-	ScanRPC(ctx context.Context, in *ScanMsg, opts ...grpc.CallOption) (*EntriesMsg, error)
-	UpdateRPC(ctx context.Context, in *Entry, opts ...grpc.CallOption) (*OkMsg, error)
-	InsertRPC(ctx context.Context, in *Entry, opts ...grpc.CallOption) (*OkMsg, error)
-	DeleteRPC(ctx context.Context, in *KeyMsg, opts ...grpc.CallOption) (*OkMsg, error)
+func (m *RangeMsg) Reset()         { *m = RangeMsg{} }
+func (m *RangeMsg) String() string { return proto.CompactTextString(m) }
+func (*RangeMsg) ProtoMessage()    {}
+func (*RangeMsg) Descriptor() ([]byte, []int) {
+	return fileDescriptor_748391160b9263c4, []int{9}
 }
 
-type simpleDbClient struct {
-	cc *grpc.ClientConn
+func (m *RangeMsg) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RangeMsg.Unmarshal(m, b)
+}
+func (m *RangeMsg) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RangeMsg.Marshal(b, m, deterministic)
+}
+func (m *RangeMsg) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RangeMsg.Merge(m, src)
+}
+func (m *RangeMsg) XXX_Size() int {
+	return xxx_messageInfo_RangeMsg.Size(m)
+}
+func (m *RangeMsg) XXX_DiscardUnknown() {
+	xxx_messageInfo_RangeMsg.DiscardUnknown(m)
 }
 
-func NewSimpleDbClient(cc *grpc.ClientConn) SimpleDbClient {
-	return &simpleDbClient{cc}
+var xxx_messageInfo_RangeMsg proto.InternalMessageInfo
+
+func (m *RangeMsg) GetStartKey() string {
+	if m != nil {
+		return m.StartKey
+	}
+	return ""
 }
 
-func (c *simpleDbClient) ReadRPC(ctx context.Context, in *ReadMsg, opts ...grpc.CallOption) (*Entry, error) {
-	out := new(Entry)
-	err := c.cc.Invoke(ctx, "/simpledb.SimpleDb/ReadRPC", in, out, opts...)
-	if err != nil {
-		return nil, err
+func (m *RangeMsg) GetEndKey() string {
+	if m != nil {
+		return m.EndKey
 	}
-	return out, nil
+	return ""
 }
 
-func (c *simpleDbClient) ScanRPC(ctx context.Context, in *ScanMsg, opts ...grpc.CallOption) (*EntriesMsg, error) {
-	out := new(EntriesMsg)
+func (m *RangeMsg) GetRequestId() *RequestId {
+	if m != nil {
+		return m.RequestId
+	}
+	return nil
+}
+
+func (m *RangeMsg) GetTable() string {
+	if m != nil {
+		return m.Table
+	}
+	return ""
+}
+
+type PrefixMsg struct {
+	Prefix    string     `protobuf:"bytes,1,opt,name=prefix,proto3" json:"prefix,omitempty"`
+	RequestId *RequestId `protobuf:"bytes,2,opt,name=requestId,proto3" json:"requestId,omitempty"`
+	// table is empty for the default table
+	Table                string   `protobuf:"bytes,3,opt,name=table,proto3" json:"table,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PrefixMsg) Reset()         { *m = PrefixMsg{} }
+func (m *PrefixMsg) String() string { return proto.CompactTextString(m) }
+func (*PrefixMsg) ProtoMessage()    {}
+func (*PrefixMsg) Descriptor() ([]byte, []int) {
+	return fileDescriptor_748391160b9263c4, []int{10}
+}
+
+func (m *PrefixMsg) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PrefixMsg.Unmarshal(m, b)
+}
+func (m *PrefixMsg) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PrefixMsg.Marshal(b, m, deterministic)
+}
+func (m *PrefixMsg) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PrefixMsg.Merge(m, src)
+}
+func (m *PrefixMsg) XXX_Size() int {
+	return xxx_messageInfo_PrefixMsg.Size(m)
+}
+func (m *PrefixMsg) XXX_DiscardUnknown() {
+	xxx_messageInfo_PrefixMsg.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PrefixMsg proto.InternalMessageInfo
+
+func (m *PrefixMsg) GetPrefix() string {
+	if m != nil {
+		return m.Prefix
+	}
+	return ""
+}
+
+func (m *PrefixMsg) GetRequestId() *RequestId {
+	if m != nil {
+		return m.RequestId
+	}
+	return nil
+}
+
+func (m *PrefixMsg) GetTable() string {
+	if m != nil {
+		return m.Table
+	}
+	return ""
+}
+
+type CountMsg struct {
+	Count                uint64   `protobuf:"varint,1,opt,name=count,proto3" json:"count,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *CountMsg) Reset()         { *m = CountMsg{} }
+func (m *CountMsg) String() string { return proto.CompactTextString(m) }
+func (*CountMsg) ProtoMessage()    {}
+func (*CountMsg) Descriptor() ([]byte, []int) {
+	return fileDescriptor_748391160b9263c4, []int{11}
+}
+
+func (m *CountMsg) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_CountMsg.Unmarshal(m, b)
+}
+func (m *CountMsg) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_CountMsg.Marshal(b, m, deterministic)
+}
+func (m *CountMsg) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CountMsg.Merge(m, src)
+}
+func (m *CountMsg) XXX_Size() int {
+	return xxx_messageInfo_CountMsg.Size(m)
+}
+func (m *CountMsg) XXX_DiscardUnknown() {
+	xxx_messageInfo_CountMsg.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CountMsg proto.InternalMessageInfo
+
+func (m *CountMsg) GetCount() uint64 {
+	if m != nil {
+		return m.Count
+	}
+	return 0
+}
+
+// RequestId identifies a write within a client session so that a retried
+// write is applied at most once and returns the result of the first attempt
+type RequestId struct {
+	ClientId string `protobuf:"bytes,1,opt,name=clientId,proto3" json:"clientId,omitempty"`
+	// sequence is unique per client and starts at 1
+	Sequence uint64 `protobuf:"varint,2,opt,name=sequence,proto3" json:"sequence,omitempty"`
+	// firstIncomplete is the lowest sequence the client has not received a
+	// response for. Results of lower sequences are discarded.
+	FirstIncomplete      uint64   `protobuf:"varint,3,opt,name=firstIncomplete,proto3" json:"firstIncomplete,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RequestId) Reset()         { *m = RequestId{} }
+func (m *RequestId) String() string { return proto.CompactTextString(m) }
+func (*RequestId) ProtoMessage()    {}
+func (*RequestId) Descriptor() ([]byte, []int) {
+	return fileDescriptor_748391160b9263c4, []int{12}
+}
+
+func (m *RequestId) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RequestId.Unmarshal(m, b)
+}
+func (m *RequestId) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RequestId.Marshal(b, m, deterministic)
+}
+func (m *RequestId) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RequestId.Merge(m, src)
+}
+func (m *RequestId) XXX_Size() int {
+	return xxx_messageInfo_RequestId.Size(m)
+}
+func (m *RequestId) XXX_DiscardUnknown() {
+	xxx_messageInfo_RequestId.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RequestId proto.InternalMessageInfo
+
+func (m *RequestId) GetClientId() string {
+	if m != nil {
+		return m.ClientId
+	}
+	return ""
+}
+
+func (m *RequestId) GetSequence() uint64 {
+	if m != nil {
+		return m.Sequence
+	}
+	return 0
+}
+
+func (m *RequestId) GetFirstIncomplete() uint64 {
+	if m != nil {
+		return m.FirstIncomplete
+	}
+	return 0
+}
+
+type EmptyMsg struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *EmptyMsg) Reset()         { *m = EmptyMsg{} }
+func (m *EmptyMsg) String() string { return proto.CompactTextString(m) }
+func (*EmptyMsg) ProtoMessage()    {}
+func (*EmptyMsg) Descriptor() ([]byte, []int) {
+	return fileDescriptor_748391160b9263c4, []int{13}
+}
+
+func (m *EmptyMsg) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_EmptyMsg.Unmarshal(m, b)
+}
+func (m *EmptyMsg) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_EmptyMsg.Marshal(b, m, deterministic)
+}
+func (m *EmptyMsg) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_EmptyMsg.Merge(m, src)
+}
+func (m *EmptyMsg) XXX_Size() int {
+	return xxx_messageInfo_EmptyMsg.Size(m)
+}
+func (m *EmptyMsg) XXX_DiscardUnknown() {
+	xxx_messageInfo_EmptyMsg.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_EmptyMsg proto.InternalMessageInfo
+
+type ServerMsg struct {
+	Id                   string   `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Address              string   `protobuf:"bytes,2,opt,name=address,proto3" json:"address,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ServerMsg) Reset()         { *m = ServerMsg{} }
+func (m *ServerMsg) String() string { return proto.CompactTextString(m) }
+func (*ServerMsg) ProtoMessage()    {}
+func (*ServerMsg) Descriptor() ([]byte, []int) {
+	return fileDescriptor_748391160b9263c4, []int{14}
+}
+
+func (m *ServerMsg) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ServerMsg.Unmarshal(m, b)
+}
+func (m *ServerMsg) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ServerMsg.Marshal(b, m, deterministic)
+}
+func (m *ServerMsg) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ServerMsg.Merge(m, src)
+}
+func (m *ServerMsg) XXX_Size() int {
+	return xxx_messageInfo_ServerMsg.Size(m)
+}
+func (m *ServerMsg) XXX_DiscardUnknown() {
+	xxx_messageInfo_ServerMsg.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ServerMsg proto.InternalMessageInfo
+
+func (m *ServerMsg) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *ServerMsg) GetAddress() string {
+	if m != nil {
+		return m.Address
+	}
+	return ""
+}
+
+type ServerStatus struct {
+	Id       string                `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Address  string                `protobuf:"bytes,2,opt,name=address,proto3" json:"address,omitempty"`
+	Suffrage ServerStatus_Suffrage `protobuf:"varint,3,opt,name=suffrage,proto3,enum=simpledb.ServerStatus_Suffrage" json:"suffrage,omitempty"`
+	Leader   bool                  `protobuf:"varint,4,opt,name=leader,proto3" json:"leader,omitempty"`
+	// lastContact is milliseconds since the server last heard from the leader.
+	// The leader knows it for every server it has polled, other servers only
+	// for themselves. It is -1 when unknown.
+	LastContact int64 `protobuf:"varint,5,opt,name=lastContact,proto3" json:"lastContact,omitempty"`
+	// replicationLag is the number of entries the leader had committed but the
+	// server had not applied when the leader last polled it. It is only known
+	// on the leader, -1 otherwise.
+	ReplicationLag       int64    `protobuf:"varint,6,opt,name=replicationLag,proto3" json:"replicationLag,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ServerStatus) Reset()         { *m = ServerStatus{} }
+func (m *ServerStatus) String() string { return proto.CompactTextString(m) }
+func (*ServerStatus) ProtoMessage()    {}
+func (*ServerStatus) Descriptor() ([]byte, []int) {
+	return fileDescriptor_748391160b9263c4, []int{15}
+}
+
+func (m *ServerStatus) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ServerStatus.Unmarshal(m, b)
+}
+func (m *ServerStatus) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ServerStatus.Marshal(b, m, deterministic)
+}
+func (m *ServerStatus) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ServerStatus.Merge(m, src)
+}
+func (m *ServerStatus) XXX_Size() int {
+	return xxx_messageInfo_ServerStatus.Size(m)
+}
+func (m *ServerStatus) XXX_DiscardUnknown() {
+	xxx_messageInfo_ServerStatus.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ServerStatus proto.InternalMessageInfo
+
+func (m *ServerStatus) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *ServerStatus) GetAddress() string {
+	if m != nil {
+		return m.Address
+	}
+	return ""
+}
+
+func (m *ServerStatus) GetSuffrage() ServerStatus_Suffrage {
+	if m != nil {
+		return m.Suffrage
+	}
+	return ServerStatus_VOTER
+}
+
+func (m *ServerStatus) GetLeader() bool {
+	if m != nil {
+		return m.Leader
+	}
+	return false
+}
+
+func (m *ServerStatus) GetLastContact() int64 {
+	if m != nil {
+		return m.LastContact
+	}
+	return 0
+}
+
+func (m *ServerStatus) GetReplicationLag() int64 {
+	if m != nil {
+		return m.ReplicationLag
+	}
+	return 0
+}
+
+type StatusMsg struct {
+	Id           string          `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	State        string          `protobuf:"bytes,2,opt,name=state,proto3" json:"state,omitempty"`
+	Leader       string          `protobuf:"bytes,3,opt,name=leader,proto3" json:"leader,omitempty"`
+	Term         uint64          `protobuf:"varint,4,opt,name=term,proto3" json:"term,omitempty"`
+	CommitIndex  uint64          `protobuf:"varint,5,opt,name=commitIndex,proto3" json:"commitIndex,omitempty"`
+	AppliedIndex uint64          `protobuf:"varint,6,opt,name=appliedIndex,proto3" json:"appliedIndex,omitempty"`
+	Servers      []*ServerStatus `protobuf:"bytes,7,rep,name=servers,proto3" json:"servers,omitempty"`
+	// rpcAddress is the advertised rpc address of the server answering the request
+	RpcAddress string `protobuf:"bytes,8,opt,name=rpcAddress,proto3" json:"rpcAddress,omitempty"`
+	// replicationLag is the number of log entries committed by the leader
+	// that the server answering the request has not applied yet. Followers
+	// learn the leader's commit index when it polls them.
+	ReplicationLag uint64 `protobuf:"varint,9,opt,name=replicationLag,proto3" json:"replicationLag,omitempty"`
+	// featureVersion is the highest command format version supported by the
+	// server answering the request, and clusterFeatureVersion the highest one
+	// supported by every server in the cluster
+	FeatureVersion        uint32   `protobuf:"varint,10,opt,name=featureVersion,proto3" json:"featureVersion,omitempty"`
+	ClusterFeatureVersion uint32   `protobuf:"varint,11,opt,name=clusterFeatureVersion,proto3" json:"clusterFeatureVersion,omitempty"`
+	XXX_NoUnkeyedLiteral  struct{} `json:"-"`
+	XXX_unrecognized      []byte   `json:"-"`
+	XXX_sizecache         int32    `json:"-"`
+}
+
+func (m *StatusMsg) Reset()         { *m = StatusMsg{} }
+func (m *StatusMsg) String() string { return proto.CompactTextString(m) }
+func (*StatusMsg) ProtoMessage()    {}
+func (*StatusMsg) Descriptor() ([]byte, []int) {
+	return fileDescriptor_748391160b9263c4, []int{16}
+}
+
+func (m *StatusMsg) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_StatusMsg.Unmarshal(m, b)
+}
+func (m *StatusMsg) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_StatusMsg.Marshal(b, m, deterministic)
+}
+func (m *StatusMsg) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_StatusMsg.Merge(m, src)
+}
+func (m *StatusMsg) XXX_Size() int {
+	return xxx_messageInfo_StatusMsg.Size(m)
+}
+func (m *StatusMsg) XXX_DiscardUnknown() {
+	xxx_messageInfo_StatusMsg.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_StatusMsg proto.InternalMessageInfo
+
+func (m *StatusMsg) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *StatusMsg) GetState() string {
+	if m != nil {
+		return m.State
+	}
+	return ""
+}
+
+func (m *StatusMsg) GetLeader() string {
+	if m != nil {
+		return m.Leader
+	}
+	return ""
+}
+
+func (m *StatusMsg) GetTerm() uint64 {
+	if m != nil {
+		return m.Term
+	}
+	return 0
+}
+
+func (m *StatusMsg) GetCommitIndex() uint64 {
+	if m != nil {
+		return m.CommitIndex
+	}
+	return 0
+}
+
+func (m *StatusMsg) GetAppliedIndex() uint64 {
+	if m != nil {
+		return m.AppliedIndex
+	}
+	return 0
+}
+
+func (m *StatusMsg) GetServers() []*ServerStatus {
+	if m != nil {
+		return m.Servers
+	}
+	return nil
+}
+
+func (m *StatusMsg) GetRpcAddress() string {
+	if m != nil {
+		return m.RpcAddress
+	}
+	return ""
+}
+
+func (m *StatusMsg) GetReplicationLag() uint64 {
+	if m != nil {
+		return m.ReplicationLag
+	}
+	return 0
+}
+
+func (m *StatusMsg) GetFeatureVersion() uint32 {
+	if m != nil {
+		return m.FeatureVersion
+	}
+	return 0
+}
+
+func (m *StatusMsg) GetClusterFeatureVersion() uint32 {
+	if m != nil {
+		return m.ClusterFeatureVersion
+	}
+	return 0
+}
+
+// ProgressMsg carries the commit index of the leader polling a server's
+// progress, and the applied index of the server in its reply
+type ProgressMsg struct {
+	AppliedIndex         uint64   `protobuf:"varint,1,opt,name=appliedIndex,proto3" json:"appliedIndex,omitempty"`
+	CommitIndex          uint64   `protobuf:"varint,2,opt,name=commitIndex,proto3" json:"commitIndex,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ProgressMsg) Reset()         { *m = ProgressMsg{} }
+func (m *ProgressMsg) String() string { return proto.CompactTextString(m) }
+func (*ProgressMsg) ProtoMessage()    {}
+func (*ProgressMsg) Descriptor() ([]byte, []int) {
+	return fileDescriptor_748391160b9263c4, []int{17}
+}
+
+func (m *ProgressMsg) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ProgressMsg.Unmarshal(m, b)
+}
+func (m *ProgressMsg) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ProgressMsg.Marshal(b, m, deterministic)
+}
+func (m *ProgressMsg) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ProgressMsg.Merge(m, src)
+}
+func (m *ProgressMsg) XXX_Size() int {
+	return xxx_messageInfo_ProgressMsg.Size(m)
+}
+func (m *ProgressMsg) XXX_DiscardUnknown() {
+	xxx_messageInfo_ProgressMsg.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ProgressMsg proto.InternalMessageInfo
+
+func (m *ProgressMsg) GetAppliedIndex() uint64 {
+	if m != nil {
+		return m.AppliedIndex
+	}
+	return 0
+}
+
+func (m *ProgressMsg) GetCommitIndex() uint64 {
+	if m != nil {
+		return m.CommitIndex
+	}
+	return 0
+}
+
+// MemberMsg registers a server with the leader
+type MemberMsg struct {
+	Id                   string   `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	RpcAddress           string   `protobuf:"bytes,2,opt,name=rpcAddress,proto3" json:"rpcAddress,omitempty"`
+	FeatureVersion       uint32   `protobuf:"varint,3,opt,name=featureVersion,proto3" json:"featureVersion,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *MemberMsg) Reset()         { *m = MemberMsg{} }
+func (m *MemberMsg) String() string { return proto.CompactTextString(m) }
+func (*MemberMsg) ProtoMessage()    {}
+func (*MemberMsg) Descriptor() ([]byte, []int) {
+	return fileDescriptor_748391160b9263c4, []int{18}
+}
+
+func (m *MemberMsg) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_MemberMsg.Unmarshal(m, b)
+}
+func (m *MemberMsg) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_MemberMsg.Marshal(b, m, deterministic)
+}
+func (m *MemberMsg) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_MemberMsg.Merge(m, src)
+}
+func (m *MemberMsg) XXX_Size() int {
+	return xxx_messageInfo_MemberMsg.Size(m)
+}
+func (m *MemberMsg) XXX_DiscardUnknown() {
+	xxx_messageInfo_MemberMsg.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_MemberMsg proto.InternalMessageInfo
+
+func (m *MemberMsg) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *MemberMsg) GetRpcAddress() string {
+	if m != nil {
+		return m.RpcAddress
+	}
+	return ""
+}
+
+func (m *MemberMsg) GetFeatureVersion() uint32 {
+	if m != nil {
+		return m.FeatureVersion
+	}
+	return 0
+}
+
+// IndexMsg names the attribute of a secondary index
+type IndexMsg struct {
+	Attribute string `protobuf:"bytes,1,opt,name=attribute,proto3" json:"attribute,omitempty"`
+	// table is empty for the default table
+	Table                string   `protobuf:"bytes,2,opt,name=table,proto3" json:"table,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *IndexMsg) Reset()         { *m = IndexMsg{} }
+func (m *IndexMsg) String() string { return proto.CompactTextString(m) }
+func (*IndexMsg) ProtoMessage()    {}
+func (*IndexMsg) Descriptor() ([]byte, []int) {
+	return fileDescriptor_748391160b9263c4, []int{19}
+}
+
+func (m *IndexMsg) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_IndexMsg.Unmarshal(m, b)
+}
+func (m *IndexMsg) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_IndexMsg.Marshal(b, m, deterministic)
+}
+func (m *IndexMsg) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_IndexMsg.Merge(m, src)
+}
+func (m *IndexMsg) XXX_Size() int {
+	return xxx_messageInfo_IndexMsg.Size(m)
+}
+func (m *IndexMsg) XXX_DiscardUnknown() {
+	xxx_messageInfo_IndexMsg.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_IndexMsg proto.InternalMessageInfo
+
+func (m *IndexMsg) GetAttribute() string {
+	if m != nil {
+		return m.Attribute
+	}
+	return ""
+}
+
+func (m *IndexMsg) GetTable() string {
+	if m != nil {
+		return m.Table
+	}
+	return ""
+}
+
+type IndexInfo struct {
+	Attribute string `protobuf:"bytes,1,opt,name=attribute,proto3" json:"attribute,omitempty"`
+	// ready is false while existing entries are being backfilled
+	Ready                bool     `protobuf:"varint,2,opt,name=ready,proto3" json:"ready,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *IndexInfo) Reset()         { *m = IndexInfo{} }
+func (m *IndexInfo) String() string { return proto.CompactTextString(m) }
+func (*IndexInfo) ProtoMessage()    {}
+func (*IndexInfo) Descriptor() ([]byte, []int) {
+	return fileDescriptor_748391160b9263c4, []int{20}
+}
+
+func (m *IndexInfo) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_IndexInfo.Unmarshal(m, b)
+}
+func (m *IndexInfo) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_IndexInfo.Marshal(b, m, deterministic)
+}
+func (m *IndexInfo) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_IndexInfo.Merge(m, src)
+}
+func (m *IndexInfo) XXX_Size() int {
+	return xxx_messageInfo_IndexInfo.Size(m)
+}
+func (m *IndexInfo) XXX_DiscardUnknown() {
+	xxx_messageInfo_IndexInfo.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_IndexInfo proto.InternalMessageInfo
+
+func (m *IndexInfo) GetAttribute() string {
+	if m != nil {
+		return m.Attribute
+	}
+	return ""
+}
+
+func (m *IndexInfo) GetReady() bool {
+	if m != nil {
+		return m.Ready
+	}
+	return false
+}
+
+type IndexesMsg struct {
+	Indexes              []*IndexInfo `protobuf:"bytes,1,rep,name=indexes,proto3" json:"indexes,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}     `json:"-"`
+	XXX_unrecognized     []byte       `json:"-"`
+	XXX_sizecache        int32        `json:"-"`
+}
+
+func (m *IndexesMsg) Reset()         { *m = IndexesMsg{} }
+func (m *IndexesMsg) String() string { return proto.CompactTextString(m) }
+func (*IndexesMsg) ProtoMessage()    {}
+func (*IndexesMsg) Descriptor() ([]byte, []int) {
+	return fileDescriptor_748391160b9263c4, []int{21}
+}
+
+func (m *IndexesMsg) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_IndexesMsg.Unmarshal(m, b)
+}
+func (m *IndexesMsg) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_IndexesMsg.Marshal(b, m, deterministic)
+}
+func (m *IndexesMsg) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_IndexesMsg.Merge(m, src)
+}
+func (m *IndexesMsg) XXX_Size() int {
+	return xxx_messageInfo_IndexesMsg.Size(m)
+}
+func (m *IndexesMsg) XXX_DiscardUnknown() {
+	xxx_messageInfo_IndexesMsg.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_IndexesMsg proto.InternalMessageInfo
+
+func (m *IndexesMsg) GetIndexes() []*IndexInfo {
+	if m != nil {
+		return m.Indexes
+	}
+	return nil
+}
+
+// IndexQueryMsg looks up entries by the value of an indexed attribute, either
+// equal to value or from start, inclusive, to end, exclusive. The names of
+// the attributes used as values are ignored.
+type IndexQueryMsg struct {
+	Attribute    string     `protobuf:"bytes,1,opt,name=attribute,proto3" json:"attribute,omitempty"`
+	Value        *Attribute `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	Start        *Attribute `protobuf:"bytes,3,opt,name=start,proto3" json:"start,omitempty"`
+	End          *Attribute `protobuf:"bytes,4,opt,name=end,proto3" json:"end,omitempty"`
+	KeysOnly     bool       `protobuf:"varint,5,opt,name=keysOnly,proto3" json:"keysOnly,omitempty"`
+	MaxStaleness *Staleness `protobuf:"bytes,6,opt,name=maxStaleness,proto3" json:"maxStaleness,omitempty"`
+	// table is empty for the default table
+	Table                string   `protobuf:"bytes,7,opt,name=table,proto3" json:"table,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *IndexQueryMsg) Reset()         { *m = IndexQueryMsg{} }
+func (m *IndexQueryMsg) String() string { return proto.CompactTextString(m) }
+func (*IndexQueryMsg) ProtoMessage()    {}
+func (*IndexQueryMsg) Descriptor() ([]byte, []int) {
+	return fileDescriptor_748391160b9263c4, []int{22}
+}
+
+func (m *IndexQueryMsg) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_IndexQueryMsg.Unmarshal(m, b)
+}
+func (m *IndexQueryMsg) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_IndexQueryMsg.Marshal(b, m, deterministic)
+}
+func (m *IndexQueryMsg) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_IndexQueryMsg.Merge(m, src)
+}
+func (m *IndexQueryMsg) XXX_Size() int {
+	return xxx_messageInfo_IndexQueryMsg.Size(m)
+}
+func (m *IndexQueryMsg) XXX_DiscardUnknown() {
+	xxx_messageInfo_IndexQueryMsg.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_IndexQueryMsg proto.InternalMessageInfo
+
+func (m *IndexQueryMsg) GetAttribute() string {
+	if m != nil {
+		return m.Attribute
+	}
+	return ""
+}
+
+func (m *IndexQueryMsg) GetValue() *Attribute {
+	if m != nil {
+		return m.Value
+	}
+	return nil
+}
+
+func (m *IndexQueryMsg) GetStart() *Attribute {
+	if m != nil {
+		return m.Start
+	}
+	return nil
+}
+
+func (m *IndexQueryMsg) GetEnd() *Attribute {
+	if m != nil {
+		return m.End
+	}
+	return nil
+}
+
+func (m *IndexQueryMsg) GetKeysOnly() bool {
+	if m != nil {
+		return m.KeysOnly
+	}
+	return false
+}
+
+func (m *IndexQueryMsg) GetMaxStaleness() *Staleness {
+	if m != nil {
+		return m.MaxStaleness
+	}
+	return nil
+}
+
+func (m *IndexQueryMsg) GetTable() string {
+	if m != nil {
+		return m.Table
+	}
+	return ""
+}
+
+// TableMsg names a table. The name is empty for the default table.
+type TableMsg struct {
+	Name                 string   `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *TableMsg) Reset()         { *m = TableMsg{} }
+func (m *TableMsg) String() string { return proto.CompactTextString(m) }
+func (*TableMsg) ProtoMessage()    {}
+func (*TableMsg) Descriptor() ([]byte, []int) {
+	return fileDescriptor_748391160b9263c4, []int{23}
+}
+
+func (m *TableMsg) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TableMsg.Unmarshal(m, b)
+}
+func (m *TableMsg) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TableMsg.Marshal(b, m, deterministic)
+}
+func (m *TableMsg) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TableMsg.Merge(m, src)
+}
+func (m *TableMsg) XXX_Size() int {
+	return xxx_messageInfo_TableMsg.Size(m)
+}
+func (m *TableMsg) XXX_DiscardUnknown() {
+	xxx_messageInfo_TableMsg.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TableMsg proto.InternalMessageInfo
+
+func (m *TableMsg) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+type TablesMsg struct {
+	Names                []string `protobuf:"bytes,1,rep,name=names,proto3" json:"names,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *TablesMsg) Reset()         { *m = TablesMsg{} }
+func (m *TablesMsg) String() string { return proto.CompactTextString(m) }
+func (*TablesMsg) ProtoMessage()    {}
+func (*TablesMsg) Descriptor() ([]byte, []int) {
+	return fileDescriptor_748391160b9263c4, []int{24}
+}
+
+func (m *TablesMsg) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TablesMsg.Unmarshal(m, b)
+}
+func (m *TablesMsg) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TablesMsg.Marshal(b, m, deterministic)
+}
+func (m *TablesMsg) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TablesMsg.Merge(m, src)
+}
+func (m *TablesMsg) XXX_Size() int {
+	return xxx_messageInfo_TablesMsg.Size(m)
+}
+func (m *TablesMsg) XXX_DiscardUnknown() {
+	xxx_messageInfo_TablesMsg.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TablesMsg proto.InternalMessageInfo
+
+func (m *TablesMsg) GetNames() []string {
+	if m != nil {
+		return m.Names
+	}
+	return nil
+}
+
+type SchemaField struct {
+	Name string         `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Type Attribute_Type `protobuf:"varint,2,opt,name=type,proto3,enum=simpledb.Attribute_Type" json:"type,omitempty"`
+	// required fields must be present unless they have a default
+	Required bool `protobuf:"varint,3,opt,name=required,proto3" json:"required,omitempty"`
+	// default is set on entries missing the field. Its name is ignored.
+	Default              *Attribute `protobuf:"bytes,4,opt,name=default,proto3" json:"default,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}   `json:"-"`
+	XXX_unrecognized     []byte     `json:"-"`
+	XXX_sizecache        int32      `json:"-"`
+}
+
+func (m *SchemaField) Reset()         { *m = SchemaField{} }
+func (m *SchemaField) String() string { return proto.CompactTextString(m) }
+func (*SchemaField) ProtoMessage()    {}
+func (*SchemaField) Descriptor() ([]byte, []int) {
+	return fileDescriptor_748391160b9263c4, []int{25}
+}
+
+func (m *SchemaField) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SchemaField.Unmarshal(m, b)
+}
+func (m *SchemaField) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SchemaField.Marshal(b, m, deterministic)
+}
+func (m *SchemaField) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SchemaField.Merge(m, src)
+}
+func (m *SchemaField) XXX_Size() int {
+	return xxx_messageInfo_SchemaField.Size(m)
+}
+func (m *SchemaField) XXX_DiscardUnknown() {
+	xxx_messageInfo_SchemaField.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SchemaField proto.InternalMessageInfo
+
+func (m *SchemaField) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *SchemaField) GetType() Attribute_Type {
+	if m != nil {
+		return m.Type
+	}
+	return Attribute_BOOL
+}
+
+func (m *SchemaField) GetRequired() bool {
+	if m != nil {
+		return m.Required
+	}
+	return false
+}
+
+func (m *SchemaField) GetDefault() *Attribute {
+	if m != nil {
+		return m.Default
+	}
+	return nil
+}
+
+// SchemaMsg is the schema of the keys of a table starting with prefix. The
+// schema with the longest matching prefix applies to a key.
+type SchemaMsg struct {
+	// table is empty for the default table
+	Table  string         `protobuf:"bytes,1,opt,name=table,proto3" json:"table,omitempty"`
+	Prefix string         `protobuf:"bytes,2,opt,name=prefix,proto3" json:"prefix,omitempty"`
+	Fields []*SchemaField `protobuf:"bytes,3,rep,name=fields,proto3" json:"fields,omitempty"`
+	// strict schemas reject attributes that are not fields
+	Strict               bool     `protobuf:"varint,4,opt,name=strict,proto3" json:"strict,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SchemaMsg) Reset()         { *m = SchemaMsg{} }
+func (m *SchemaMsg) String() string { return proto.CompactTextString(m) }
+func (*SchemaMsg) ProtoMessage()    {}
+func (*SchemaMsg) Descriptor() ([]byte, []int) {
+	return fileDescriptor_748391160b9263c4, []int{26}
+}
+
+func (m *SchemaMsg) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SchemaMsg.Unmarshal(m, b)
+}
+func (m *SchemaMsg) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SchemaMsg.Marshal(b, m, deterministic)
+}
+func (m *SchemaMsg) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SchemaMsg.Merge(m, src)
+}
+func (m *SchemaMsg) XXX_Size() int {
+	return xxx_messageInfo_SchemaMsg.Size(m)
+}
+func (m *SchemaMsg) XXX_DiscardUnknown() {
+	xxx_messageInfo_SchemaMsg.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SchemaMsg proto.InternalMessageInfo
+
+func (m *SchemaMsg) GetTable() string {
+	if m != nil {
+		return m.Table
+	}
+	return ""
+}
+
+func (m *SchemaMsg) GetPrefix() string {
+	if m != nil {
+		return m.Prefix
+	}
+	return ""
+}
+
+func (m *SchemaMsg) GetFields() []*SchemaField {
+	if m != nil {
+		return m.Fields
+	}
+	return nil
+}
+
+func (m *SchemaMsg) GetStrict() bool {
+	if m != nil {
+		return m.Strict
+	}
+	return false
+}
+
+type SchemasMsg struct {
+	Schemas              []*SchemaMsg `protobuf:"bytes,1,rep,name=schemas,proto3" json:"schemas,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}     `json:"-"`
+	XXX_unrecognized     []byte       `json:"-"`
+	XXX_sizecache        int32        `json:"-"`
+}
+
+func (m *SchemasMsg) Reset()         { *m = SchemasMsg{} }
+func (m *SchemasMsg) String() string { return proto.CompactTextString(m) }
+func (*SchemasMsg) ProtoMessage()    {}
+func (*SchemasMsg) Descriptor() ([]byte, []int) {
+	return fileDescriptor_748391160b9263c4, []int{27}
+}
+
+func (m *SchemasMsg) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SchemasMsg.Unmarshal(m, b)
+}
+func (m *SchemasMsg) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SchemasMsg.Marshal(b, m, deterministic)
+}
+func (m *SchemasMsg) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SchemasMsg.Merge(m, src)
+}
+func (m *SchemasMsg) XXX_Size() int {
+	return xxx_messageInfo_SchemasMsg.Size(m)
+}
+func (m *SchemasMsg) XXX_DiscardUnknown() {
+	xxx_messageInfo_SchemasMsg.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SchemasMsg proto.InternalMessageInfo
+
+func (m *SchemasMsg) GetSchemas() []*SchemaMsg {
+	if m != nil {
+		return m.Schemas
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterEnum("simpledb.Attribute_Type", Attribute_Type_name, Attribute_Type_value)
+	proto.RegisterEnum("simpledb.ServerStatus_Suffrage", ServerStatus_Suffrage_name, ServerStatus_Suffrage_value)
+	proto.RegisterType((*Staleness)(nil), "simpledb.Staleness")
+	proto.RegisterType((*ReadMsg)(nil), "simpledb.ReadMsg")
+	proto.RegisterType((*ScanMsg)(nil), "simpledb.ScanMsg")
+	proto.RegisterType((*KeyRangeMsg)(nil), "simpledb.KeyRangeMsg")
+	proto.RegisterType((*EntriesMsg)(nil), "simpledb.EntriesMsg")
+	proto.RegisterType((*Attribute)(nil), "simpledb.Attribute")
+	proto.RegisterType((*Entry)(nil), "simpledb.Entry")
+	proto.RegisterType((*OkMsg)(nil), "simpledb.OkMsg")
+	proto.RegisterType((*KeyMsg)(nil), "simpledb.KeyMsg")
+	proto.RegisterType((*RangeMsg)(nil), "simpledb.RangeMsg")
+	proto.RegisterType((*PrefixMsg)(nil), "simpledb.PrefixMsg")
+	proto.RegisterType((*CountMsg)(nil), "simpledb.CountMsg")
+	proto.RegisterType((*RequestId)(nil), "simpledb.RequestId")
+	proto.RegisterType((*EmptyMsg)(nil), "simpledb.EmptyMsg")
+	proto.RegisterType((*ServerMsg)(nil), "simpledb.ServerMsg")
+	proto.RegisterType((*ServerStatus)(nil), "simpledb.ServerStatus")
+	proto.RegisterType((*StatusMsg)(nil), "simpledb.StatusMsg")
+	proto.RegisterType((*ProgressMsg)(nil), "simpledb.ProgressMsg")
+	proto.RegisterType((*MemberMsg)(nil), "simpledb.MemberMsg")
+	proto.RegisterType((*IndexMsg)(nil), "simpledb.IndexMsg")
+	proto.RegisterType((*IndexInfo)(nil), "simpledb.IndexInfo")
+	proto.RegisterType((*IndexesMsg)(nil), "simpledb.IndexesMsg")
+	proto.RegisterType((*IndexQueryMsg)(nil), "simpledb.IndexQueryMsg")
+	proto.RegisterType((*TableMsg)(nil), "simpledb.TableMsg")
+	proto.RegisterType((*TablesMsg)(nil), "simpledb.TablesMsg")
+	proto.RegisterType((*SchemaField)(nil), "simpledb.SchemaField")
+	proto.RegisterType((*SchemaMsg)(nil), "simpledb.SchemaMsg")
+	proto.RegisterType((*SchemasMsg)(nil), "simpledb.SchemasMsg")
+}
+
+func init() { proto.RegisterFile("simpledb.proto", fileDescriptor_748391160b9263c4) }
+
+var fileDescriptor_748391160b9263c4 = []byte{
+	// 1679 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x58, 0x5f, 0x6f, 0xe3, 0xc6,
+	0x11, 0x37, 0xa9, 0x7f, 0xe4, 0xc8, 0xd6, 0xa9, 0x9b, 0xf3, 0x45, 0x10, 0xda, 0x44, 0x21, 0xda,
+	0x42, 0x07, 0xd4, 0x46, 0x2a, 0xc7, 0xbd, 0x34, 0x87, 0xa6, 0xf0, 0xf9, 0x7c, 0x39, 0xf7, 0x6c,
+	0xcb, 0x5d, 0x29, 0x06, 0xfa, 0x54, 0xac, 0xc4, 0x95, 0x4c, 0x98, 0x22, 0xd5, 0xe5, 0xca, 0xb0,
+	0xfa, 0xd4, 0xb7, 0xa2, 0x1f, 0xa0, 0x2f, 0xf9, 0x38, 0x45, 0x1f, 0x8b, 0x3e, 0xf5, 0xbd, 0x1f,
+	0xa4, 0x2f, 0xc5, 0xec, 0x92, 0x14, 0x45, 0xc9, 0x3e, 0x39, 0xb9, 0xb7, 0x9d, 0xd9, 0xdf, 0xec,
+	0xcc, 0xfc, 0x76, 0x77, 0x76, 0x48, 0xa8, 0x45, 0xde, 0x64, 0xea, 0x73, 0x77, 0xb0, 0x3f, 0x15,
+	0xa1, 0x0c, 0x89, 0x95, 0xc8, 0xce, 0x39, 0xd8, 0x3d, 0xc9, 0x7c, 0x1e, 0xf0, 0x28, 0x22, 0x4d,
+	0xb0, 0x26, 0xec, 0xee, 0x8c, 0x8d, 0xcf, 0xa3, 0x86, 0xd1, 0x32, 0xda, 0x05, 0x9a, 0xca, 0xe4,
+	0xa7, 0xb0, 0xa3, 0xc7, 0x27, 0x81, 0x14, 0x1e, 0x8f, 0x1a, 0x66, 0xcb, 0x68, 0x17, 0xe9, 0xb2,
+	0xd2, 0xf9, 0xa7, 0x01, 0x15, 0xca, 0x99, 0x7b, 0x1e, 0x8d, 0x49, 0x1d, 0x0a, 0x37, 0x7c, 0xae,
+	0x16, 0xb2, 0x29, 0x0e, 0xc9, 0x27, 0x00, 0x4c, 0x4a, 0xe1, 0x0d, 0x66, 0x52, 0x2d, 0x50, 0x68,
+	0xdb, 0x34, 0xa3, 0x21, 0x2f, 0x60, 0x7b, 0xc2, 0xee, 0xd2, 0x78, 0x1a, 0x85, 0x96, 0xd1, 0xae,
+	0x76, 0x3e, 0xda, 0x4f, 0xa3, 0x4f, 0xa7, 0xe8, 0x12, 0x90, 0x3c, 0x85, 0x92, 0x64, 0x03, 0x9f,
+	0x37, 0x8a, 0xca, 0x99, 0x16, 0x50, 0x3b, 0x65, 0xf2, 0x3a, 0x6a, 0x94, 0x94, 0x27, 0x2d, 0x10,
+	0x07, 0xb6, 0x7d, 0x2f, 0xe0, 0x4c, 0x78, 0x7f, 0x56, 0x26, 0xe5, 0x96, 0xd1, 0xb6, 0xe8, 0x92,
+	0xce, 0xf9, 0xce, 0x84, 0x4a, 0x6f, 0xc8, 0x02, 0x4c, 0xa3, 0x09, 0x56, 0x24, 0x99, 0x90, 0xef,
+	0xd2, 0x5c, 0x52, 0x99, 0x3c, 0x83, 0x32, 0x0f, 0x5c, 0x9c, 0x31, 0xd5, 0x4c, 0x2c, 0xe5, 0x12,
+	0x2d, 0xbc, 0x37, 0xd1, 0xe2, 0xa6, 0x89, 0x36, 0xc1, 0xba, 0xe1, 0xf3, 0xa8, 0x1b, 0xf8, 0xf3,
+	0x46, 0x49, 0x05, 0x9e, 0xca, 0x18, 0xcc, 0xc8, 0xf3, 0x25, 0x17, 0x2a, 0x25, 0x9b, 0xc6, 0xd2,
+	0x82, 0x9c, 0xca, 0x5a, 0x72, 0xac, 0x87, 0xc8, 0xb1, 0xd7, 0x90, 0xf3, 0x2f, 0x03, 0xaa, 0xef,
+	0xf8, 0x9c, 0xb2, 0x60, 0xcc, 0xbf, 0x2f, 0x41, 0xcf, 0xa0, 0x3c, 0x15, 0x7c, 0xe4, 0xdd, 0xa9,
+	0x3d, 0xb6, 0x69, 0x2c, 0x7d, 0x7f, 0x62, 0xd2, 0x24, 0x4b, 0xd9, 0x24, 0x37, 0xd9, 0xeb, 0x17,
+	0x00, 0xf1, 0xe9, 0xc5, 0x64, 0x9e, 0x43, 0x85, 0x6b, 0xa9, 0x61, 0xb4, 0x0a, 0xed, 0x6a, 0xe7,
+	0xc9, 0xc2, 0x37, 0xc2, 0xe6, 0x34, 0x99, 0x77, 0xfe, 0x63, 0x82, 0x7d, 0x94, 0xec, 0x29, 0x21,
+	0x50, 0x0c, 0xd8, 0x84, 0xc7, 0x0c, 0xa8, 0x31, 0xf9, 0x05, 0x14, 0xe5, 0x7c, 0xca, 0x55, 0xee,
+	0xb5, 0x4e, 0x63, 0xb1, 0x52, 0x6a, 0xb6, 0xdf, 0x9f, 0x4f, 0x39, 0x55, 0x28, 0x4c, 0xe1, 0x96,
+	0xf9, 0x33, 0xae, 0x28, 0xd9, 0xa6, 0x5a, 0x20, 0x9f, 0x02, 0x0c, 0xc2, 0xd0, 0xff, 0xa3, 0x9e,
+	0x42, 0x3e, 0xac, 0xb7, 0x5b, 0xd4, 0x46, 0xdd, 0x95, 0x02, 0xfc, 0x04, 0x6c, 0x2f, 0x90, 0xf1,
+	0x3c, 0x66, 0x4f, 0xde, 0x6e, 0x51, 0xcb, 0x0b, 0xe4, 0x55, 0x62, 0x3f, 0x5b, 0xcc, 0x23, 0x01,
+	0x45, 0xb4, 0x9f, 0xa5, 0x80, 0xcf, 0xa0, 0x3a, 0xf2, 0x43, 0x96, 0x20, 0xf0, 0x90, 0x18, 0x6f,
+	0xb7, 0x28, 0x28, 0xa5, 0x82, 0x38, 0x03, 0x28, 0x62, 0x9c, 0xc4, 0x82, 0xe2, 0xab, 0x6e, 0xf7,
+	0xac, 0xbe, 0x45, 0x2a, 0x50, 0x38, 0xbd, 0xe8, 0xd7, 0x0d, 0x54, 0x7d, 0x8b, 0x23, 0x93, 0xd8,
+	0x50, 0x7a, 0x73, 0xd6, 0x3d, 0xea, 0xd7, 0x0b, 0x04, 0xa0, 0xdc, 0xeb, 0xd3, 0xd3, 0x8b, 0x6f,
+	0xea, 0x45, 0x54, 0xbf, 0xfa, 0x43, 0xff, 0xa4, 0x57, 0x2f, 0xa1, 0xd1, 0xf9, 0xd1, 0x65, 0xbd,
+	0x8c, 0x46, 0x67, 0xa7, 0xbd, 0x7e, 0xbd, 0x82, 0xa3, 0xdf, 0xf5, 0xba, 0x17, 0x75, 0xeb, 0x55,
+	0x05, 0x4a, 0xc8, 0x82, 0xeb, 0xfc, 0xc3, 0x80, 0x92, 0x62, 0x7a, 0x4d, 0x01, 0x39, 0x58, 0x29,
+	0x20, 0x4b, 0x87, 0x23, 0xa5, 0x75, 0xe9, 0xb2, 0xfd, 0x12, 0x6c, 0xc1, 0xff, 0x34, 0xe3, 0x91,
+	0x3c, 0x75, 0x57, 0x4b, 0x0a, 0x4d, 0xa6, 0xe8, 0x02, 0x75, 0x4f, 0x3d, 0x79, 0x9e, 0xad, 0x27,
+	0xf7, 0x38, 0xd6, 0x08, 0xe7, 0x63, 0x28, 0x75, 0x6f, 0xf0, 0x3c, 0xd5, 0xc0, 0xec, 0xde, 0xa8,
+	0x14, 0x2c, 0x6a, 0x76, 0x6f, 0x9c, 0x21, 0x94, 0xdf, 0xf1, 0xf9, 0xfa, 0xf2, 0xb8, 0x14, 0xa8,
+	0xf9, 0xb8, 0x40, 0x0b, 0x99, 0x40, 0x9d, 0xbf, 0x1a, 0x60, 0xfd, 0xa0, 0xeb, 0xf9, 0xa1, 0x28,
+	0x73, 0x7c, 0xb0, 0x2f, 0xd5, 0xcd, 0xc6, 0x48, 0x16, 0x97, 0xde, 0x58, 0xba, 0xf4, 0x1f, 0x2c,
+	0xef, 0x16, 0x58, 0xc7, 0xe1, 0x2c, 0x90, 0xe8, 0xec, 0x29, 0x94, 0x86, 0x38, 0x56, 0xbe, 0x8a,
+	0x54, 0x0b, 0xce, 0x04, 0xec, 0x74, 0x3d, 0x64, 0x66, 0xe8, 0x7b, 0x3c, 0x40, 0xb7, 0x31, 0x33,
+	0x89, 0x8c, 0x73, 0x11, 0x02, 0x83, 0x21, 0x8f, 0x5f, 0xba, 0x54, 0x26, 0x6d, 0x78, 0x32, 0xf2,
+	0x44, 0x24, 0x4f, 0x83, 0x61, 0x88, 0x41, 0x4a, 0x1d, 0x46, 0x91, 0xe6, 0xd5, 0x0e, 0x80, 0x75,
+	0x32, 0x99, 0x4a, 0xdc, 0x6f, 0xe7, 0x10, 0xec, 0x1e, 0x17, 0xb7, 0x5c, 0xc4, 0xc7, 0xc2, 0x4b,
+	0x9c, 0x9a, 0x9e, 0x4b, 0x1a, 0x50, 0x61, 0xae, 0x2b, 0xb0, 0xe4, 0xe9, 0x9d, 0x48, 0x44, 0xe7,
+	0x6f, 0x26, 0x6c, 0x6b, 0xbb, 0x9e, 0x64, 0x72, 0x16, 0x6d, 0x6e, 0x4a, 0x5e, 0x82, 0x15, 0xcd,
+	0x46, 0x23, 0xc1, 0xc6, 0x3a, 0xc0, 0x5a, 0xe7, 0xd3, 0x4c, 0x21, 0xcd, 0xac, 0xb9, 0xdf, 0x8b,
+	0x61, 0x34, 0x35, 0xc0, 0xcd, 0xf2, 0x39, 0x73, 0xb9, 0xd0, 0x35, 0x87, 0xc6, 0x12, 0x69, 0x41,
+	0xd5, 0x67, 0x91, 0x3c, 0x0e, 0x03, 0xc9, 0x86, 0x52, 0x15, 0x9c, 0x02, 0xcd, 0xaa, 0xc8, 0xcf,
+	0xa1, 0x26, 0xf8, 0xd4, 0xf7, 0x86, 0x4c, 0x7a, 0x61, 0x70, 0xc6, 0xc6, 0xaa, 0xea, 0x14, 0x68,
+	0x4e, 0xeb, 0x7c, 0x0e, 0x56, 0xe2, 0x17, 0xab, 0xc4, 0x55, 0xb7, 0x7f, 0x42, 0xeb, 0x5b, 0x64,
+	0x1b, 0xac, 0x8b, 0xee, 0x85, 0x96, 0x0c, 0x52, 0x85, 0x4a, 0xaf, 0x7f, 0xf4, 0x0d, 0xd6, 0x12,
+	0xd3, 0xf9, 0x9f, 0xa9, 0xba, 0x15, 0x39, 0x8b, 0xd6, 0x71, 0xf8, 0x14, 0x4a, 0x91, 0x64, 0x92,
+	0xc7, 0x34, 0x68, 0x21, 0x93, 0x47, 0xfc, 0xd2, 0xc4, 0x79, 0x10, 0x28, 0x4a, 0x2e, 0x26, 0x2a,
+	0xbb, 0x22, 0x55, 0x63, 0xcc, 0x6d, 0x18, 0x4e, 0x26, 0x9e, 0x3c, 0x0d, 0x5c, 0x7e, 0xa7, 0x72,
+	0x2b, 0xd2, 0xac, 0x0a, 0x1f, 0x14, 0x36, 0x9d, 0xfa, 0x1e, 0x77, 0x35, 0x44, 0xd5, 0x53, 0xba,
+	0xa4, 0x23, 0x9f, 0x43, 0x25, 0x52, 0xe4, 0x46, 0x8d, 0x8a, 0x2a, 0x14, 0xcf, 0xd6, 0xb3, 0x4e,
+	0x13, 0x18, 0xb6, 0x0b, 0x62, 0x3a, 0x3c, 0x8a, 0x77, 0xd1, 0x52, 0x71, 0x66, 0x34, 0x6b, 0x18,
+	0xb5, 0x95, 0xdf, 0x9c, 0x16, 0x71, 0x23, 0xce, 0xe4, 0x4c, 0xf0, 0x2b, 0x2e, 0x22, 0x2f, 0x0c,
+	0x1a, 0xd0, 0x32, 0xda, 0x3b, 0x34, 0xa7, 0x25, 0x5f, 0xc0, 0xee, 0xd0, 0x9f, 0x45, 0x92, 0x8b,
+	0x37, 0xcb, 0xf0, 0xaa, 0x82, 0xaf, 0x9f, 0x74, 0x7a, 0x50, 0xbd, 0x14, 0xe1, 0x18, 0x23, 0x42,
+	0xfa, 0xf3, 0x54, 0x18, 0x6b, 0xa8, 0xc8, 0x11, 0x6a, 0xae, 0x10, 0xea, 0x0c, 0xc1, 0x3e, 0xe7,
+	0x93, 0xc1, 0xfa, 0x5b, 0xb1, 0xcc, 0x8b, 0xb9, 0x8e, 0x97, 0x5c, 0xbe, 0x85, 0x75, 0xf9, 0x3a,
+	0x5f, 0x83, 0xa5, 0xbc, 0xa1, 0x8f, 0x1f, 0x83, 0x9d, 0xbe, 0x0d, 0xb1, 0xab, 0x85, 0x62, 0x51,
+	0x57, 0xcc, 0x6c, 0x5d, 0xf9, 0x2d, 0xd8, 0xca, 0xfe, 0x34, 0x18, 0x85, 0xef, 0x5f, 0x40, 0x70,
+	0xe6, 0xea, 0x82, 0x6a, 0x51, 0x2d, 0x38, 0x2f, 0x01, 0xd4, 0x02, 0xba, 0xc7, 0xd8, 0x83, 0x8a,
+	0xa7, 0xa5, 0xb8, 0xc7, 0xc8, 0x54, 0xbb, 0xd4, 0x0f, 0x4d, 0x30, 0xce, 0xdf, 0x4d, 0xd8, 0x51,
+	0xea, 0xdf, 0xcf, 0xb8, 0x98, 0xbf, 0x3f, 0x87, 0xe7, 0x49, 0x1f, 0xb1, 0x52, 0x4a, 0x33, 0xcf,
+	0x94, 0x42, 0x20, 0x54, 0xbd, 0x05, 0x8d, 0xc2, 0x03, 0x50, 0x85, 0x20, 0x3f, 0x83, 0x02, 0x0f,
+	0xdc, 0x46, 0xf1, 0x7e, 0x20, 0xce, 0x3f, 0xd8, 0xa0, 0xe6, 0x9b, 0xbb, 0xf2, 0xa3, 0x9b, 0xbb,
+	0x6c, 0x07, 0xeb, 0x7c, 0x02, 0x56, 0x1f, 0x07, 0xc8, 0xc8, 0x9a, 0xee, 0xcb, 0xf9, 0x0c, 0x6c,
+	0x35, 0x1f, 0xc5, 0xcf, 0x01, 0x2a, 0x35, 0xe3, 0x36, 0xd5, 0x82, 0xf3, 0x9d, 0x01, 0xd5, 0xde,
+	0xf0, 0x9a, 0x4f, 0xd8, 0x1b, 0x8f, 0xfb, 0xee, 0x07, 0x68, 0xe2, 0x9a, 0x60, 0xe1, 0x2b, 0xe5,
+	0x09, 0xae, 0x1f, 0x4e, 0x8b, 0xa6, 0x32, 0xee, 0xbb, 0xcb, 0x47, 0x6c, 0xe6, 0xcb, 0x87, 0x68,
+	0x4c, 0x30, 0xce, 0x5f, 0x0c, 0xb0, 0x75, 0x70, 0x71, 0x02, 0x9a, 0x03, 0x23, 0xdb, 0x92, 0x2c,
+	0x9e, 0x54, 0x73, 0xe9, 0x49, 0xdd, 0xc3, 0x6f, 0x01, 0xee, 0xbb, 0xfa, 0xe3, 0xa3, 0xda, 0xd9,
+	0xcd, 0x90, 0xbc, 0xc8, 0x97, 0xc6, 0x20, 0x5c, 0x26, 0x92, 0xc2, 0x1b, 0xca, 0xa4, 0xd8, 0x6b,
+	0x09, 0xcf, 0xad, 0x86, 0x27, 0xe7, 0x36, 0xd2, 0xd2, 0xea, 0xb9, 0x4d, 0x03, 0xa5, 0x09, 0xa6,
+	0xf3, 0xdf, 0x0a, 0x58, 0x3d, 0x35, 0xff, 0x7a, 0x40, 0xf6, 0xf4, 0x77, 0x21, 0xbd, 0x3c, 0x26,
+	0x3f, 0xca, 0xbe, 0xed, 0xea, 0x53, 0xb1, 0x99, 0x6f, 0xb2, 0x49, 0x47, 0x7f, 0x7f, 0xe5, 0xe0,
+	0xf1, 0x27, 0x59, 0xf3, 0xe9, 0x32, 0xdc, 0x4b, 0xae, 0x95, 0xfd, 0xed, 0xd4, 0x65, 0x92, 0xa3,
+	0x55, 0x7e, 0xc5, 0xac, 0x0b, 0xdd, 0x99, 0xed, 0xe1, 0xa5, 0x8e, 0xb8, 0x90, 0x9b, 0xc1, 0xf7,
+	0xc1, 0x7e, 0xcd, 0xf1, 0x51, 0x47, 0x78, 0x7d, 0x31, 0xab, 0xbb, 0xb9, 0x55, 0xfc, 0x97, 0x50,
+	0x8b, 0xf1, 0xd8, 0x88, 0xa1, 0x11, 0xc9, 0xe4, 0x1d, 0x37, 0x67, 0xcd, 0x8c, 0x2e, 0xed, 0x5c,
+	0xbe, 0x82, 0x27, 0xda, 0x52, 0x77, 0x4e, 0x68, 0x9a, 0x21, 0x3a, 0x6d, 0xa7, 0xd6, 0xda, 0x1e,
+	0xc6, 0x1d, 0x10, 0x1a, 0xed, 0x2e, 0x05, 0xf9, 0xa0, 0xcb, 0x43, 0xa8, 0x1d, 0x0b, 0xce, 0x24,
+	0x57, 0x75, 0x26, 0x17, 0x6c, 0x52, 0x3a, 0x57, 0x73, 0x3c, 0x80, 0xed, 0xd7, 0x22, 0x9c, 0x3e,
+	0xce, 0xe8, 0x2b, 0xa8, 0x9d, 0x79, 0x91, 0x8c, 0xeb, 0x61, 0xce, 0x2c, 0xb9, 0xd0, 0xd9, 0x2d,
+	0xce, 0x54, 0xce, 0xaf, 0x61, 0x47, 0x15, 0xc1, 0xd4, 0xe3, 0xc7, 0x39, 0x58, 0x52, 0x22, 0xef,
+	0x39, 0x22, 0x69, 0x9e, 0xca, 0xcf, 0x7d, 0xbe, 0xef, 0xcb, 0xf3, 0x71, 0x46, 0x5f, 0xc2, 0x0e,
+	0xe6, 0xa9, 0x00, 0xf9, 0x34, 0x93, 0xa6, 0xb0, 0xf9, 0x51, 0x6e, 0x25, 0x15, 0xe5, 0x17, 0xd8,
+	0xf1, 0x49, 0x7d, 0xa3, 0x72, 0xbb, 0x9f, 0x5e, 0xb3, 0x55, 0x7f, 0x87, 0xb0, 0x83, 0x41, 0x3e,
+	0xd6, 0x2c, 0xde, 0x0e, 0x8d, 0xd8, 0x64, 0x3b, 0x16, 0x05, 0xa1, 0xf3, 0xef, 0x02, 0x94, 0x8e,
+	0xdc, 0x89, 0x87, 0x1d, 0x45, 0xdc, 0x98, 0x6d, 0x90, 0xe8, 0xa2, 0x83, 0xfb, 0x0d, 0xec, 0xf6,
+	0x05, 0x0b, 0xa2, 0x11, 0x17, 0x67, 0xaa, 0x2b, 0x8b, 0xae, 0xbd, 0x69, 0x3e, 0xf4, 0xa4, 0x67,
+	0x5e, 0x0d, 0xfd, 0xd7, 0x40, 0xfa, 0xc2, 0x1b, 0x8f, 0xb9, 0xe8, 0x05, 0x6c, 0x1a, 0x5d, 0x87,
+	0xf2, 0x3e, 0xef, 0x2b, 0xa6, 0x2f, 0xe0, 0x09, 0xe5, 0x93, 0xf0, 0x96, 0xeb, 0xe5, 0x37, 0xf7,
+	0xf9, 0x2b, 0xa8, 0x1d, 0xb9, 0xee, 0x45, 0x18, 0xdc, 0x86, 0xf2, 0x31, 0x76, 0x1d, 0x80, 0x4b,
+	0x11, 0x4e, 0x42, 0xc9, 0x37, 0xb7, 0x39, 0x80, 0x2a, 0xe5, 0x63, 0x2f, 0x5a, 0x75, 0x94, 0xb6,
+	0x4c, 0xab, 0x46, 0x2f, 0x17, 0x5d, 0x5a, 0xae, 0x08, 0x64, 0x9a, 0xb7, 0xe6, 0x7a, 0xf5, 0xa0,
+	0xac, 0x7e, 0x0f, 0x1e, 0xfc, 0x7f, 0x00, 0x92, 0xf2, 0xb4, 0xc6, 0x30, 0x14, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// SimpleDbClient is the client API for SimpleDb service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type SimpleDbClient interface {
+	ReadRPC(ctx context.Context, in *ReadMsg, opts ...grpc.CallOption) (*Entry, error)
+	ScanRPC(ctx context.Context, in *ScanMsg, opts ...grpc.CallOption) (*EntriesMsg, error)
+	UpdateRPC(ctx context.Context, in *Entry, opts ...grpc.CallOption) (*OkMsg, error)
+	InsertRPC(ctx context.Context, in *Entry, opts ...grpc.CallOption) (*OkMsg, error)
+	DeleteRPC(ctx context.Context, in *KeyMsg, opts ...grpc.CallOption) (*OkMsg, error)
+	DeleteRangeRPC(ctx context.Context, in *RangeMsg, opts ...grpc.CallOption) (*CountMsg, error)
+	DeletePrefixRPC(ctx context.Context, in *PrefixMsg, opts ...grpc.CallOption) (*CountMsg, error)
+	CountRPC(ctx context.Context, in *KeyRangeMsg, opts ...grpc.CallOption) (*CountMsg, error)
+	CreateIndexRPC(ctx context.Context, in *IndexMsg, opts ...grpc.CallOption) (*OkMsg, error)
+	DropIndexRPC(ctx context.Context, in *IndexMsg, opts ...grpc.CallOption) (*OkMsg, error)
+	ListIndexesRPC(ctx context.Context, in *TableMsg, opts ...grpc.CallOption) (*IndexesMsg, error)
+	QueryIndexRPC(ctx context.Context, in *IndexQueryMsg, opts ...grpc.CallOption) (*EntriesMsg, error)
+	CreateTableRPC(ctx context.Context, in *TableMsg, opts ...grpc.CallOption) (*OkMsg, error)
+	DropTableRPC(ctx context.Context, in *TableMsg, opts ...grpc.CallOption) (*OkMsg, error)
+	ListTablesRPC(ctx context.Context, in *EmptyMsg, opts ...grpc.CallOption) (*TablesMsg, error)
+	SetSchemaRPC(ctx context.Context, in *SchemaMsg, opts ...grpc.CallOption) (*OkMsg, error)
+	DropSchemaRPC(ctx context.Context, in *SchemaMsg, opts ...grpc.CallOption) (*OkMsg, error)
+	ListSchemasRPC(ctx context.Context, in *TableMsg, opts ...grpc.CallOption) (*SchemasMsg, error)
+}
+
+type simpleDbClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewSimpleDbClient(cc *grpc.ClientConn) SimpleDbClient {
+	return &simpleDbClient{cc}
+}
+
+func (c *simpleDbClient) ReadRPC(ctx context.Context, in *ReadMsg, opts ...grpc.CallOption) (*Entry, error) {
+	out := new(Entry)
+	err := c.cc.Invoke(ctx, "/simpledb.SimpleDb/ReadRPC", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simpleDbClient) ScanRPC(ctx context.Context, in *ScanMsg, opts ...grpc.CallOption) (*EntriesMsg, error) {
+	out := new(EntriesMsg)
 	err := c.cc.Invoke(ctx, "/simpledb.SimpleDb/ScanRPC", in, out, opts...)
 	if err != nil {
 		return nil, err
@@ -471,179 +2080,958 @@ func (c *simpleDbClient) ScanRPC(ctx context.Context, in *ScanMsg, opts ...grpc.
 	return out, nil
 }
 
-func (c *simpleDbClient) UpdateRPC(ctx context.Context, in *Entry, opts ...grpc.CallOption) (*OkMsg, error) {
+func (c *simpleDbClient) UpdateRPC(ctx context.Context, in *Entry, opts ...grpc.CallOption) (*OkMsg, error) {
+	out := new(OkMsg)
+	err := c.cc.Invoke(ctx, "/simpledb.SimpleDb/UpdateRPC", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simpleDbClient) InsertRPC(ctx context.Context, in *Entry, opts ...grpc.CallOption) (*OkMsg, error) {
+	out := new(OkMsg)
+	err := c.cc.Invoke(ctx, "/simpledb.SimpleDb/InsertRPC", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simpleDbClient) DeleteRPC(ctx context.Context, in *KeyMsg, opts ...grpc.CallOption) (*OkMsg, error) {
+	out := new(OkMsg)
+	err := c.cc.Invoke(ctx, "/simpledb.SimpleDb/DeleteRPC", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simpleDbClient) DeleteRangeRPC(ctx context.Context, in *RangeMsg, opts ...grpc.CallOption) (*CountMsg, error) {
+	out := new(CountMsg)
+	err := c.cc.Invoke(ctx, "/simpledb.SimpleDb/DeleteRangeRPC", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simpleDbClient) DeletePrefixRPC(ctx context.Context, in *PrefixMsg, opts ...grpc.CallOption) (*CountMsg, error) {
+	out := new(CountMsg)
+	err := c.cc.Invoke(ctx, "/simpledb.SimpleDb/DeletePrefixRPC", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simpleDbClient) CountRPC(ctx context.Context, in *KeyRangeMsg, opts ...grpc.CallOption) (*CountMsg, error) {
+	out := new(CountMsg)
+	err := c.cc.Invoke(ctx, "/simpledb.SimpleDb/CountRPC", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simpleDbClient) CreateIndexRPC(ctx context.Context, in *IndexMsg, opts ...grpc.CallOption) (*OkMsg, error) {
+	out := new(OkMsg)
+	err := c.cc.Invoke(ctx, "/simpledb.SimpleDb/CreateIndexRPC", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simpleDbClient) DropIndexRPC(ctx context.Context, in *IndexMsg, opts ...grpc.CallOption) (*OkMsg, error) {
+	out := new(OkMsg)
+	err := c.cc.Invoke(ctx, "/simpledb.SimpleDb/DropIndexRPC", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simpleDbClient) ListIndexesRPC(ctx context.Context, in *TableMsg, opts ...grpc.CallOption) (*IndexesMsg, error) {
+	out := new(IndexesMsg)
+	err := c.cc.Invoke(ctx, "/simpledb.SimpleDb/ListIndexesRPC", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simpleDbClient) QueryIndexRPC(ctx context.Context, in *IndexQueryMsg, opts ...grpc.CallOption) (*EntriesMsg, error) {
+	out := new(EntriesMsg)
+	err := c.cc.Invoke(ctx, "/simpledb.SimpleDb/QueryIndexRPC", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simpleDbClient) CreateTableRPC(ctx context.Context, in *TableMsg, opts ...grpc.CallOption) (*OkMsg, error) {
+	out := new(OkMsg)
+	err := c.cc.Invoke(ctx, "/simpledb.SimpleDb/CreateTableRPC", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simpleDbClient) DropTableRPC(ctx context.Context, in *TableMsg, opts ...grpc.CallOption) (*OkMsg, error) {
+	out := new(OkMsg)
+	err := c.cc.Invoke(ctx, "/simpledb.SimpleDb/DropTableRPC", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simpleDbClient) ListTablesRPC(ctx context.Context, in *EmptyMsg, opts ...grpc.CallOption) (*TablesMsg, error) {
+	out := new(TablesMsg)
+	err := c.cc.Invoke(ctx, "/simpledb.SimpleDb/ListTablesRPC", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simpleDbClient) SetSchemaRPC(ctx context.Context, in *SchemaMsg, opts ...grpc.CallOption) (*OkMsg, error) {
+	out := new(OkMsg)
+	err := c.cc.Invoke(ctx, "/simpledb.SimpleDb/SetSchemaRPC", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simpleDbClient) DropSchemaRPC(ctx context.Context, in *SchemaMsg, opts ...grpc.CallOption) (*OkMsg, error) {
+	out := new(OkMsg)
+	err := c.cc.Invoke(ctx, "/simpledb.SimpleDb/DropSchemaRPC", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simpleDbClient) ListSchemasRPC(ctx context.Context, in *TableMsg, opts ...grpc.CallOption) (*SchemasMsg, error) {
+	out := new(SchemasMsg)
+	err := c.cc.Invoke(ctx, "/simpledb.SimpleDb/ListSchemasRPC", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SimpleDbServer is the server API for SimpleDb service.
+type SimpleDbServer interface {
+	ReadRPC(context.Context, *ReadMsg) (*Entry, error)
+	ScanRPC(context.Context, *ScanMsg) (*EntriesMsg, error)
+	UpdateRPC(context.Context, *Entry) (*OkMsg, error)
+	InsertRPC(context.Context, *Entry) (*OkMsg, error)
+	DeleteRPC(context.Context, *KeyMsg) (*OkMsg, error)
+	DeleteRangeRPC(context.Context, *RangeMsg) (*CountMsg, error)
+	DeletePrefixRPC(context.Context, *PrefixMsg) (*CountMsg, error)
+	CountRPC(context.Context, *KeyRangeMsg) (*CountMsg, error)
+	CreateIndexRPC(context.Context, *IndexMsg) (*OkMsg, error)
+	DropIndexRPC(context.Context, *IndexMsg) (*OkMsg, error)
+	ListIndexesRPC(context.Context, *TableMsg) (*IndexesMsg, error)
+	QueryIndexRPC(context.Context, *IndexQueryMsg) (*EntriesMsg, error)
+	CreateTableRPC(context.Context, *TableMsg) (*OkMsg, error)
+	DropTableRPC(context.Context, *TableMsg) (*OkMsg, error)
+	ListTablesRPC(context.Context, *EmptyMsg) (*TablesMsg, error)
+	SetSchemaRPC(context.Context, *SchemaMsg) (*OkMsg, error)
+	DropSchemaRPC(context.Context, *SchemaMsg) (*OkMsg, error)
+	ListSchemasRPC(context.Context, *TableMsg) (*SchemasMsg, error)
+}
+
+// UnimplementedSimpleDbServer can be embedded to have forward compatible implementations.
+type UnimplementedSimpleDbServer struct {
+}
+
+func (*UnimplementedSimpleDbServer) ReadRPC(ctx context.Context, req *ReadMsg) (*Entry, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReadRPC not implemented")
+}
+func (*UnimplementedSimpleDbServer) ScanRPC(ctx context.Context, req *ScanMsg) (*EntriesMsg, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ScanRPC not implemented")
+}
+func (*UnimplementedSimpleDbServer) UpdateRPC(ctx context.Context, req *Entry) (*OkMsg, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateRPC not implemented")
+}
+func (*UnimplementedSimpleDbServer) InsertRPC(ctx context.Context, req *Entry) (*OkMsg, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method InsertRPC not implemented")
+}
+func (*UnimplementedSimpleDbServer) DeleteRPC(ctx context.Context, req *KeyMsg) (*OkMsg, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteRPC not implemented")
+}
+func (*UnimplementedSimpleDbServer) DeleteRangeRPC(ctx context.Context, req *RangeMsg) (*CountMsg, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteRangeRPC not implemented")
+}
+func (*UnimplementedSimpleDbServer) DeletePrefixRPC(ctx context.Context, req *PrefixMsg) (*CountMsg, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeletePrefixRPC not implemented")
+}
+func (*UnimplementedSimpleDbServer) CountRPC(ctx context.Context, req *KeyRangeMsg) (*CountMsg, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CountRPC not implemented")
+}
+func (*UnimplementedSimpleDbServer) CreateIndexRPC(ctx context.Context, req *IndexMsg) (*OkMsg, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateIndexRPC not implemented")
+}
+func (*UnimplementedSimpleDbServer) DropIndexRPC(ctx context.Context, req *IndexMsg) (*OkMsg, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DropIndexRPC not implemented")
+}
+func (*UnimplementedSimpleDbServer) ListIndexesRPC(ctx context.Context, req *TableMsg) (*IndexesMsg, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListIndexesRPC not implemented")
+}
+func (*UnimplementedSimpleDbServer) QueryIndexRPC(ctx context.Context, req *IndexQueryMsg) (*EntriesMsg, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method QueryIndexRPC not implemented")
+}
+func (*UnimplementedSimpleDbServer) CreateTableRPC(ctx context.Context, req *TableMsg) (*OkMsg, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateTableRPC not implemented")
+}
+func (*UnimplementedSimpleDbServer) DropTableRPC(ctx context.Context, req *TableMsg) (*OkMsg, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DropTableRPC not implemented")
+}
+func (*UnimplementedSimpleDbServer) ListTablesRPC(ctx context.Context, req *EmptyMsg) (*TablesMsg, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListTablesRPC not implemented")
+}
+func (*UnimplementedSimpleDbServer) SetSchemaRPC(ctx context.Context, req *SchemaMsg) (*OkMsg, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetSchemaRPC not implemented")
+}
+func (*UnimplementedSimpleDbServer) DropSchemaRPC(ctx context.Context, req *SchemaMsg) (*OkMsg, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DropSchemaRPC not implemented")
+}
+func (*UnimplementedSimpleDbServer) ListSchemasRPC(ctx context.Context, req *TableMsg) (*SchemasMsg, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListSchemasRPC not implemented")
+}
+
+func RegisterSimpleDbServer(s *grpc.Server, srv SimpleDbServer) {
+	s.RegisterService(&_SimpleDb_serviceDesc, srv)
+}
+
+func _SimpleDb_ReadRPC_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReadMsg)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimpleDbServer).ReadRPC(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/simpledb.SimpleDb/ReadRPC",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimpleDbServer).ReadRPC(ctx, req.(*ReadMsg))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SimpleDb_ScanRPC_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScanMsg)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimpleDbServer).ScanRPC(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/simpledb.SimpleDb/ScanRPC",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimpleDbServer).ScanRPC(ctx, req.(*ScanMsg))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SimpleDb_UpdateRPC_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Entry)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimpleDbServer).UpdateRPC(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/simpledb.SimpleDb/UpdateRPC",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimpleDbServer).UpdateRPC(ctx, req.(*Entry))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SimpleDb_InsertRPC_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Entry)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimpleDbServer).InsertRPC(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/simpledb.SimpleDb/InsertRPC",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimpleDbServer).InsertRPC(ctx, req.(*Entry))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SimpleDb_DeleteRPC_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeyMsg)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimpleDbServer).DeleteRPC(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/simpledb.SimpleDb/DeleteRPC",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimpleDbServer).DeleteRPC(ctx, req.(*KeyMsg))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SimpleDb_DeleteRangeRPC_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RangeMsg)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimpleDbServer).DeleteRangeRPC(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/simpledb.SimpleDb/DeleteRangeRPC",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimpleDbServer).DeleteRangeRPC(ctx, req.(*RangeMsg))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SimpleDb_DeletePrefixRPC_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PrefixMsg)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimpleDbServer).DeletePrefixRPC(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/simpledb.SimpleDb/DeletePrefixRPC",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimpleDbServer).DeletePrefixRPC(ctx, req.(*PrefixMsg))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SimpleDb_CountRPC_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeyRangeMsg)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimpleDbServer).CountRPC(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/simpledb.SimpleDb/CountRPC",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimpleDbServer).CountRPC(ctx, req.(*KeyRangeMsg))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SimpleDb_CreateIndexRPC_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IndexMsg)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimpleDbServer).CreateIndexRPC(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/simpledb.SimpleDb/CreateIndexRPC",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimpleDbServer).CreateIndexRPC(ctx, req.(*IndexMsg))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SimpleDb_DropIndexRPC_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IndexMsg)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimpleDbServer).DropIndexRPC(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/simpledb.SimpleDb/DropIndexRPC",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimpleDbServer).DropIndexRPC(ctx, req.(*IndexMsg))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SimpleDb_ListIndexesRPC_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TableMsg)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimpleDbServer).ListIndexesRPC(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/simpledb.SimpleDb/ListIndexesRPC",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimpleDbServer).ListIndexesRPC(ctx, req.(*TableMsg))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SimpleDb_QueryIndexRPC_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IndexQueryMsg)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimpleDbServer).QueryIndexRPC(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/simpledb.SimpleDb/QueryIndexRPC",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimpleDbServer).QueryIndexRPC(ctx, req.(*IndexQueryMsg))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SimpleDb_CreateTableRPC_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TableMsg)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimpleDbServer).CreateTableRPC(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/simpledb.SimpleDb/CreateTableRPC",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimpleDbServer).CreateTableRPC(ctx, req.(*TableMsg))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SimpleDb_DropTableRPC_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TableMsg)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimpleDbServer).DropTableRPC(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/simpledb.SimpleDb/DropTableRPC",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimpleDbServer).DropTableRPC(ctx, req.(*TableMsg))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SimpleDb_ListTablesRPC_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EmptyMsg)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimpleDbServer).ListTablesRPC(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/simpledb.SimpleDb/ListTablesRPC",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimpleDbServer).ListTablesRPC(ctx, req.(*EmptyMsg))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SimpleDb_SetSchemaRPC_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SchemaMsg)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimpleDbServer).SetSchemaRPC(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/simpledb.SimpleDb/SetSchemaRPC",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimpleDbServer).SetSchemaRPC(ctx, req.(*SchemaMsg))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SimpleDb_DropSchemaRPC_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SchemaMsg)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimpleDbServer).DropSchemaRPC(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/simpledb.SimpleDb/DropSchemaRPC",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimpleDbServer).DropSchemaRPC(ctx, req.(*SchemaMsg))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SimpleDb_ListSchemasRPC_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TableMsg)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimpleDbServer).ListSchemasRPC(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/simpledb.SimpleDb/ListSchemasRPC",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimpleDbServer).ListSchemasRPC(ctx, req.(*TableMsg))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _SimpleDb_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "simpledb.SimpleDb",
+	HandlerType: (*SimpleDbServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ReadRPC",
+			Handler:    _SimpleDb_ReadRPC_Handler,
+		},
+		{
+			MethodName: "ScanRPC",
+			Handler:    _SimpleDb_ScanRPC_Handler,
+		},
+		{
+			MethodName: "UpdateRPC",
+			Handler:    _SimpleDb_UpdateRPC_Handler,
+		},
+		{
+			MethodName: "InsertRPC",
+			Handler:    _SimpleDb_InsertRPC_Handler,
+		},
+		{
+			MethodName: "DeleteRPC",
+			Handler:    _SimpleDb_DeleteRPC_Handler,
+		},
+		{
+			MethodName: "DeleteRangeRPC",
+			Handler:    _SimpleDb_DeleteRangeRPC_Handler,
+		},
+		{
+			MethodName: "DeletePrefixRPC",
+			Handler:    _SimpleDb_DeletePrefixRPC_Handler,
+		},
+		{
+			MethodName: "CountRPC",
+			Handler:    _SimpleDb_CountRPC_Handler,
+		},
+		{
+			MethodName: "CreateIndexRPC",
+			Handler:    _SimpleDb_CreateIndexRPC_Handler,
+		},
+		{
+			MethodName: "DropIndexRPC",
+			Handler:    _SimpleDb_DropIndexRPC_Handler,
+		},
+		{
+			MethodName: "ListIndexesRPC",
+			Handler:    _SimpleDb_ListIndexesRPC_Handler,
+		},
+		{
+			MethodName: "QueryIndexRPC",
+			Handler:    _SimpleDb_QueryIndexRPC_Handler,
+		},
+		{
+			MethodName: "CreateTableRPC",
+			Handler:    _SimpleDb_CreateTableRPC_Handler,
+		},
+		{
+			MethodName: "DropTableRPC",
+			Handler:    _SimpleDb_DropTableRPC_Handler,
+		},
+		{
+			MethodName: "ListTablesRPC",
+			Handler:    _SimpleDb_ListTablesRPC_Handler,
+		},
+		{
+			MethodName: "SetSchemaRPC",
+			Handler:    _SimpleDb_SetSchemaRPC_Handler,
+		},
+		{
+			MethodName: "DropSchemaRPC",
+			Handler:    _SimpleDb_DropSchemaRPC_Handler,
+		},
+		{
+			MethodName: "ListSchemasRPC",
+			Handler:    _SimpleDb_ListSchemasRPC_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "simpledb.proto",
+}
+
+// AdminClient is the client API for Admin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type AdminClient interface {
+	StatusRPC(ctx context.Context, in *EmptyMsg, opts ...grpc.CallOption) (*StatusMsg, error)
+	TransferLeadershipRPC(ctx context.Context, in *ServerMsg, opts ...grpc.CallOption) (*OkMsg, error)
+	TriggerSnapshotRPC(ctx context.Context, in *EmptyMsg, opts ...grpc.CallOption) (*OkMsg, error)
+	RemoveServerRPC(ctx context.Context, in *ServerMsg, opts ...grpc.CallOption) (*OkMsg, error)
+	AddNonvoterRPC(ctx context.Context, in *ServerMsg, opts ...grpc.CallOption) (*OkMsg, error)
+	PromoteRPC(ctx context.Context, in *ServerMsg, opts ...grpc.CallOption) (*OkMsg, error)
+	RegisterRPC(ctx context.Context, in *MemberMsg, opts ...grpc.CallOption) (*OkMsg, error)
+	ProgressRPC(ctx context.Context, in *ProgressMsg, opts ...grpc.CallOption) (*ProgressMsg, error)
+}
+
+type adminClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewAdminClient(cc *grpc.ClientConn) AdminClient {
+	return &adminClient{cc}
+}
+
+func (c *adminClient) StatusRPC(ctx context.Context, in *EmptyMsg, opts ...grpc.CallOption) (*StatusMsg, error) {
+	out := new(StatusMsg)
+	err := c.cc.Invoke(ctx, "/simpledb.Admin/StatusRPC", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) TransferLeadershipRPC(ctx context.Context, in *ServerMsg, opts ...grpc.CallOption) (*OkMsg, error) {
 	out := new(OkMsg)
-	err := c.cc.Invoke(ctx, "/simpledb.SimpleDb/UpdateRPC", in, out, opts...)
+	err := c.cc.Invoke(ctx, "/simpledb.Admin/TransferLeadershipRPC", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
-func (c *simpleDbClient) InsertRPC(ctx context.Context, in *Entry, opts ...grpc.CallOption) (*OkMsg, error) {
+func (c *adminClient) TriggerSnapshotRPC(ctx context.Context, in *EmptyMsg, opts ...grpc.CallOption) (*OkMsg, error) {
 	out := new(OkMsg)
-	err := c.cc.Invoke(ctx, "/simpledb.SimpleDb/InsertRPC", in, out, opts...)
+	err := c.cc.Invoke(ctx, "/simpledb.Admin/TriggerSnapshotRPC", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
-func (c *simpleDbClient) DeleteRPC(ctx context.Context, in *KeyMsg, opts ...grpc.CallOption) (*OkMsg, error) {
+func (c *adminClient) RemoveServerRPC(ctx context.Context, in *ServerMsg, opts ...grpc.CallOption) (*OkMsg, error) {
 	out := new(OkMsg)
-	err := c.cc.Invoke(ctx, "/simpledb.SimpleDb/DeleteRPC", in, out, opts...)
+	err := c.cc.Invoke(ctx, "/simpledb.Admin/RemoveServerRPC", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
-// SimpleDbServer is the server API for SimpleDb service.
-type SimpleDbServer interface {
-	ReadRPC(context.Context, *ReadMsg) (*Entry, error)
-	ScanRPC(context.Context, *ScanMsg) (*EntriesMsg, error)
-	UpdateRPC(context.Context, *Entry) (*OkMsg, error)
-	InsertRPC(context.Context, *Entry) (*OkMsg, error)
-	DeleteRPC(context.Context, *KeyMsg) (*OkMsg, error)
+func (c *adminClient) AddNonvoterRPC(ctx context.Context, in *ServerMsg, opts ...grpc.CallOption) (*OkMsg, error) {
+	out := new(OkMsg)
+	err := c.cc.Invoke(ctx, "/simpledb.Admin/AddNonvoterRPC", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
 }
 
-// UnimplementedSimpleDbServer can be embedded to have forward compatible implementations.
-type UnimplementedSimpleDbServer struct {
+func (c *adminClient) PromoteRPC(ctx context.Context, in *ServerMsg, opts ...grpc.CallOption) (*OkMsg, error) {
+	out := new(OkMsg)
+	err := c.cc.Invoke(ctx, "/simpledb.Admin/PromoteRPC", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
 }
 
-func (*UnimplementedSimpleDbServer) ReadRPC(ctx context.Context, req *ReadMsg) (*Entry, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method ReadRPC not implemented")
+func (c *adminClient) RegisterRPC(ctx context.Context, in *MemberMsg, opts ...grpc.CallOption) (*OkMsg, error) {
+	out := new(OkMsg)
+	err := c.cc.Invoke(ctx, "/simpledb.Admin/RegisterRPC", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
 }
-func (*UnimplementedSimpleDbServer) ScanRPC(ctx context.Context, req *ScanMsg) (*EntriesMsg, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method ScanRPC not implemented")
+
+func (c *adminClient) ProgressRPC(ctx context.Context, in *ProgressMsg, opts ...grpc.CallOption) (*ProgressMsg, error) {
+	out := new(ProgressMsg)
+	err := c.cc.Invoke(ctx, "/simpledb.Admin/ProgressRPC", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
 }
-func (*UnimplementedSimpleDbServer) UpdateRPC(ctx context.Context, req *Entry) (*OkMsg, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method UpdateRPC not implemented")
+
+// AdminServer is the server API for Admin service.
+type AdminServer interface {
+	StatusRPC(context.Context, *EmptyMsg) (*StatusMsg, error)
+	TransferLeadershipRPC(context.Context, *ServerMsg) (*OkMsg, error)
+	TriggerSnapshotRPC(context.Context, *EmptyMsg) (*OkMsg, error)
+	RemoveServerRPC(context.Context, *ServerMsg) (*OkMsg, error)
+	AddNonvoterRPC(context.Context, *ServerMsg) (*OkMsg, error)
+	PromoteRPC(context.Context, *ServerMsg) (*OkMsg, error)
+	RegisterRPC(context.Context, *MemberMsg) (*OkMsg, error)
+	ProgressRPC(context.Context, *ProgressMsg) (*ProgressMsg, error)
 }
-func (*UnimplementedSimpleDbServer) InsertRPC(ctx context.Context, req *Entry) (*OkMsg, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method InsertRPC not implemented")
+
+// UnimplementedAdminServer can be embedded to have forward compatible implementations.
+type UnimplementedAdminServer struct {
 }
-func (*UnimplementedSimpleDbServer) DeleteRPC(ctx context.Context, req *KeyMsg) (*OkMsg, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method DeleteRPC not implemented")
+
+func (*UnimplementedAdminServer) StatusRPC(ctx context.Context, req *EmptyMsg) (*StatusMsg, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StatusRPC not implemented")
+}
+func (*UnimplementedAdminServer) TransferLeadershipRPC(ctx context.Context, req *ServerMsg) (*OkMsg, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TransferLeadershipRPC not implemented")
+}
+func (*UnimplementedAdminServer) TriggerSnapshotRPC(ctx context.Context, req *EmptyMsg) (*OkMsg, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TriggerSnapshotRPC not implemented")
+}
+func (*UnimplementedAdminServer) RemoveServerRPC(ctx context.Context, req *ServerMsg) (*OkMsg, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveServerRPC not implemented")
+}
+func (*UnimplementedAdminServer) AddNonvoterRPC(ctx context.Context, req *ServerMsg) (*OkMsg, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddNonvoterRPC not implemented")
+}
+func (*UnimplementedAdminServer) PromoteRPC(ctx context.Context, req *ServerMsg) (*OkMsg, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PromoteRPC not implemented")
+}
+func (*UnimplementedAdminServer) RegisterRPC(ctx context.Context, req *MemberMsg) (*OkMsg, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RegisterRPC not implemented")
+}
+func (*UnimplementedAdminServer) ProgressRPC(ctx context.Context, req *ProgressMsg) (*ProgressMsg, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ProgressRPC not implemented")
 }
 
-func RegisterSimpleDbServer(s *grpc.Server, srv SimpleDbServer) {
-	s.RegisterService(&_SimpleDb_serviceDesc, srv)
+func RegisterAdminServer(s *grpc.Server, srv AdminServer) {
+	s.RegisterService(&_Admin_serviceDesc, srv)
 }
 
-func _SimpleDb_ReadRPC_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(ReadMsg)
+func _Admin_StatusRPC_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EmptyMsg)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(SimpleDbServer).ReadRPC(ctx, in)
+		return srv.(AdminServer).StatusRPC(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/simpledb.SimpleDb/ReadRPC",
+		FullMethod: "/simpledb.Admin/StatusRPC",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(SimpleDbServer).ReadRPC(ctx, req.(*ReadMsg))
+		return srv.(AdminServer).StatusRPC(ctx, req.(*EmptyMsg))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _SimpleDb_ScanRPC_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(ScanMsg)
+func _Admin_TransferLeadershipRPC_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ServerMsg)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(SimpleDbServer).ScanRPC(ctx, in)
+		return srv.(AdminServer).TransferLeadershipRPC(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/simpledb.SimpleDb/ScanRPC",
+		FullMethod: "/simpledb.Admin/TransferLeadershipRPC",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(SimpleDbServer).ScanRPC(ctx, req.(*ScanMsg))
+		return srv.(AdminServer).TransferLeadershipRPC(ctx, req.(*ServerMsg))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _SimpleDb_UpdateRPC_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(Entry)
+func _Admin_TriggerSnapshotRPC_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EmptyMsg)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(SimpleDbServer).UpdateRPC(ctx, in)
+		return srv.(AdminServer).TriggerSnapshotRPC(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/simpledb.SimpleDb/UpdateRPC",
+		FullMethod: "/simpledb.Admin/TriggerSnapshotRPC",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(SimpleDbServer).UpdateRPC(ctx, req.(*Entry))
+		return srv.(AdminServer).TriggerSnapshotRPC(ctx, req.(*EmptyMsg))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _SimpleDb_InsertRPC_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(Entry)
+func _Admin_RemoveServerRPC_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ServerMsg)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(SimpleDbServer).InsertRPC(ctx, in)
+		return srv.(AdminServer).RemoveServerRPC(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/simpledb.SimpleDb/InsertRPC",
+		FullMethod: "/simpledb.Admin/RemoveServerRPC",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(SimpleDbServer).InsertRPC(ctx, req.(*Entry))
+		return srv.(AdminServer).RemoveServerRPC(ctx, req.(*ServerMsg))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _SimpleDb_DeleteRPC_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(KeyMsg)
+func _Admin_AddNonvoterRPC_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ServerMsg)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(SimpleDbServer).DeleteRPC(ctx, in)
+		return srv.(AdminServer).AddNonvoterRPC(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/simpledb.SimpleDb/DeleteRPC",
+		FullMethod: "/simpledb.Admin/AddNonvoterRPC",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(SimpleDbServer).DeleteRPC(ctx, req.(*KeyMsg))
+		return srv.(AdminServer).AddNonvoterRPC(ctx, req.(*ServerMsg))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-var _SimpleDb_serviceDesc = grpc.ServiceDesc{
-	ServiceName: "simpledb.SimpleDb",
-	HandlerType: (*SimpleDbServer)(nil),
+func _Admin_PromoteRPC_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ServerMsg)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).PromoteRPC(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/simpledb.Admin/PromoteRPC",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).PromoteRPC(ctx, req.(*ServerMsg))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_RegisterRPC_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MemberMsg)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).RegisterRPC(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/simpledb.Admin/RegisterRPC",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).RegisterRPC(ctx, req.(*MemberMsg))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ProgressRPC_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ProgressMsg)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ProgressRPC(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/simpledb.Admin/ProgressRPC",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ProgressRPC(ctx, req.(*ProgressMsg))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Admin_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "simpledb.Admin",
+	HandlerType: (*AdminServer)(nil),
 	Methods: []grpc.MethodDesc{
 		{
-			MethodName: "ReadRPC",
-			Handler:    _SimpleDb_ReadRPC_Handler,
+			MethodName: "StatusRPC",
+			Handler:    _Admin_StatusRPC_Handler,
 		},
 		{
-			MethodName: "ScanRPC",
-			Handler:    _SimpleDb_ScanRPC_Handler,
+			MethodName: "TransferLeadershipRPC",
+			Handler:    _Admin_TransferLeadershipRPC_Handler,
 		},
 		{
-			MethodName: "UpdateRPC",
-			Handler:    _SimpleDb_UpdateRPC_Handler,
+			MethodName: "TriggerSnapshotRPC",
+			Handler:    _Admin_TriggerSnapshotRPC_Handler,
 		},
 		{
-			MethodName: "InsertRPC",
-			Handler:    _SimpleDb_InsertRPC_Handler,
+			MethodName: "RemoveServerRPC",
+			Handler:    _Admin_RemoveServerRPC_Handler,
 		},
 		{
-			MethodName: "DeleteRPC",
-			Handler:    _SimpleDb_DeleteRPC_Handler,
+			MethodName: "AddNonvoterRPC",
+			Handler:    _Admin_AddNonvoterRPC_Handler,
+		},
+		{
+			MethodName: "PromoteRPC",
+			Handler:    _Admin_PromoteRPC_Handler,
+		},
+		{
+			MethodName: "RegisterRPC",
+			Handler:    _Admin_RegisterRPC_Handler,
+		},
+		{
+			MethodName: "ProgressRPC",
+			Handler:    _Admin_ProgressRPC_Handler,
 		},
 	},
 	Streams:  []grpc.StreamDesc{},
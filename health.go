@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const healthCheckInterval = time.Second
+
+// healthServices are the gRPC service names reported by the health server.
+// The empty name is the overall server health.
+var healthServices = []string{"", "simpledb.SimpleDb"}
+
+// alive returns an error if the node can no longer make progress
+func (node *Node) alive() error {
+	if node.raft == nil {
+		return errors.New("raft is not initialized")
+	}
+	if node.raft.State() == raft.Shutdown {
+		return errors.New("raft is shut down")
+	}
+	return nil
+}
+
+// ready returns an error unless the node knows the leader and its applied
+// index has caught up to the commit index
+func (node *Node) ready() error {
+	if err := node.alive(); err != nil {
+		return err
+	}
+	if node.raft.Leader() == "" {
+		return errors.New("no known leader")
+	}
+	commitIndex := node.raft.CommitIndex()
+	if appliedIndex := node.raft.AppliedIndex(); appliedIndex < commitIndex {
+		return fmt.Errorf("applied index %d behind commit index %d", appliedIndex, commitIndex)
+	}
+	return nil
+}
+
+// watchHealth periodically updates the gRPC health server with the node's readiness
+func (node *Node) watchHealth() {
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			node.updateHealth()
+		case <-node.shutdownCh:
+			return
+		}
+	}
+}
+
+func (node *Node) updateHealth() {
+	status := healthpb.HealthCheckResponse_SERVING
+	if node.ready() != nil {
+		status = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	for _, service := range healthServices {
+		node.health.SetServingStatus(service, status)
+	}
+}
+
+func newHealthServer() *health.Server {
+	server := health.NewServer()
+	for _, service := range healthServices {
+		server.SetServingStatus(service, healthpb.HealthCheckResponse_NOT_SERVING)
+	}
+	return server
+}
+
+// healthzHandler serves liveness probes
+func (node *Node) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	writeProbe(w, node.alive())
+}
+
+// readyzHandler serves readiness probes
+func (node *Node) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	writeProbe(w, node.ready())
+}
+
+func writeProbe(w http.ResponseWriter, err error) {
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
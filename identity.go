@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// nodeIDFile stores the raft server ID in the data dir so that a node keeps
+// its identity across restarts even if its ip changes
+const nodeIDFile = "node-id"
+
+// resolveNodeID returns the raft server ID of the node. An ID persisted in the
+// data dir takes precedence and must match an explicitly configured one. On
+// first start the configured ID, or else the detected ip of the host, is
+// persisted.
+func resolveNodeID(config *Config) (string, error) {
+	path := filepath.Join(config.DataDir, nodeIDFile)
+	buf, err := ioutil.ReadFile(path)
+	switch {
+	case err == nil:
+		persisted := strings.TrimSpace(string(buf))
+		if config.NodeID != "" && config.NodeID != persisted {
+			return "", fmt.Errorf("node id %q does not match id %q persisted in %v", config.NodeID, persisted, path)
+		}
+		return persisted, nil
+	case !os.IsNotExist(err):
+		return "", err
+	}
+
+	id := config.NodeID
+	if id == "" {
+		ip, err := detectIP()
+		if err != nil {
+			return "", fmt.Errorf("cannot derive node id, set one explicitly: %v", err)
+		}
+		id = ip.String()
+	}
+	if err := os.MkdirAll(config.DataDir, dirPerm); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(path, []byte(id+"\n"), filePerm); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// advertiseAddr returns advertise if set, otherwise the detected ip of the
+// host with the given port
+func advertiseAddr(advertise string, port int) (string, error) {
+	if advertise != "" {
+		return advertise, nil
+	}
+	ip, err := detectIP()
+	if err != nil {
+		return "", fmt.Errorf("cannot detect advertise address, set one explicitly: %v", err)
+	}
+	return net.JoinHostPort(ip.String(), fmt.Sprint(port)), nil
+}
+
+// detectIP returns the preferred outbound ip of the host, falling back to the
+// first non-loopback interface address when there is no route to the internet
+func detectIP() (net.IP, error) {
+	if ip, err := getOutboundIP(); err == nil {
+		return ip, nil
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.IsGlobalUnicast() {
+			return ipNet.IP, nil
+		}
+	}
+	return nil, errors.New("no non-loopback interface address")
+}
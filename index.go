@@ -0,0 +1,564 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/hashicorp/raft"
+	simpledb "github.com/triplewy/simpledb-embedded"
+	pb "github.com/triplewy/simpledb/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Secondary indexes map the values of an attribute of a table to the keys of
+// the entries holding them. Each index entry is an internal key made of the
+// table, the attribute name, the value in an order preserving encoding and
+// the entry's key, so an exact or range lookup is a scan. Index entries are
+// written by the op handlers in the same transaction as the entries they
+// point to.
+//
+// An index created on existing data is backfilled by the leader in batches
+// of BackfillIndex commands, each indexing the entries from the cursor
+// recorded in the index definition to the end of the batch. Writes keep the
+// index up to date meanwhile, and queries are refused until it is ready.
+const (
+	// indexDefPrefix keys the definition of each index by table and
+	// attribute name
+	indexDefPrefix = internalPrefix + "indexdef/"
+	// indexPrefix keys the index entries of every index
+	indexPrefix = internalPrefix + "index/"
+
+	readyAttribute  = "ready"
+	cursorAttribute = "cursor"
+	keyAttribute    = "key"
+)
+
+// backfillBatchSize is the number of entries indexed by one BackfillIndex
+// command
+const backfillBatchSize = 1000
+
+// keyspaceEnd is greater than every key clients are expected to use
+var keyspaceEnd = strings.Repeat("\xff", 8)
+
+// indexDef is the definition of the index on an attribute of a table
+type indexDef struct {
+	table     tableID
+	attribute string
+	ready     bool
+	// cursor is the key the backfill continues from
+	cursor string
+}
+
+func indexDefKey(table tableID, attribute string) string {
+	return indexDefPrefix + table.bytes() + attribute
+}
+
+// indexTablePrefix returns the prefix of the index entries of a table
+func indexTablePrefix(table tableID) string {
+	return indexPrefix + table.bytes()
+}
+
+// indexValuePrefix returns the prefix of the index entries for an attribute
+func indexValuePrefix(table tableID, attribute string) string {
+	return indexTablePrefix(table) + attribute + "\x00"
+}
+
+func (def *indexDef) entryKey(value *simpledb.Value, key string) (string, bool) {
+	encoded, ok := encodeIndexValue(value)
+	if !ok {
+		return "", false
+	}
+	return indexValuePrefix(def.table, def.attribute) + encoded + key, true
+}
+
+// encodeIndexValue encodes a value so that encoded values of the same type
+// sort like the values themselves. The encoding starts with the type, so
+// values of different types never compare equal. Strings and bytes are
+// escaped and terminated, so the encoding of one is never a prefix of
+// another's. It returns false for a value that cannot be indexed.
+func encodeIndexValue(value *simpledb.Value) (string, bool) {
+	t, ok := attributeType(value)
+	if !ok {
+		return "", false
+	}
+	buf := []byte{byte(t)}
+	switch t {
+	case pb.Attribute_BOOL:
+		if len(value.Data) != 1 {
+			return "", false
+		}
+		b := byte(0)
+		if value.Data[0] != 0 {
+			b = 1
+		}
+		buf = append(buf, b)
+	case pb.Attribute_INT, pb.Attribute_UINT, pb.Attribute_FLOAT:
+		if len(value.Data) != 8 {
+			return "", false
+		}
+		u := bytesToUint64(value.Data)
+		switch t {
+		case pb.Attribute_INT:
+			u ^= 1 << 63
+		case pb.Attribute_FLOAT:
+			if u&(1<<63) != 0 {
+				u = ^u
+			} else {
+				u |= 1 << 63
+			}
+		}
+		buf = append(buf, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(buf[1:], u)
+	case pb.Attribute_STRING, pb.Attribute_BYTES:
+		for _, b := range value.Data {
+			if b == 0 {
+				buf = append(buf, 0, 0xff)
+			} else {
+				buf = append(buf, b)
+			}
+		}
+		buf = append(buf, 0, 1)
+	default:
+		return "", false
+	}
+	return string(buf), true
+}
+
+// readIndexes returns the definitions of every index of a table
+func readIndexes(txn *simpledb.Txn, table tableID) ([]*indexDef, error) {
+	return scanIndexes(txn, indexDefPrefix+table.bytes())
+}
+
+// readAllIndexes returns the definitions of every index of every table
+func readAllIndexes(txn *simpledb.Txn) ([]*indexDef, error) {
+	return scanIndexes(txn, indexDefPrefix)
+}
+
+func scanIndexes(txn *simpledb.Txn, prefix string) ([]*indexDef, error) {
+	entries, err := txn.Scan(prefix, prefixEnd(prefix))
+	if err != nil {
+		return nil, err
+	}
+	var defs []*indexDef
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Key, prefix) || len(entry.Key) < len(indexDefPrefix)+8 {
+			continue
+		}
+		key := entry.Key[len(indexDefPrefix):]
+		defs = append(defs, parseIndexDef(parseTableID(key[:8]), key[8:], entry.Attributes))
+	}
+	return defs, nil
+}
+
+// readIndex returns the definition of the index on an attribute, or nil
+func readIndex(txn *simpledb.Txn, table tableID, attribute string) (*indexDef, error) {
+	entry, err := txn.Read(indexDefKey(table, attribute))
+	if err != nil {
+		if _, ok := err.(*simpledb.ErrKeyNotFound); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return parseIndexDef(table, attribute, entry.Attributes), nil
+}
+
+func parseIndexDef(table tableID, attribute string, attributes map[string]*simpledb.Value) *indexDef {
+	def := &indexDef{table: table, attribute: attribute}
+	if value, ok := attributes[readyAttribute]; ok && len(value.Data) == 1 {
+		def.ready = value.Data[0] != 0
+	}
+	if value, ok := attributes[cursorAttribute]; ok {
+		def.cursor = string(value.Data)
+	}
+	return def
+}
+
+func writeIndexDef(txn *simpledb.Txn, def *indexDef) {
+	ready := byte(0)
+	if def.ready {
+		ready = 1
+	}
+	txn.Write(indexDefKey(def.table, def.attribute), map[string]*simpledb.Value{
+		readyAttribute:  {DataType: simpledb.Bool, Data: []byte{ready}},
+		cursorAttribute: {DataType: simpledb.String, Data: []byte(def.cursor)},
+	})
+}
+
+// indexUpdate is the change of the index entries of one key
+type indexUpdate struct {
+	deletes []string
+	writes  []string
+	key     string
+}
+
+// planIndexUpdate returns the index entries to delete and write when the
+// attributes of key change from old to new. Either may be nil.
+func planIndexUpdate(defs []*indexDef, key string, old, new map[string]*simpledb.Value) *indexUpdate {
+	u := &indexUpdate{key: key}
+	for _, def := range defs {
+		oldKey, hadOld := "", false
+		if value, ok := old[def.attribute]; ok {
+			oldKey, hadOld = def.entryKey(value, key)
+		}
+		newKey, hasNew := "", false
+		if value, ok := new[def.attribute]; ok {
+			newKey, hasNew = def.entryKey(value, key)
+		}
+		if hadOld && (!hasNew || oldKey != newKey) {
+			u.deletes = append(u.deletes, oldKey)
+		}
+		if hasNew {
+			u.writes = append(u.writes, newKey)
+		}
+	}
+	return u
+}
+
+func (u *indexUpdate) apply(txn *simpledb.Txn) {
+	for _, key := range u.deletes {
+		txn.Delete(key)
+	}
+	for _, key := range u.writes {
+		txn.Write(key, map[string]*simpledb.Value{
+			keyAttribute: {DataType: simpledb.String, Data: []byte(u.key)},
+		})
+	}
+}
+
+// applyCreateIndex defines an index on the attribute in Key of Table. It is
+// ready at once if there is nothing to backfill.
+func applyCreateIndex(txn *simpledb.Txn, c *Command) (uint64, error) {
+	table := tableID(c.Table)
+	def, err := readIndex(txn, table, c.Key)
+	if err != nil {
+		return 0, err
+	}
+	if def != nil {
+		return 0, fmt.Errorf("index on %v already exists", c.Key)
+	}
+	def = &indexDef{table: table, attribute: c.Key, ready: true, cursor: table.prefix()}
+	// Only the first batch of entries is needed to tell
+	err = table.scanWindows(txn, table.prefix(), backfillBatchSize, func(string, []*simpledb.Entry) bool {
+		def.ready = false
+		return false
+	})
+	if err != nil {
+		return 0, err
+	}
+	writeIndexDef(txn, def)
+	return 0, nil
+}
+
+// applyDropIndex removes the index on the attribute in Key of Table and its
+// entries
+func applyDropIndex(txn *simpledb.Txn, c *Command) (uint64, error) {
+	table := tableID(c.Table)
+	def, err := readIndex(txn, table, c.Key)
+	if err != nil {
+		return 0, err
+	}
+	if def == nil {
+		return 0, fmt.Errorf("index on %v does not exist", c.Key)
+	}
+	prefix := indexValuePrefix(table, c.Key)
+	entries, err := txn.Scan(prefix, prefixEnd(prefix))
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Key, prefix) {
+			txn.Delete(entry.Key)
+		}
+	}
+	txn.Delete(indexDefKey(table, c.Key))
+	return 0, nil
+}
+
+// applyBackfillIndex indexes the entries of the index on the attribute in Key
+// of Table from its cursor up to EndKey, or to the end of the table if EndKey
+// is empty, and marks the index ready then. It returns the number of entries
+// indexed.
+func applyBackfillIndex(txn *simpledb.Txn, c *Command) (uint64, error) {
+	table := tableID(c.Table)
+	def, err := readIndex(txn, table, c.Key)
+	if err != nil {
+		return 0, err
+	}
+	if def == nil || def.ready {
+		// Dropped or finished by an earlier backfill
+		return 0, nil
+	}
+	endKey := c.EndKey
+	if endKey == "" {
+		endKey = table.end()
+	}
+	if endKey <= def.cursor {
+		return 0, nil
+	}
+	entries, err := txn.Scan(def.cursor, endKey)
+	if err != nil {
+		return 0, err
+	}
+	defs := []*indexDef{def}
+	count := uint64(0)
+	for _, entry := range entries {
+		if !table.contains(entry.Key) || entry.Key < def.cursor || entry.Key >= endKey {
+			continue
+		}
+		planIndexUpdate(defs, entry.Key, nil, entry.Attributes).apply(txn)
+		count++
+	}
+	if c.EndKey == "" {
+		def.ready = true
+	}
+	def.cursor = c.EndKey
+	writeIndexDef(txn, def)
+	return count, nil
+}
+
+// CreateIndexRPC creates a secondary index on an attribute of a table and
+// backfills it in the background if entries exist
+func (node *Node) CreateIndexRPC(ctx context.Context, msg *pb.IndexMsg) (*pb.OkMsg, error) {
+	if msg.Attribute == "" || strings.Contains(msg.Attribute, "\x00") {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid attribute name: %q", msg.Attribute)
+	}
+	table, err := node.resolveTable(msg.Table)
+	if err != nil {
+		return nil, err
+	}
+	err = node.applyCommand(&Command{Op: CreateIndex, Key: msg.Attribute, Table: uint64(table)})
+	if err != nil {
+		return nil, err
+	}
+	go node.backfill(table, msg.Attribute)
+	return &pb.OkMsg{Ok: true}, nil
+}
+
+// DropIndexRPC removes a secondary index
+func (node *Node) DropIndexRPC(ctx context.Context, msg *pb.IndexMsg) (*pb.OkMsg, error) {
+	table, err := node.resolveTable(msg.Table)
+	if err != nil {
+		return nil, err
+	}
+	err = node.applyCommand(&Command{Op: DropIndex, Key: msg.Attribute, Table: uint64(table)})
+	if err != nil {
+		return nil, err
+	}
+	return &pb.OkMsg{Ok: true}, nil
+}
+
+// ListIndexesRPC returns the secondary indexes of a table known to this node
+func (node *Node) ListIndexesRPC(ctx context.Context, msg *pb.TableMsg) (*pb.IndexesMsg, error) {
+	table, err := node.resolveTable(msg.Name)
+	if err != nil {
+		return nil, err
+	}
+	defs, err := readIndexes(node.store.db.StartTxn(), table)
+	if err != nil {
+		return nil, err
+	}
+	result := &pb.IndexesMsg{}
+	for _, def := range defs {
+		result.Indexes = append(result.Indexes, &pb.IndexInfo{Attribute: def.attribute, Ready: def.ready})
+	}
+	return result, nil
+}
+
+// QueryIndexRPC returns the entries whose indexed attribute equals a value or
+// lies between a start value, inclusive, and an end value, exclusive. Either
+// bound may be omitted but not both. Queries with a max staleness that this
+// node does not meet are forwarded to the leader.
+func (node *Node) QueryIndexRPC(ctx context.Context, msg *pb.IndexQueryMsg) (*pb.EntriesMsg, error) {
+	start, end, err := indexQueryRange(msg)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if msg.MaxStaleness != nil && !node.withinStaleness(msg.MaxStaleness) {
+		ctx, leader, err := node.leaderClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return leader.QueryIndexRPC(ctx, msg)
+	}
+	table, err := node.resolveTable(msg.Table)
+	if err != nil {
+		return nil, err
+	}
+	prefix := indexValuePrefix(table, msg.Attribute)
+	startKey, endKey := prefix+start, prefix+end
+	txn := node.store.db.StartTxn()
+	def, err := readIndex(txn, table, msg.Attribute)
+	if err != nil {
+		return nil, err
+	}
+	if def == nil {
+		return nil, status.Errorf(codes.NotFound, "no index on %v", msg.Attribute)
+	}
+	if !def.ready {
+		return nil, indexNotReadyError(msg.Attribute)
+	}
+	entries, err := txn.Scan(startKey, endKey)
+	if err != nil {
+		return nil, err
+	}
+	result := []*pb.Entry{}
+	for _, entry := range entries {
+		if entry.Key < startKey || entry.Key >= endKey {
+			continue
+		}
+		value, ok := entry.Attributes[keyAttribute]
+		if !ok {
+			continue
+		}
+		key := string(value.Data)
+		if msg.KeysOnly {
+			result = append(result, &pb.Entry{Key: table.userKey(key)})
+			continue
+		}
+		indexed, err := txn.Read(key)
+		if err != nil {
+			return nil, err
+		}
+		attributes, err := valuesToAttributes(indexed.Attributes)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, &pb.Entry{Key: table.userKey(key), Attributes: attributes})
+	}
+	return &pb.EntriesMsg{Entries: result}, nil
+}
+
+// indexQueryRange returns the range of encoded values a query scans
+func indexQueryRange(msg *pb.IndexQueryMsg) (string, string, error) {
+	if msg.Attribute == "" {
+		return "", "", fmt.Errorf("attribute must not be empty")
+	}
+	encode := func(attribute *pb.Attribute) (string, error) {
+		values, err := attributesToValues([]*pb.Attribute{attribute})
+		if err != nil {
+			return "", err
+		}
+		encoded, ok := encodeIndexValue(values[attribute.Name])
+		if !ok {
+			return "", fmt.Errorf("invalid %v value", attribute.Type)
+		}
+		return encoded, nil
+	}
+	if msg.Value != nil {
+		if msg.Start != nil || msg.End != nil {
+			return "", "", fmt.Errorf("set either a value or a range")
+		}
+		encoded, err := encode(msg.Value)
+		if err != nil {
+			return "", "", err
+		}
+		return encoded, prefixEnd(encoded), nil
+	}
+	if msg.Start == nil && msg.End == nil {
+		return "", "", fmt.Errorf("set a value or at least one bound of a range")
+	}
+	if msg.Start != nil && msg.End != nil && msg.Start.Type != msg.End.Type {
+		return "", "", fmt.Errorf("range bounds must have the same type")
+	}
+	var startKey, endKey string
+	if msg.Start != nil {
+		encoded, err := encode(msg.Start)
+		if err != nil {
+			return "", "", err
+		}
+		startKey = encoded
+	} else {
+		startKey = string([]byte{byte(msg.End.Type)})
+	}
+	if msg.End != nil {
+		encoded, err := encode(msg.End)
+		if err != nil {
+			return "", "", err
+		}
+		endKey = encoded
+	} else {
+		endKey = string([]byte{byte(msg.Start.Type) + 1})
+	}
+	return startKey, endKey, nil
+}
+
+// indexNotReadyError is returned for queries on an index that is still being
+// backfilled. Its IndexInfo detail tells clients to retry on the same leader.
+func indexNotReadyError(attribute string) error {
+	st := status.Newf(codes.Unavailable, "index on %v is still being backfilled", attribute)
+	if withInfo, err := st.WithDetails(&pb.IndexInfo{Attribute: attribute}); err == nil {
+		st = withInfo
+	}
+	return st.Err()
+}
+
+// backfill proposes BackfillIndex commands for an index until it is ready,
+// the index is dropped or this node stops being the leader
+func (node *Node) backfill(table tableID, attribute string) {
+	task := fmt.Sprintf("backfill/%d/%s", table, attribute)
+	if !node.tasks.start(task) {
+		return
+	}
+	defer node.tasks.done(task)
+
+	txn := node.store.db.StartTxn()
+	def, err := readIndex(txn, table, attribute)
+	if err != nil || def == nil || def.ready {
+		return
+	}
+	// Each batch ends at the end of the window that fills it, and the last
+	// one runs to the end of the table and marks the index ready
+	propose := func(endKey string) bool {
+		select {
+		case <-node.shutdownCh:
+			return false
+		default:
+		}
+		if node.raft.State() != raft.Leader {
+			return false
+		}
+		err := node.applyCommand(&Command{Op: BackfillIndex, Key: attribute, EndKey: endKey, Table: uint64(table)})
+		if err != nil {
+			log.Printf("backfill index on %v: %v", attribute, err)
+			return false
+		}
+		return true
+	}
+	n, ok := 0, true
+	err = table.scanWindows(txn, def.cursor, backfillBatchSize, func(end string, entries []*simpledb.Entry) bool {
+		n += len(entries)
+		if n < backfillBatchSize {
+			return true
+		}
+		n = 0
+		ok = propose(end)
+		return ok
+	})
+	if err != nil {
+		log.Printf("backfill index on %v: %v", attribute, err)
+		return
+	}
+	if !ok || !propose("") {
+		return
+	}
+	log.Printf("index on %v is ready", attribute)
+}
+
+// resumeBackfills restarts the backfill of every index that is not ready,
+// after this node became the leader
+func (node *Node) resumeBackfills() {
+	defs, err := readAllIndexes(node.store.db.StartTxn())
+	if err != nil {
+		log.Printf("failed to resume index backfills: %v", err)
+		return
+	}
+	for _, def := range defs {
+		if !def.ready {
+			go node.backfill(def.table, def.attribute)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+
+	simpledb "github.com/triplewy/simpledb-embedded"
+	pb "github.com/triplewy/simpledb/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func intValue(i int64) *simpledb.Value {
+	return &simpledb.Value{DataType: simpledb.Int, Data: uint64ToBytes(uint64(i))}
+}
+
+func floatValue(f float64) *simpledb.Value {
+	return &simpledb.Value{DataType: simpledb.Float, Data: uint64ToBytes(math.Float64bits(f))}
+}
+
+func stringValue(s string) *simpledb.Value {
+	return &simpledb.Value{DataType: simpledb.String, Data: []byte(s)}
+}
+
+func TestEncodeIndexValueOrder(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []*simpledb.Value
+	}{
+		{"int", []*simpledb.Value{intValue(math.MinInt64), intValue(-256), intValue(-1), intValue(0), intValue(1), intValue(255), intValue(math.MaxInt64)}},
+		{"uint", []*simpledb.Value{
+			{DataType: simpledb.Uint, Data: uint64ToBytes(0)},
+			{DataType: simpledb.Uint, Data: uint64ToBytes(1 << 8)},
+			{DataType: simpledb.Uint, Data: uint64ToBytes(math.MaxUint64)},
+		}},
+		{"float", []*simpledb.Value{floatValue(math.Inf(-1)), floatValue(-1e10), floatValue(-1.5), floatValue(-0.25), floatValue(0), floatValue(0.25), floatValue(1.5), floatValue(1e10), floatValue(math.Inf(1))}},
+		{"string", []*simpledb.Value{stringValue(""), stringValue("\x00"), stringValue("\x00\x00"), stringValue("\x01"), stringValue("a"), stringValue("a\x00"), stringValue("a\x00b"), stringValue("ab"), stringValue("b")}},
+		{"bool", []*simpledb.Value{{DataType: simpledb.Bool, Data: []byte{0}}, {DataType: simpledb.Bool, Data: []byte{1}}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			prev := ""
+			for i, value := range test.values {
+				encoded, ok := encodeIndexValue(value)
+				if !ok {
+					t.Fatalf("value %d was not encoded", i)
+				}
+				if i > 0 && encoded <= prev {
+					t.Fatalf("value %d encodes to %x, not after %x", i, encoded, prev)
+				}
+				prev = encoded
+			}
+		})
+	}
+}
+
+func TestEncodeIndexValuePrefix(t *testing.T) {
+	// An index entry key is the encoded value followed by the entry's key, so
+	// no encoded string may be a prefix of another
+	strings := []string{"", "a", "a\x00", "a\x00\x01", "ab"}
+	for _, a := range strings {
+		for _, b := range strings {
+			ea, _ := encodeIndexValue(stringValue(a))
+			eb, _ := encodeIndexValue(stringValue(b))
+			if a != b && len(ea) <= len(eb) && eb[:len(ea)] == ea {
+				t.Errorf("encoding of %q is a prefix of the encoding of %q", a, b)
+			}
+		}
+	}
+}
+
+func TestEncodeIndexValueInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		value *simpledb.Value
+	}{
+		{"short int", &simpledb.Value{DataType: simpledb.Int, Data: []byte{1}}},
+		{"long float", &simpledb.Value{DataType: simpledb.Float, Data: make([]byte, 9)}},
+		{"empty bool", &simpledb.Value{DataType: simpledb.Bool}},
+		{"unknown type", &simpledb.Value{DataType: 0xff, Data: []byte("x")}},
+	}
+	for _, test := range tests {
+		if _, ok := encodeIndexValue(test.value); ok {
+			t.Errorf("%v was encoded", test.name)
+		}
+	}
+}
+
+func TestPlanIndexUpdate(t *testing.T) {
+	a := &indexDef{table: defaultTable, attribute: "a"}
+	b := &indexDef{table: defaultTable, attribute: "b"}
+	defs := []*indexDef{a, b}
+	entry := func(def *indexDef, value *simpledb.Value) string {
+		key, ok := def.entryKey(value, "k")
+		if !ok {
+			t.Fatal("value was not encoded")
+		}
+		return key
+	}
+	tests := []struct {
+		name    string
+		old     map[string]*simpledb.Value
+		new     map[string]*simpledb.Value
+		deletes []string
+		writes  []string
+	}{
+		{
+			name:   "insert",
+			new:    map[string]*simpledb.Value{"a": intValue(1), "c": intValue(2)},
+			writes: []string{entry(a, intValue(1))},
+		},
+		{
+			name:    "delete",
+			old:     map[string]*simpledb.Value{"a": intValue(1), "b": stringValue("x")},
+			deletes: []string{entry(a, intValue(1)), entry(b, stringValue("x"))},
+		},
+		{
+			name:    "change",
+			old:     map[string]*simpledb.Value{"a": intValue(1), "b": stringValue("x")},
+			new:     map[string]*simpledb.Value{"a": intValue(2), "b": stringValue("x")},
+			deletes: []string{entry(a, intValue(1))},
+			writes:  []string{entry(a, intValue(2)), entry(b, stringValue("x"))},
+		},
+		{
+			name:    "remove attribute",
+			old:     map[string]*simpledb.Value{"a": intValue(1)},
+			new:     map[string]*simpledb.Value{"c": intValue(1)},
+			deletes: []string{entry(a, intValue(1))},
+		},
+		{
+			name:    "unindexable value",
+			old:     map[string]*simpledb.Value{"a": intValue(1)},
+			new:     map[string]*simpledb.Value{"a": {DataType: simpledb.Int, Data: []byte{1}}},
+			deletes: []string{entry(a, intValue(1))},
+		},
+	}
+	for _, test := range tests {
+		u := planIndexUpdate(defs, "k", test.old, test.new)
+		if fmt.Sprint(u.deletes) != fmt.Sprint(test.deletes) || fmt.Sprint(u.writes) != fmt.Sprint(test.writes) {
+			t.Errorf("%v: deletes %q, writes %q, expected %q, %q", test.name, u.deletes, u.writes, test.deletes, test.writes)
+		}
+	}
+}
+
+// indexedKeys returns the keys the index on attribute points to, in index
+// order
+func indexedKeys(t *testing.T, s *store, attribute string) []string {
+	prefix := indexValuePrefix(defaultTable, attribute)
+	entries, err := s.db.StartTxn().Scan(prefix, prefixEnd(prefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, entry := range entries {
+		if entry.Key >= prefix && entry.Key < prefixEnd(prefix) {
+			keys = append(keys, string(entry.Attributes[keyAttribute].Data))
+		}
+	}
+	return keys
+}
+
+func TestBackfillResume(t *testing.T) {
+	s := newTestStore(t)
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("k%02d", i)
+		resp := s.execute(&Command{Op: Insert, Key: key, Values: map[string]*simpledb.Value{"n": intValue(int64(9 - i))}}, 0)
+		if resp.err != nil {
+			t.Fatal(resp.err)
+		}
+	}
+	if resp := s.execute(&Command{Op: CreateIndex, Key: "n"}, 0); resp.err != nil {
+		t.Fatal(resp.err)
+	}
+	resp := s.execute(&Command{Op: BackfillIndex, Key: "n", EndKey: "k04"}, 0)
+	if resp.err != nil || resp.count != 4 {
+		t.Fatalf("first batch indexed %d entries: %v", resp.count, resp.err)
+	}
+	// A write during the backfill is indexed by the op itself
+	if resp := s.execute(&Command{Op: Update, Key: "k07", Values: map[string]*simpledb.Value{"n": intValue(-1)}}, 0); resp.err != nil {
+		t.Fatal(resp.err)
+	}
+
+	// The cursor survives a restart, so the backfill continues where it left
+	if err := s.initialize(); err != nil {
+		t.Fatal(err)
+	}
+	def, err := readIndex(s.db.StartTxn(), defaultTable, "n")
+	if err != nil || def == nil || def.ready || def.cursor != "k04" {
+		t.Fatalf("index after restart: %+v, %v", def, err)
+	}
+	resp = s.execute(&Command{Op: BackfillIndex, Key: "n"}, 0)
+	if resp.err != nil || resp.count != 6 {
+		t.Fatalf("last batch indexed %d entries: %v", resp.count, resp.err)
+	}
+	def, err = readIndex(s.db.StartTxn(), defaultTable, "n")
+	if err != nil || !def.ready {
+		t.Fatalf("index after the last batch: %+v, %v", def, err)
+	}
+
+	want := []string{"k07", "k09", "k08", "k06", "k05", "k04", "k03", "k02", "k01", "k00"}
+	if keys := indexedKeys(t, s, "n"); fmt.Sprint(keys) != fmt.Sprint(want) {
+		t.Fatalf("index holds %v, expected %v", keys, want)
+	}
+	// A late batch of a finished backfill changes nothing
+	if resp := s.execute(&Command{Op: BackfillIndex, Key: "n", EndKey: "k02"}, 0); resp.err != nil || resp.count != 0 {
+		t.Fatalf("late batch indexed %d entries: %v", resp.count, resp.err)
+	}
+}
+
+func TestQueryIndexNotReady(t *testing.T) {
+	s := newTestStore(t)
+	node := &Node{store: s}
+	query := &pb.IndexQueryMsg{Attribute: "n", Value: &pb.Attribute{Name: "n", Type: pb.Attribute_INT, Value: uint64ToBytes(1)}}
+	if resp := s.execute(&Command{Op: Insert, Key: "k", Values: map[string]*simpledb.Value{"n": intValue(1)}}, 0); resp.err != nil {
+		t.Fatal(resp.err)
+	}
+	if resp := s.execute(&Command{Op: CreateIndex, Key: "n"}, 0); resp.err != nil {
+		t.Fatal(resp.err)
+	}
+
+	_, err := node.QueryIndexRPC(context.Background(), query)
+	st := status.Convert(err)
+	if st.Code() != codes.Unavailable {
+		t.Fatalf("query of unready index: %v", err)
+	}
+	found := false
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*pb.IndexInfo); ok && info.Attribute == "n" && !info.Ready {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("unready index error has details %v", st.Details())
+	}
+
+	if resp := s.execute(&Command{Op: BackfillIndex, Key: "n"}, 0); resp.err != nil {
+		t.Fatal(resp.err)
+	}
+	reply, err := node.QueryIndexRPC(context.Background(), query)
+	if err != nil || len(reply.Entries) != 1 || reply.Entries[0].Key != "k" {
+		t.Fatalf("query of ready index: %v, %v", reply, err)
+	}
+}
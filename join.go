@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/raft"
+	pb "github.com/triplewy/simpledb/grpc"
+	"google.golang.org/grpc"
+)
+
+const joinRetryInterval = time.Second
+
+// join asks the cluster members in Config.Join to add this node as a
+// nonvoter, retrying until one of them, the leader, accepts or the node shuts
+// down. Nothing is done if the node is already in the cluster configuration.
+func (node *Node) join(address raft.ServerAddress) {
+	if node.inConfiguration() {
+		return
+	}
+	opts, err := node.dialOptions()
+	if err != nil {
+		log.Printf("join: %v", err)
+		return
+	}
+	msg := &pb.ServerMsg{Id: string(node.localID()), Address: string(address)}
+	for {
+		for _, addr := range strings.Split(node.Config.Join, ",") {
+			if err := addNonvoter(strings.TrimSpace(addr), msg, opts); err != nil {
+				log.Printf("join %v: %v", addr, err)
+				continue
+			}
+			log.Printf("joined cluster through %v as a nonvoter", addr)
+			return
+		}
+		select {
+		case <-node.shutdownCh:
+			return
+		case <-time.After(joinRetryInterval):
+		}
+	}
+}
+
+func addNonvoter(addr string, msg *pb.ServerMsg, opts []grpc.DialOption) error {
+	ctx, cancel := context.WithTimeout(context.Background(), raftTimeout)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, addr, opts...)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = pb.NewAdminClient(conn).AddNonvoterRPC(ctx, msg)
+	return err
+}
+
+// inConfiguration returns true if this node is in its latest cluster
+// configuration
+func (node *Node) inConfiguration() bool {
+	f := node.raft.GetConfiguration()
+	if f.Error() != nil {
+		return false
+	}
+	for _, server := range f.Configuration().Servers {
+		if server.ID == node.localID() {
+			return true
+		}
+	}
+	return false
+}
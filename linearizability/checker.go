@@ -0,0 +1,213 @@
+// Package linearizability checks whether a history of concurrent operations
+// is linearizable with respect to a sequential model. It implements the
+// algorithm of Wing & Gong with the memoization of Lowe, as in porcupine.
+package linearizability
+
+import (
+	"math"
+	"sort"
+)
+
+// Unknown is the Return time of an operation whose outcome was never
+// observed, e.g. because the request timed out. Such an operation may take
+// effect at any point after its call.
+const Unknown int64 = math.MaxInt64
+
+// Operation is a single client request in a history
+type Operation struct {
+	ClientID int
+	Input    interface{}
+	Call     int64
+	Output   interface{}
+	Return   int64
+}
+
+// Model is a sequential specification of a system
+type Model struct {
+	// Partition splits a history into independent sub-histories, e.g. by key.
+	// The history is checked as a whole if nil.
+	Partition func(history []Operation) [][]Operation
+	// Init returns the initial state
+	Init func() interface{}
+	// Step applies input to state. It returns false if output is not a valid
+	// result of doing so, otherwise the new state. It must not modify state.
+	Step func(state, input, output interface{}) (bool, interface{})
+	// Equal reports whether two states are equal
+	Equal func(state1, state2 interface{}) bool
+}
+
+// Check reports whether history is linearizable with respect to model
+func Check(model Model, history []Operation) bool {
+	partitions := [][]Operation{history}
+	if model.Partition != nil {
+		partitions = model.Partition(history)
+	}
+	for _, partition := range partitions {
+		if !checkSingle(model, partition) {
+			return false
+		}
+	}
+	return true
+}
+
+type entry struct {
+	isCall bool
+	value  interface{}
+	id     int
+	time   int64
+	match  *entry
+	prev   *entry
+	next   *entry
+}
+
+// makeList returns a doubly linked list of call and return entries ordered
+// by time, with calls before returns at equal times
+func makeList(history []Operation) *entry {
+	entries := []*entry{}
+	for id, op := range history {
+		call := &entry{isCall: true, value: op.Input, id: id, time: op.Call}
+		ret := &entry{value: op.Output, id: id, time: op.Return}
+		call.match = ret
+		entries = append(entries, call, ret)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].time != entries[j].time {
+			return entries[i].time < entries[j].time
+		}
+		return entries[i].isCall && !entries[j].isCall
+	})
+	var head, prev *entry
+	for _, e := range entries {
+		if prev == nil {
+			head = e
+		} else {
+			prev.next = e
+			e.prev = prev
+		}
+		prev = e
+	}
+	return head
+}
+
+// lift removes a call entry and its return from the list
+func lift(e *entry) {
+	e.prev.next = e.next
+	e.next.prev = e.prev
+	match := e.match
+	match.prev.next = match.next
+	if match.next != nil {
+		match.next.prev = match.prev
+	}
+}
+
+// unlift reinserts a call entry and its return removed by lift
+func unlift(e *entry) {
+	match := e.match
+	match.prev.next = match
+	if match.next != nil {
+		match.next.prev = match
+	}
+	e.prev.next = e
+	e.next.prev = e
+}
+
+type bitset []uint64
+
+func newBitset(n int) bitset {
+	return make(bitset, (n+63)/64)
+}
+
+func (b bitset) set(i int) bitset {
+	b[i/64] |= 1 << uint(i%64)
+	return b
+}
+
+func (b bitset) clear(i int) bitset {
+	b[i/64] &^= 1 << uint(i%64)
+	return b
+}
+
+func (b bitset) clone() bitset {
+	return append(bitset{}, b...)
+}
+
+func (b bitset) equals(other bitset) bool {
+	for i := range b {
+		if b[i] != other[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (b bitset) hash() uint64 {
+	var h uint64
+	for _, v := range b {
+		h = h*31 + v
+	}
+	return h
+}
+
+type cacheEntry struct {
+	linearized bitset
+	state      interface{}
+}
+
+type call struct {
+	entry *entry
+	state interface{}
+}
+
+func checkSingle(model Model, history []Operation) bool {
+	if len(history) == 0 {
+		return true
+	}
+	head := &entry{id: -1}
+	head.next = makeList(history)
+	head.next.prev = head
+
+	linearized := newBitset(len(history))
+	cache := make(map[uint64][]cacheEntry)
+	calls := []call{}
+	state := model.Init()
+	e := head.next
+	for head.next != nil {
+		if e.isCall {
+			ok, newState := model.Step(state, e.value, e.match.value)
+			if ok {
+				newLinearized := linearized.clone().set(e.id)
+				hash := newLinearized.hash()
+				seen := false
+				for _, c := range cache[hash] {
+					if c.linearized.equals(newLinearized) && model.Equal(c.state, newState) {
+						seen = true
+						break
+					}
+				}
+				if !seen {
+					cache[hash] = append(cache[hash], cacheEntry{linearized: newLinearized, state: newState})
+					calls = append(calls, call{entry: e, state: state})
+					state = newState
+					linearized.set(e.id)
+					lift(e)
+					e = head.next
+					continue
+				}
+			}
+			e = e.next
+			continue
+		}
+		// Reached a return whose call could not be linearized, so backtrack
+		if len(calls) == 0 {
+			return false
+		}
+		top := calls[len(calls)-1]
+		calls = calls[:len(calls)-1]
+		e = top.entry
+		state = top.state
+		linearized.clear(e.id)
+		unlift(e)
+		e = e.next
+	}
+	return true
+}
@@ -0,0 +1,113 @@
+package linearizability
+
+// Kinds of KV operations, mirroring the commands applied by store.Apply
+const (
+	KvInsert = iota
+	KvUpdate
+	KvDelete
+	KvRead
+)
+
+// KvInput is the input of a KV operation. Attributes are the attribute
+// values written by inserts and updates.
+type KvInput struct {
+	Op         int
+	Key        string
+	Attributes map[string]string
+}
+
+// KvOutput is the result of a KV operation. Failed is set when the command was
+// applied but rejected: an insert of an existing key, an update of a missing
+// key or a read of a missing key. Attributes are the values returned by reads.
+type KvOutput struct {
+	Failed     bool
+	Attributes map[string]string
+}
+
+// kvState is the entry at a single key, nil if it does not exist
+type kvState map[string]string
+
+// KvModel is the sequential model of the SimpleDb API. Histories are
+// partitioned by key since operations on different keys are independent.
+// Operations with an Unknown return time should have a nil Output.
+var KvModel = Model{
+	Partition: func(history []Operation) [][]Operation {
+		byKey := make(map[string][]Operation)
+		keys := []string{}
+		for _, op := range history {
+			key := op.Input.(KvInput).Key
+			if _, ok := byKey[key]; !ok {
+				keys = append(keys, key)
+			}
+			byKey[key] = append(byKey[key], op)
+		}
+		partitions := [][]Operation{}
+		for _, key := range keys {
+			partitions = append(partitions, byKey[key])
+		}
+		return partitions
+	},
+	Init: func() interface{} {
+		return kvState(nil)
+	},
+	Step: func(state, input, output interface{}) (bool, interface{}) {
+		st := state.(kvState)
+		in := input.(KvInput)
+		out, known := output.(KvOutput)
+		switch in.Op {
+		case KvInsert:
+			if st != nil {
+				return !known || out.Failed, st
+			}
+			return !known || !out.Failed, copyAttributes(in.Attributes)
+		case KvUpdate:
+			if st == nil {
+				return !known || out.Failed, st
+			}
+			next := copyAttributes(st)
+			for name, value := range in.Attributes {
+				next[name] = value
+			}
+			return !known || !out.Failed, next
+		case KvDelete:
+			return !known || !out.Failed, kvState(nil)
+		case KvRead:
+			if !known {
+				return true, st
+			}
+			if st == nil {
+				return out.Failed, st
+			}
+			return !out.Failed && equalAttributes(st, out.Attributes), st
+		default:
+			return false, st
+		}
+	},
+	Equal: func(state1, state2 interface{}) bool {
+		st1, st2 := state1.(kvState), state2.(kvState)
+		if (st1 == nil) != (st2 == nil) {
+			return false
+		}
+		return equalAttributes(st1, st2)
+	},
+}
+
+func copyAttributes(attributes map[string]string) kvState {
+	st := make(kvState)
+	for name, value := range attributes {
+		st[name] = value
+	}
+	return st
+}
+
+func equalAttributes(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, value := range a {
+		if v, ok := b[name]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
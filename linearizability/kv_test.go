@@ -0,0 +1,38 @@
+package linearizability
+
+import "testing"
+
+func insert(key, value string, call, ret int64) Operation {
+	return Operation{
+		Input:  KvInput{Op: KvInsert, Key: key, Attributes: map[string]string{"value": value}},
+		Output: KvOutput{},
+		Call:   call,
+		Return: ret,
+	}
+}
+
+func read(key, value string, call, ret int64) Operation {
+	output := KvOutput{Failed: value == ""}
+	if value != "" {
+		output.Attributes = map[string]string{"value": value}
+	}
+	return Operation{Input: KvInput{Op: KvRead, Key: key}, Output: output, Call: call, Return: ret}
+}
+
+func TestKvModel(t *testing.T) {
+	tests := []struct {
+		name    string
+		history []Operation
+		ok      bool
+	}{
+		{"concurrent read", []Operation{insert("a", "1", 0, 10), read("a", "", 1, 5), read("a", "1", 6, 12)}, true},
+		{"stale read", []Operation{insert("a", "1", 0, 10), read("a", "1", 11, 12), read("a", "", 13, 14)}, false},
+		{"unknown write", []Operation{{Input: KvInput{Op: KvInsert, Key: "a", Attributes: map[string]string{"value": "1"}}, Call: 0, Return: Unknown}, read("a", "1", 5, 6)}, true},
+		{"independent keys", []Operation{insert("a", "1", 0, 1), read("b", "", 2, 3), read("a", "1", 2, 3)}, true},
+	}
+	for _, test := range tests {
+		if ok := Check(KvModel, test.history); ok != test.ok {
+			t.Errorf("%v: got %v, want %v", test.name, ok, test.ok)
+		}
+	}
+}
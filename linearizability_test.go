@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	pb "github.com/triplewy/simpledb/grpc"
+	"github.com/triplewy/simpledb/linearizability"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLinearizability(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping fault injection workload in short mode")
+	}
+	c, err := newTestCluster(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Shutdown()
+	if _, err := c.WaitForLeader(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	history, err := runWorkload(c, &workloadConfig{
+		clients:       4,
+		keys:          3,
+		duration:      5 * time.Second,
+		opTimeout:     500 * time.Millisecond,
+		faultInterval: 300 * time.Millisecond,
+		seed:          time.Now().UnixNano(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	known := 0
+	for _, op := range history {
+		if op.Return != linearizability.Unknown {
+			known++
+		}
+	}
+	if known == 0 {
+		t.Fatalf("none of %d operations completed", len(history))
+	}
+	if !linearizability.Check(linearizability.KvModel, history) {
+		t.Fatalf("history of %d operations is not linearizable", len(history))
+	}
+}
+
+func TestDeposedLeaderRead(t *testing.T) {
+	c, err := newTestCluster(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Shutdown()
+	old, err := c.WaitForLeader(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	write := func(node int, value string) {
+		attributes := []*pb.Attribute{{Name: workloadAttribute, Type: pb.Attribute_STRING, Value: []byte(value)}}
+		if _, err := c.Node(node).UpdateRPC(ctx, &pb.Entry{Key: "key", Attributes: attributes}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := c.Node(old).InsertRPC(ctx, &pb.Entry{Key: "key"}); err != nil {
+		t.Fatal(err)
+	}
+	write(old, "1")
+
+	others := []int{(old + 1) % 3, (old + 2) % 3}
+	c.Partition([]int{old}, others)
+	deadline := time.Now().Add(5 * time.Second)
+	leader := -1
+	for leader < 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for a new leader")
+		}
+		for _, i := range others {
+			if c.Node(i).raft.State() == raft.Leader {
+				leader = i
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	write(leader, "2")
+
+	_, err = c.Node(old).ReadRPC(ctx, &pb.ReadMsg{Key: "key", Attributes: []string{workloadAttribute}, Linearizable: true})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected deposed leader to refuse linearizable read, got %v", err)
+	}
+	_, err = c.Node(old).CountRPC(ctx, &pb.KeyRangeMsg{Prefix: "key", Linearizable: true})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected deposed leader to refuse linearizable count, got %v", err)
+	}
+	if count, err := c.Node(leader).CountRPC(ctx, &pb.KeyRangeMsg{Prefix: "key", Linearizable: true}); err != nil || count.Count != 1 {
+		t.Fatalf("linearizable count on the leader: %v, %v", count, err)
+	}
+	entry, err := c.Node(leader).ReadRPC(ctx, &pb.ReadMsg{Key: "key", Attributes: []string{workloadAttribute}, Linearizable: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entry.Attributes) != 1 || string(entry.Attributes[0].Value) != "2" {
+		t.Fatalf("expected latest write, got %v", entry.Attributes)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/hashicorp/raft"
+)
+
+// logCache wraps a raft.LogStore with a ring buffer of the most recently
+// stored entries, so that replicating recent entries to followers does not
+// read and decode them from the embedded DB. It mirrors raft.LogCache but
+// records hits and misses.
+type logCache struct {
+	store raft.LogStore
+
+	mu    sync.RWMutex
+	cache []*raft.Log
+}
+
+// newLogCache returns a cache of the last size entries in store
+func newLogCache(size int, store raft.LogStore) *logCache {
+	return &logCache{
+		store: store,
+		cache: make([]*raft.Log, size),
+	}
+}
+
+// GetLog gets a log entry at a given index, from the cache if present
+func (c *logCache) GetLog(index uint64, log *raft.Log) error {
+	c.mu.RLock()
+	cached := c.cache[index%uint64(len(c.cache))]
+	c.mu.RUnlock()
+
+	if cached != nil && cached.Index == index {
+		logCacheRequests.WithLabelValues("hit").Inc()
+		*log = *cached
+		return nil
+	}
+	logCacheRequests.WithLabelValues("miss").Inc()
+	return c.store.GetLog(index, log)
+}
+
+// StoreLog stores a log entry.
+func (c *logCache) StoreLog(log *raft.Log) error {
+	return c.StoreLogs([]*raft.Log{log})
+}
+
+// StoreLogs stores multiple log entries and caches them once persisted.
+func (c *logCache) StoreLogs(logs []*raft.Log) error {
+	if err := c.store.StoreLogs(logs); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, log := range logs {
+		c.cache[log.Index%uint64(len(c.cache))] = log
+	}
+	return nil
+}
+
+// FirstIndex returns the first index written. 0 for no entries.
+func (c *logCache) FirstIndex() (uint64, error) {
+	return c.store.FirstIndex()
+}
+
+// LastIndex returns the last index written. 0 for no entries.
+func (c *logCache) LastIndex() (uint64, error) {
+	return c.store.LastIndex()
+}
+
+// DeleteRange deletes a range of log entries. The range is inclusive. The
+// cache is cleared since raft only deletes to compact or to drop a conflicting
+// suffix.
+func (c *logCache) DeleteRange(min, max uint64) error {
+	c.mu.Lock()
+	c.cache = make([]*raft.Log, len(c.cache))
+	c.mu.Unlock()
+	return c.store.DeleteRange(min, max)
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/hashicorp/raft"
+	simpledb "github.com/triplewy/simpledb-embedded"
+)
+
+// logPrefix prefixes raft log keys. Indices are big-endian so that keys sort
+// in index order.
+const logPrefix = raftPrefix + "log/"
+
+// legacyLogPrefix prefixed raft log keys with little-endian indices, which do
+// not sort in index order. They are migrated when the log store is opened.
+const legacyLogPrefix = "log"
+
+// logAttribute is the attribute holding the msgpack encoded raft.Log
+const logAttribute = "log"
+
+// logStore implements raft.LogStore on top of the embedded DB. The first and
+// last indices are kept in memory so that FirstIndex and LastIndex, which raft
+// calls constantly, do not touch the DB.
+type logStore struct {
+	db *simpledb.DB
+
+	mu    sync.RWMutex
+	first uint64
+	last  uint64
+}
+
+// newLogStore opens the log store, migrating legacy keys and recovering the
+// first and last indices
+func newLogStore(db *simpledb.DB) (*logStore, error) {
+	logs := &logStore{db: db}
+	if err := logs.migrateLegacy(); err != nil {
+		return nil, err
+	}
+	err := db.ViewTxn(func(txn *simpledb.Txn) error {
+		entries, err := txn.Scan(logKey(0), logKey(math.MaxUint64))
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+		logs.first, err = logKeyIndex(entries[0].Key)
+		if err != nil {
+			return err
+		}
+		logs.last, err = logKeyIndex(entries[len(entries)-1].Key)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+func logKey(index uint64) string {
+	buf := make([]byte, len(logPrefix)+8)
+	copy(buf, logPrefix)
+	binary.BigEndian.PutUint64(buf[len(logPrefix):], index)
+	return string(buf)
+}
+
+func logKeyIndex(key string) (uint64, error) {
+	if len(key) != len(logPrefix)+8 || key[:len(logPrefix)] != logPrefix {
+		return 0, fmt.Errorf("invalid log key: %q", key)
+	}
+	return binary.BigEndian.Uint64([]byte(key[len(logPrefix):])), nil
+}
+
+// migrateLegacy rewrites log entries stored under little-endian keys
+func (logs *logStore) migrateLegacy() error {
+	return logs.db.UpdateTxn(func(txn *simpledb.Txn) error {
+		startKey := legacyLogPrefix + string(make([]byte, 8))
+		endKey := legacyLogPrefix + "\xff\xff\xff\xff\xff\xff\xff\xff"
+		entries, err := txn.Scan(startKey, endKey)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if len(entry.Key) != len(legacyLogPrefix)+8 {
+				continue
+			}
+			value, ok := entry.Attributes[logAttribute]
+			if !ok {
+				continue
+			}
+			var log raft.Log
+			if err := decodeMsgPack(value.Data, &log); err != nil {
+				return err
+			}
+			txn.Write(logKey(log.Index), entry.Attributes)
+			txn.Delete(entry.Key)
+		}
+		return nil
+	})
+}
+
+// FirstIndex returns the first index written. 0 for no entries.
+func (logs *logStore) FirstIndex() (uint64, error) {
+	logs.mu.RLock()
+	defer logs.mu.RUnlock()
+	return logs.first, nil
+}
+
+// LastIndex returns the last index written. 0 for no entries.
+func (logs *logStore) LastIndex() (uint64, error) {
+	logs.mu.RLock()
+	defer logs.mu.RUnlock()
+	return logs.last, nil
+}
+
+// GetLog gets a log entry at a given index.
+func (logs *logStore) GetLog(index uint64, log *raft.Log) error {
+	return logs.db.ViewTxn(func(txn *simpledb.Txn) error {
+		entry, err := txn.Read(logKey(index))
+		if err != nil {
+			if _, ok := err.(*simpledb.ErrKeyNotFound); ok {
+				return raft.ErrLogNotFound
+			}
+			return err
+		}
+		if value, ok := entry.Attributes[logAttribute]; ok {
+			return decodeMsgPack(value.Data, log)
+		}
+		return fmt.Errorf("log entry %d has no attribute '%v'", index, logAttribute)
+	})
+}
+
+// StoreLog stores a log entry.
+func (logs *logStore) StoreLog(log *raft.Log) error {
+	return logs.StoreLogs([]*raft.Log{log})
+}
+
+// StoreLogs stores multiple log entries in a single transaction.
+func (logs *logStore) StoreLogs(batch []*raft.Log) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	err := logs.db.UpdateTxn(func(txn *simpledb.Txn) error {
+		for _, log := range batch {
+			buf, err := encodeMsgPack(log)
+			if err != nil {
+				return err
+			}
+			value, err := simpledb.CreateValue(buf.Bytes())
+			if err != nil {
+				return err
+			}
+			txn.Write(logKey(log.Index), map[string]*simpledb.Value{logAttribute: value})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	logs.mu.Lock()
+	defer logs.mu.Unlock()
+	for _, log := range batch {
+		if logs.first == 0 || log.Index < logs.first {
+			logs.first = log.Index
+		}
+		if log.Index > logs.last {
+			logs.last = log.Index
+		}
+	}
+	return nil
+}
+
+// DeleteRange deletes a range of log entries. The range is inclusive.
+func (logs *logStore) DeleteRange(min, max uint64) error {
+	logs.mu.Lock()
+	defer logs.mu.Unlock()
+	if logs.last == 0 || max < logs.first || min > logs.last {
+		return nil
+	}
+	if min < logs.first {
+		min = logs.first
+	}
+	if max > logs.last {
+		max = logs.last
+	}
+	err := logs.db.UpdateTxn(func(txn *simpledb.Txn) error {
+		for index := min; index <= max; index++ {
+			txn.Delete(logKey(index))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case min <= logs.first && max >= logs.last:
+		logs.first, logs.last = 0, 0
+	case min <= logs.first:
+		logs.first = max + 1
+	case max >= logs.last:
+		logs.last = min - 1
+	}
+	return nil
+}
+
+// RangeLogs returns all log entries in index order
+func (logs *logStore) RangeLogs() (result []*raft.Log, err error) {
+	err = logs.db.ViewTxn(func(txn *simpledb.Txn) error {
+		entries, err := txn.Scan(logKey(0), logKey(math.MaxUint64))
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if value, ok := entry.Attributes[logAttribute]; ok {
+				var log raft.Log
+				err := decodeMsgPack(value.Data, &log)
+				if err != nil {
+					return err
+				}
+				result = append(result, &log)
+			} else {
+				return fmt.Errorf("log entry has no attribute '%v': %v", logAttribute, entry.Attributes)
+			}
+		}
+		return nil
+	})
+	return result, err
+}
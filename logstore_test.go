@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/hashicorp/raft"
+	simpledb "github.com/triplewy/simpledb-embedded"
+)
+
+func TestMigrateLegacyLogs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "simpledb-logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := simpledb.NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Little-endian keys sort 256 between 1 and 2
+	const n = 300
+	legacyKey := func(index uint64) string {
+		buf := make([]byte, 8)
+		binary.LittleEndian.PutUint64(buf, index)
+		return legacyLogPrefix + string(buf)
+	}
+	err = db.UpdateTxn(func(txn *simpledb.Txn) error {
+		for index := uint64(1); index <= n; index++ {
+			buf, err := encodeMsgPack(&raft.Log{Index: index, Term: 1, Type: raft.LogCommand, Data: []byte(fmt.Sprint(index))})
+			if err != nil {
+				return err
+			}
+			value, err := simpledb.CreateValue(buf.Bytes())
+			if err != nil {
+				return err
+			}
+			txn.Write(legacyKey(index), map[string]*simpledb.Value{logAttribute: value})
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logs, err := newLogStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRange := func(first, last uint64) {
+		t.Helper()
+		if index, _ := logs.FirstIndex(); index != first {
+			t.Fatalf("first index %d, expected %d", index, first)
+		}
+		if index, _ := logs.LastIndex(); index != last {
+			t.Fatalf("last index %d, expected %d", index, last)
+		}
+		for index := uint64(1); index <= n; index++ {
+			var log raft.Log
+			err := logs.GetLog(index, &log)
+			if index < first || index > last {
+				if err != raft.ErrLogNotFound {
+					t.Fatalf("log %d: %v", index, err)
+				}
+				continue
+			}
+			if err != nil || log.Index != index || string(log.Data) != fmt.Sprint(index) {
+				t.Fatalf("log %d: %+v, %v", index, log, err)
+			}
+		}
+	}
+	checkRange(1, n)
+	for _, index := range []uint64{1, 256, n} {
+		if _, err := db.StartTxn().Read(legacyKey(index)); err == nil {
+			t.Fatalf("legacy key of log %d was kept", index)
+		}
+	}
+
+	if err := logs.DeleteRange(1, 100); err != nil {
+		t.Fatal(err)
+	}
+	checkRange(101, n)
+	if err := logs.DeleteRange(250, n); err != nil {
+		t.Fatal(err)
+	}
+	checkRange(101, 249)
+
+	// Reopening finds the same range and migrates nothing again
+	if logs, err = newLogStore(db); err != nil {
+		t.Fatal(err)
+	}
+	checkRange(101, 249)
+	all, err := logs.RangeLogs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 149 {
+		t.Fatalf("%d logs in the range", len(all))
+	}
+	for i, log := range all {
+		if log.Index != uint64(101+i) {
+			t.Fatalf("log %d of the range has index %d", i, log.Index)
+		}
+	}
+}
@@ -2,36 +2,110 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"syscall"
 )
 
+var configFile string
+var printConfig bool
+var nodeID string
 var dataDir string
+var bindAddr string
+var rpcAdvertise string
+var raftAdvertise string
 var rpcPort int
 var raftPort int
+var httpPort int
+var nonvoter bool
+var join string
 
 func init() {
+	flag.StringVar(&configFile, "config", os.Getenv(envPrefix+"CONFIG"), "YAML config file")
+	flag.BoolVar(&printConfig, "print-config", false, "print the resolved config and exit")
+	flag.StringVar(&nodeID, "node-id", "", "raft server ID, persisted in the data directory on first start")
 	flag.StringVar(&dataDir, "data", "/tmp/simpledb", "data directory for simpleDB")
+	flag.StringVar(&bindAddr, "bind", "", "host to bind listeners to")
+	flag.StringVar(&rpcAdvertise, "rpc-advertise", "", "rpc host:port advertised to clients")
+	flag.StringVar(&raftAdvertise, "raft-advertise", "", "raft host:port advertised to other nodes")
 	flag.IntVar(&rpcPort, "rpc", 30000, "rpc port for node")
 	flag.IntVar(&raftPort, "raft", 30001, "raft port for node")
+	flag.IntVar(&httpPort, "http", 30002, "http port for metrics and health probes")
+	flag.BoolVar(&nonvoter, "nonvoter", false, "start as a read-only learner instead of bootstrapping a cluster")
+	flag.StringVar(&join, "join", "", "comma-separated rpc addresses of cluster members to join as a nonvoter")
 }
+
+// loadConfig resolves the config from defaults, the config file, environment
+// variables and flags, in increasing order of precedence
+func loadConfig() (*Config, error) {
+	config := DefaultConfig()
+	if configFile != "" {
+		if err := config.LoadFile(configFile); err != nil {
+			return nil, err
+		}
+	}
+	if err := config.LoadEnv(); err != nil {
+		return nil, err
+	}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "node-id":
+			config.NodeID = nodeID
+		case "data":
+			config.DataDir = dataDir
+		case "bind":
+			config.BindAddr = bindAddr
+		case "rpc-advertise":
+			config.RPCAdvertise = rpcAdvertise
+		case "raft-advertise":
+			config.RaftAdvertise = raftAdvertise
+		case "rpc":
+			config.RPCPort = rpcPort
+		case "raft":
+			config.RaftPort = raftPort
+		case "http":
+			config.HTTPPort = httpPort
+		case "nonvoter":
+			config.Nonvoter = nonvoter
+		case "join":
+			config.Join = join
+		}
+	})
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
 func main() {
 	flag.Parse()
 
-	config := &Config{
-		dataDir:  dataDir,
-		rpcPort:  rpcPort,
-		raftPort: raftPort,
+	config, err := loadConfig()
+	if err != nil {
+		log.Fatal(err)
 	}
-	_, err := NewNode(config)
+	if printConfig {
+		buf, err := config.Marshal()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Print(string(buf))
+		return
+	}
+	node, err := NewNode(config)
 	if err != nil {
-		log.Fatalf(err.Error())
+		log.Fatal(err)
 	}
 
 	log.Println("SimpleDB started successfully")
 	terminate := make(chan os.Signal, 1)
-	signal.Notify(terminate, os.Interrupt)
-	<-terminate
+	signal.Notify(terminate, os.Interrupt, syscall.SIGTERM)
+	sig := <-terminate
+	log.Printf("SimpleDB received %v, shutting down", sig)
+	if err := node.Shutdown(); err != nil {
+		log.Fatal(err)
+	}
 	log.Println("SimpleDB exiting")
 }
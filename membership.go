@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/raft"
+	simpledb "github.com/triplewy/simpledb-embedded"
+	pb "github.com/triplewy/simpledb/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// memberPrefix keys the rpc address and feature version of each server
+const memberPrefix = internalPrefix + "member/"
+
+const featureVersionAttribute = "feature_version"
+
+// memberInterval is how often a node checks that it is registered with the
+// current leader and refreshes the cluster feature version
+const memberInterval = time.Second
+
+func memberKey(id raft.ServerID) string {
+	return memberPrefix + string(id)
+}
+
+// RegisterRPC records the rpc address and feature version of a server. Must
+// be called on the leader. Nothing is proposed if the record is unchanged.
+func (node *Node) RegisterRPC(ctx context.Context, msg *pb.MemberMsg) (*pb.OkMsg, error) {
+	if msg.Id == "" || msg.FeatureVersion == 0 || msg.FeatureVersion > 255 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid member: %v", msg)
+	}
+	if node.raft.State() != raft.Leader {
+		return nil, status.Errorf(codes.FailedPrecondition, "%v; leader is %v", raft.ErrNotLeader, node.leaderHint())
+	}
+	rpcAddress, version, err := node.readMember(raft.ServerID(msg.Id))
+	if err != nil {
+		return nil, err
+	}
+	if rpcAddress == msg.RpcAddress && uint32(version) == msg.FeatureVersion {
+		return &pb.OkMsg{Ok: true}, nil
+	}
+	err = node.applyCommand(&Command{
+		Op:  Register,
+		Key: memberKey(raft.ServerID(msg.Id)),
+		Values: map[string]*simpledb.Value{
+			rpcAddressAttribute:     {DataType: simpledb.String, Data: []byte(msg.RpcAddress)},
+			featureVersionAttribute: {DataType: simpledb.Uint, Data: uint64ToBytes(uint64(msg.FeatureVersion))},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &pb.OkMsg{Ok: true}, nil
+}
+
+// readMember returns the registered rpc address and feature version of a
+// server, or a zero version if it has not registered
+func (node *Node) readMember(id raft.ServerID) (string, uint8, error) {
+	entry, err := node.store.db.StartTxn().Read(memberKey(id))
+	if err != nil {
+		if _, ok := err.(*simpledb.ErrKeyNotFound); ok {
+			return "", 0, nil
+		}
+		return "", 0, err
+	}
+	var rpcAddress string
+	var version uint8
+	if value, ok := entry.Attributes[rpcAddressAttribute]; ok {
+		rpcAddress = string(value.Data)
+	}
+	if value, ok := entry.Attributes[featureVersionAttribute]; ok {
+		version = uint8(bytesToUint64(value.Data))
+	}
+	return rpcAddress, version, nil
+}
+
+// clusterFeatureVersion returns the highest feature version supported by
+// every server in the cluster. Servers that have not registered are assumed
+// to only support legacy commands.
+func (node *Node) clusterFeatureVersion() (uint8, error) {
+	f := node.raft.GetConfiguration()
+	if err := f.Error(); err != nil {
+		return 0, err
+	}
+	min := featureVersion
+	for _, server := range f.Configuration().Servers {
+		_, version, err := node.readMember(server.ID)
+		if err != nil {
+			return 0, err
+		}
+		if version == 0 {
+			version = featureLegacy
+		}
+		if version < min {
+			min = version
+		}
+	}
+	return min, nil
+}
+
+// cachedFeatureVersion returns the cluster feature version as of the last
+// refresh by watchMembership, which gates the commands this node proposes
+func (node *Node) cachedFeatureVersion() uint8 {
+	if version := uint8(atomic.LoadUint32(&node.clusterVersion)); version > 0 {
+		return version
+	}
+	return featureLegacy
+}
+
+// watchMembership registers this node with every new leader and refreshes
+// the cluster feature version, until the node shuts down
+func (node *Node) watchMembership() {
+	ticker := time.NewTicker(memberInterval)
+	defer ticker.Stop()
+	var registeredWith raft.ServerAddress
+	for {
+		if version, err := node.clusterFeatureVersion(); err == nil {
+			atomic.StoreUint32(&node.clusterVersion, uint32(version))
+		}
+		if leader := node.raft.Leader(); leader != "" && leader != registeredWith {
+			if err := node.register(); err != nil {
+				log.Printf("failed to register with leader %v: %v", leader, err)
+			} else {
+				registeredWith = leader
+			}
+		}
+		select {
+		case <-node.shutdownCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// register records this node's rpc address and feature version with the leader
+func (node *Node) register() error {
+	msg := &pb.MemberMsg{
+		Id:             string(node.localID()),
+		RpcAddress:     node.rpcAdvertise,
+		FeatureVersion: uint32(featureVersion),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), raftTimeout)
+	defer cancel()
+	if node.raft.State() == raft.Leader {
+		_, err := node.RegisterRPC(ctx, msg)
+		return err
+	}
+	addr, err := node.leaderRPCAddr()
+	if err != nil {
+		return err
+	}
+	opts, err := node.dialOptions()
+	if err != nil {
+		return err
+	}
+	conn, err := node.forwarder.conn(addr, opts)
+	if err != nil {
+		return err
+	}
+	_, err = pb.NewAdminClient(conn).RegisterRPC(ctx, msg)
+	return err
+}
+
+// checkFeature returns an error if the cluster does not support op yet
+func (node *Node) checkFeature(op uint8) error {
+	handler, ok := opHandlers[op]
+	if !ok {
+		return fmt.Errorf("unknown command: %v", op)
+	}
+	return node.checkVersion(handler.name, handler.version)
+}
+
+// checkVersion returns an error if the cluster does not support a feature
+// version yet
+func (node *Node) checkVersion(name string, required uint8) error {
+	if version := node.cachedFeatureVersion(); required > version {
+		return status.Errorf(codes.Unimplemented, "%v requires feature version %d, cluster supports %d", name, required, version)
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+const metricsNamespace = "simpledb"
+
+var (
+	rpcDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "rpc",
+		Name:      "duration_seconds",
+		Help:      "Latency of gRPC requests by method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+	rpcErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "rpc",
+		Name:      "errors_total",
+		Help:      "Number of gRPC requests that returned an error, by method and status code.",
+	}, []string{"method", "code"})
+	fsmApplyDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "fsm",
+		Name:      "apply_duration_seconds",
+		Help:      "Time taken to apply a committed log entry to the FSM.",
+		Buckets:   prometheus.DefBuckets,
+	})
+	snapshotDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "fsm",
+		Name:      "snapshot_duration_seconds",
+		Help:      "Time taken by FSM snapshot phases (snapshot, persist, restore).",
+		Buckets:   []float64{.01, .05, .1, .5, 1, 5, 10, 30, 60, 300},
+	}, []string{"phase"})
+	logCacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "raft",
+		Name:      "log_cache_requests_total",
+		Help:      "Number of raft log reads served by the log cache, by result (hit, miss).",
+	}, []string{"result"})
+)
+
+// raftStatGauges are numeric fields of raft.Stats() exported as gauges
+var raftStatGauges = []string{
+	"term",
+	"last_log_index",
+	"last_log_term",
+	"commit_index",
+	"applied_index",
+	"fsm_pending",
+	"last_snapshot_index",
+	"last_snapshot_term",
+	"num_peers",
+}
+
+// nodeCollector exports raft.Stats() and on-disk sizes of the node at scrape time
+type nodeCollector struct {
+	node        *Node
+	stats       map[string]*prometheus.Desc
+	state       *prometheus.Desc
+	leader      *prometheus.Desc
+	lastContact *prometheus.Desc
+	lag         *prometheus.Desc
+	diskUsage   *prometheus.Desc
+}
+
+func newNodeCollector(node *Node) *nodeCollector {
+	c := &nodeCollector{
+		node:  node,
+		stats: make(map[string]*prometheus.Desc),
+		state: prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "raft", "state"),
+			"Current raft state of the node; 1 for the active state.", []string{"state"}, nil),
+		leader: prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "raft", "leader"),
+			"Address of the current known leader; always 1.", []string{"address"}, nil),
+		lastContact: prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "raft", "last_contact_seconds"),
+			"Time since the node last heard from the leader.", nil, nil),
+		lag: prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "raft", "replication_lag_entries"),
+			"Number of log entries committed by the leader not yet applied by the node.", nil, nil),
+		diskUsage: prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "db", "size_bytes"),
+			"On-disk size of the embedded database and snapshot directories.", []string{"dir"}, nil),
+	}
+	for _, name := range raftStatGauges {
+		c.stats[name] = prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "raft", name),
+			"Value of raft stat '"+name+"'.", nil, nil)
+	}
+	return c
+}
+
+// Describe implements prometheus.Collector
+func (c *nodeCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range c.stats {
+		ch <- desc
+	}
+	ch <- c.state
+	ch <- c.leader
+	ch <- c.lastContact
+	ch <- c.lag
+	ch <- c.diskUsage
+}
+
+// Collect implements prometheus.Collector
+func (c *nodeCollector) Collect(ch chan<- prometheus.Metric) {
+	if c.node.raft != nil {
+		stats := c.node.raft.Stats()
+		for name, desc := range c.stats {
+			value, err := strconv.ParseFloat(stats[name], 64)
+			if err != nil {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value)
+		}
+		for _, state := range []raft.RaftState{raft.Follower, raft.Candidate, raft.Leader, raft.Shutdown} {
+			value := 0.0
+			if stats["state"] == state.String() {
+				value = 1
+			}
+			ch <- prometheus.MustNewConstMetric(c.state, prometheus.GaugeValue, value, state.String())
+		}
+		ch <- prometheus.MustNewConstMetric(c.lag, prometheus.GaugeValue, float64(c.node.replicationLag()))
+		if leader := c.node.raft.Leader(); leader != "" {
+			ch <- prometheus.MustNewConstMetric(c.leader, prometheus.GaugeValue, 1, string(leader))
+		}
+		switch lastContact := stats["last_contact"]; lastContact {
+		case "", "never":
+		case "0":
+			ch <- prometheus.MustNewConstMetric(c.lastContact, prometheus.GaugeValue, 0)
+		default:
+			if d, err := time.ParseDuration(lastContact); err == nil {
+				ch <- prometheus.MustNewConstMetric(c.lastContact, prometheus.GaugeValue, d.Seconds())
+			}
+		}
+	}
+	for _, dir := range []string{"data", "snapshots"} {
+		size, err := dirSize(filepath.Join(c.node.Config.DataDir, dir))
+		if err != nil {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(c.diskUsage, prometheus.GaugeValue, float64(size), dir)
+	}
+}
+
+// newMetricsRegistry returns a registry with process, rpc, fsm and node metrics
+func newMetricsRegistry(node *Node) *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		prometheus.NewGoCollector(),
+		rpcDuration,
+		rpcErrors,
+		fsmApplyDuration,
+		snapshotDuration,
+		logCacheRequests,
+		newNodeCollector(node),
+	)
+	return registry
+}
+
+// metricsInterceptor records latency and error counts of unary RPCs
+func metricsInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	observeSince(rpcDuration.WithLabelValues(info.FullMethod), start)
+	if err != nil {
+		rpcErrors.WithLabelValues(info.FullMethod, status.Code(err).String()).Inc()
+	}
+	return resp, err
+}
+
+// observeSince records the time elapsed since start
+func observeSince(o prometheus.Observer, start time.Time) {
+	o.Observe(time.Since(start).Seconds())
+}
+
+// dirSize returns the total size of regular files under dir
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
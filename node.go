@@ -1,111 +1,283 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net"
+	"net/http"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/hashicorp/raft"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	pb "github.com/triplewy/simpledb/grpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 const (
-	retainSnapshotCount = 2
-	raftTimeout         = 10 * time.Second
+	raftTimeout     = 10 * time.Second
+	shutdownTimeout = 20 * time.Second
 )
 
 // Node represents database node
 type Node struct {
-	Config *Config
-	Server *grpc.Server
-	store  *store
-	raft   *raft.Raft
+	Config       *Config
+	Server       *grpc.Server
+	HTTPServer   *http.Server
+	health       *health.Server
+	store        *store
+	raft         *raft.Raft
+	raftConfig   *raft.Config
+	rpcAddr      net.Addr
+	rpcAdvertise string
+	raftAddr     raft.ServerAddress
+	forwarder    forwarder
+	tasks        tasks
+	progress     progressTracker
+	// tableMu serializes choosing the IDs of new tables
+	tableMu sync.Mutex
+	// clusterVersion is the cached cluster feature version, accessed atomically
+	clusterVersion uint32
+	// barrierTerm is the last term this node committed a read barrier in as
+	// leader, accessed atomically
+	barrierTerm uint64
+	shutdownCh  chan struct{}
 }
 
 // NewNode creates a node with a gRPC server and database
 func NewNode(config *Config) (*Node, error) {
 	node := new(Node)
 	node.Config = config
+	node.shutdownCh = make(chan struct{})
 
-	err := node.newStore()
+	id, err := resolveNodeID(config)
 	if err != nil {
 		return nil, err
 	}
-	err = node.setupRPC()
+	config.NodeID = id
+
+	err = node.newStore()
 	if err != nil {
 		return nil, err
 	}
+	// Release what was set up so far if a later step fails
+	defer func() {
+		if err == nil {
+			return
+		}
+		close(node.shutdownCh)
+		if node.Server != nil {
+			node.Server.Stop()
+		}
+		if node.raft != nil {
+			node.raft.Shutdown()
+		}
+		node.store.db.Close()
+	}()
+	// Raft is set up first so that RPCs never see a nil node.raft
 	err = node.setupRaft()
 	if err != nil {
 		return nil, err
 	}
+	err = node.setupRPC()
+	if err != nil {
+		return nil, err
+	}
+	err = node.setupHTTP()
+	if err != nil {
+		return nil, err
+	}
+	go node.watchHealth()
+	go node.watchLeadership()
+	go node.watchMembership()
+	go node.watchProgress()
+	go node.watchSessions()
 	return node, nil
 }
 
 func (node *Node) setupRPC() error {
-	addr := fmt.Sprintf(":%d", node.Config.rpcPort)
+	addr := net.JoinHostPort(node.Config.BindAddr, fmt.Sprint(node.Config.RPCPort))
 	listener, err := net.Listen("tcp", addr)
 	if err != nil {
 		return err
 	}
 
-	node.Server = grpc.NewServer()
+	opts := []grpc.ServerOption{grpc.UnaryInterceptor(metricsInterceptor)}
+	if node.Config.TLS.CertFile != "" {
+		creds, err := credentials.NewServerTLSFromFile(node.Config.TLS.CertFile, node.Config.TLS.KeyFile)
+		if err != nil {
+			return fmt.Errorf("tls credentials: %s", err)
+		}
+		opts = append(opts, grpc.Creds(creds))
+	}
+	node.rpcAddr = listener.Addr()
+	node.rpcAdvertise, err = advertiseAddr(node.Config.RPCAdvertise, node.rpcAddr.(*net.TCPAddr).Port)
+	if err != nil {
+		// Only reported to clients, so fall back to the listener address
+		node.rpcAdvertise = node.rpcAddr.String()
+	}
+	node.Server = grpc.NewServer(opts...)
 	pb.RegisterSimpleDbServer(node.Server, node)
+	pb.RegisterAdminServer(node.Server, node)
+	node.health = newHealthServer()
+	healthpb.RegisterHealthServer(node.Server, node.health)
 
 	go func() {
-		if err := node.Server.Serve(listener); err != nil {
+		// Serve fails with grpc.ErrServerStopped if the node was stopped
+		// before it started serving
+		if err := node.Server.Serve(listener); err != nil && err != grpc.ErrServerStopped {
 			log.Fatalf("failed to serve: %v", err)
 		}
 	}()
 	return nil
 }
 
-func (node *Node) setupRaft() error {
-	// Get node outbound ip
-	id, err := getOutboundIP()
+func (node *Node) setupHTTP() error {
+	addr := net.JoinHostPort(node.Config.BindAddr, fmt.Sprint(node.Config.HTTPPort))
+	listener, err := net.Listen("tcp", addr)
 	if err != nil {
 		return err
 	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(newMetricsRegistry(node), promhttp.HandlerOpts{}))
+	mux.HandleFunc("/healthz", node.healthzHandler)
+	mux.HandleFunc("/readyz", node.readyzHandler)
+	node.HTTPServer = &http.Server{Handler: mux}
+
+	go func() {
+		if err := node.HTTPServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("failed to serve http: %v", err)
+		}
+	}()
+	return nil
+}
+
+func (node *Node) setupRaft() error {
 	// Setup Raft configuration.
-	config := raft.DefaultConfig()
-	config.LocalID = raft.ServerID(id.String())
+	config := node.Config.raftConfig()
+	node.raftConfig = config
 
 	// Setup Raft communication.
-	addr, err := net.ResolveTCPAddr("tcp", fmt.Sprintf(":%d", node.Config.raftPort))
-	if err != nil {
-		return err
-	}
-	transport, err := raft.NewTCPTransport(fmt.Sprintf(":%d", node.Config.raftPort), addr, 3, 10*time.Second, os.Stderr)
-	if err != nil {
-		return err
+	transport := node.Config.transport
+	if transport == nil {
+		bind := net.JoinHostPort(node.Config.BindAddr, fmt.Sprint(node.Config.RaftPort))
+		advertise, err := advertiseAddr(node.Config.RaftAdvertise, node.Config.RaftPort)
+		if err != nil {
+			return err
+		}
+		addr, err := net.ResolveTCPAddr("tcp", advertise)
+		if err != nil {
+			return err
+		}
+		transport, err = raft.NewTCPTransport(bind, addr, 3, 10*time.Second, os.Stderr)
+		if err != nil {
+			return err
+		}
 	}
 	// Create the snapshot store. This allows the Raft to truncate the log.
-	snapshots, err := raft.NewFileSnapshotStore(filepath.Join(node.Config.dataDir, "snapshots"), retainSnapshotCount, os.Stderr)
+	snapshots, err := raft.NewFileSnapshotStore(filepath.Join(node.Config.DataDir, "snapshots"), node.Config.retainSnapshots(), os.Stderr)
 	if err != nil {
 		return fmt.Errorf("file snapshot store: %s", err)
 	}
+	logs := newLogCache(node.Config.logCacheSize(), node.store.logs)
 	// Create raft node
-	ra, err := raft.NewRaft(config, node.store, node.store, node.store, snapshots, transport)
+	ra, err := raft.NewRaft(config, node.store, logs, node.store, snapshots, transport)
 	if err != nil {
 		return fmt.Errorf("new raft: %s", err)
 	}
 	node.raft = ra
+	node.raftAddr = transport.LocalAddr()
+
+	if node.Config.Nonvoter {
+		if node.Config.Join != "" {
+			go node.join(transport.LocalAddr())
+		}
+		return nil
+	}
 
-	// if enableSingle {
-	configuration := raft.Configuration{
-		Servers: []raft.Server{
+	servers := node.Config.servers
+	if len(servers) == 0 {
+		servers = []raft.Server{
 			{
 				ID:      config.LocalID,
 				Address: transport.LocalAddr(),
 			},
-		},
+		}
 	}
-	node.raft.BootstrapCluster(configuration)
-	// }
+	// Fails with raft.ErrCantBootstrap if the node already has state, which is
+	// expected on restart.
+	node.raft.BootstrapCluster(raft.Configuration{Servers: servers})
 
 	return nil
 }
+
+// Shutdown stops the node in order: it reports itself as not serving, stops
+// accepting RPCs and drains in-flight ones, hands off leadership if it is the
+// leader, then shuts down raft and closes the database.
+func (node *Node) Shutdown() error {
+	close(node.shutdownCh)
+	node.health.Shutdown()
+
+	stopped := make(chan struct{})
+	go func() {
+		node.Server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(shutdownTimeout):
+		log.Println("timed out draining rpcs, closing open connections")
+		node.Server.Stop()
+	}
+
+	if node.raft.State() == raft.Leader && node.hasOtherVoters() {
+		if err := node.raft.LeadershipTransfer().Error(); err != nil {
+			log.Printf("leadership transfer failed: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := node.HTTPServer.Shutdown(ctx); err != nil {
+		node.HTTPServer.Close()
+	}
+	node.forwarder.Close()
+	if err := node.raft.Shutdown().Error(); err != nil {
+		return err
+	}
+	return node.store.db.Close()
+}
+
+// hasOtherVoters reports whether any other server could take over leadership
+func (node *Node) hasOtherVoters() bool {
+	f := node.raft.GetConfiguration()
+	if f.Error() != nil {
+		return false
+	}
+	for _, server := range f.Configuration().Servers {
+		if server.Suffrage == raft.Voter && server.ID != node.raftConfig.LocalID {
+			return true
+		}
+	}
+	return false
+}
+
+// kill stops the node immediately without draining RPCs or handing off
+// leadership, as if the process crashed
+func (node *Node) kill() error {
+	close(node.shutdownCh)
+	node.Server.Stop()
+	node.HTTPServer.Close()
+	node.forwarder.Close()
+	if err := node.raft.Shutdown().Error(); err != nil {
+		return err
+	}
+	return node.store.db.Close()
+}
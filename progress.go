@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+	pb "github.com/triplewy/simpledb/grpc"
+)
+
+// Raft does not expose the leader's view of its followers, so the leader
+// polls every other server over rpc and records when it last answered and
+// how far it had applied the log. Polls carry the leader's commit index, so
+// followers can measure their own lag against it.
+
+const (
+	// progressInterval is how often the leader polls every other server
+	progressInterval = 100 * time.Millisecond
+	// progressTimeout bounds a single poll
+	progressTimeout = 500 * time.Millisecond
+	// leaderCommitExpiry is how long a follower trusts the last commit index
+	// it received from the leader to bound its lag
+	leaderCommitExpiry = 5 * progressInterval
+)
+
+// serverProgress is what the leader last learned from a server, and the
+// leader's commit index when it asked
+type serverProgress struct {
+	contact      time.Time
+	commitIndex  uint64
+	appliedIndex uint64
+}
+
+// progressTracker holds the progress of other servers while this node is
+// the leader, and the commit index of the last leader that polled it
+// otherwise
+type progressTracker struct {
+	mu      sync.Mutex
+	servers map[raft.ServerID]serverProgress
+	// leaderCommit is the commit index of the leader as of leaderCommitAt
+	leaderCommit   uint64
+	leaderCommitAt time.Time
+}
+
+func (t *progressTracker) get(id raft.ServerID) (serverProgress, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p, ok := t.servers[id]
+	return p, ok
+}
+
+func (t *progressTracker) set(id raft.ServerID, p serverProgress) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.servers == nil {
+		t.servers = make(map[raft.ServerID]serverProgress)
+	}
+	t.servers[id] = p
+}
+
+func (t *progressTracker) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.servers = nil
+}
+
+func (t *progressTracker) setLeaderCommit(commitIndex uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if commitIndex > t.leaderCommit {
+		t.leaderCommit = commitIndex
+	}
+	t.leaderCommitAt = time.Now()
+}
+
+// getLeaderCommit returns the last commit index received from a leader and
+// when it was received, or false if no leader polled this node yet
+func (t *progressTracker) getLeaderCommit() (uint64, time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.leaderCommit, t.leaderCommitAt, !t.leaderCommitAt.IsZero()
+}
+
+// ProgressRPC records the commit index of the leader polling this node and
+// returns how far this node has applied the log
+func (node *Node) ProgressRPC(ctx context.Context, msg *pb.ProgressMsg) (*pb.ProgressMsg, error) {
+	node.progress.setLeaderCommit(msg.CommitIndex)
+	return &pb.ProgressMsg{AppliedIndex: node.raft.AppliedIndex()}, nil
+}
+
+// watchProgress polls every other server while this node is the leader,
+// until the node shuts down
+func (node *Node) watchProgress() {
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	for {
+		if node.raft.State() == raft.Leader {
+			node.pollProgress()
+		} else {
+			node.progress.reset()
+		}
+		select {
+		case <-node.shutdownCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pollProgress asks every other registered server for its progress.
+// Servers that do not answer keep their previous progress.
+func (node *Node) pollProgress() {
+	f := node.raft.GetConfiguration()
+	if f.Error() != nil {
+		return
+	}
+	opts, err := node.dialOptions()
+	if err != nil {
+		return
+	}
+	commitIndex := node.raft.CommitIndex()
+	var wg sync.WaitGroup
+	for _, server := range f.Configuration().Servers {
+		if server.ID == node.localID() {
+			continue
+		}
+		addr, _, err := node.readMember(server.ID)
+		if err != nil || addr == "" {
+			continue
+		}
+		wg.Add(1)
+		go func(id raft.ServerID, addr string) {
+			defer wg.Done()
+			conn, err := node.forwarder.conn(addr, opts)
+			if err != nil {
+				return
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), progressTimeout)
+			defer cancel()
+			reply, err := pb.NewAdminClient(conn).ProgressRPC(ctx, &pb.ProgressMsg{CommitIndex: commitIndex})
+			if err != nil {
+				return
+			}
+			node.progress.set(id, serverProgress{
+				contact:      time.Now(),
+				commitIndex:  commitIndex,
+				appliedIndex: reply.AppliedIndex,
+			})
+		}(server.ID, addr)
+	}
+	wg.Wait()
+}
+
+// serverLastContact returns milliseconds since the leader last heard from a
+// server, or -1 if this node is not the leader or never heard from it
+func (node *Node) serverLastContact(id raft.ServerID) int64 {
+	if id == node.localID() {
+		return node.lastContact()
+	}
+	if node.raft.State() != raft.Leader {
+		return -1
+	}
+	p, ok := node.progress.get(id)
+	if !ok {
+		return -1
+	}
+	return int64(time.Since(p.contact) / time.Millisecond)
+}
+
+// serverReplicationLag returns the number of entries the leader had committed
+// but a server had not applied when the leader last polled it, or -1 if this
+// node is not the leader or never heard from the server
+func (node *Node) serverReplicationLag(id raft.ServerID) int64 {
+	if node.raft.State() != raft.Leader {
+		return -1
+	}
+	if id == node.localID() {
+		return int64(node.replicationLag())
+	}
+	p, ok := node.progress.get(id)
+	if !ok {
+		return -1
+	}
+	return int64(replicationLag(p.commitIndex, p.appliedIndex))
+}
+
+// replicationLag returns the number of entries committed by the leader that
+// this node has not applied yet. Until a leader polls it, a follower can only
+// compare with its own commit index.
+func (node *Node) replicationLag() uint64 {
+	commitIndex := node.raft.CommitIndex()
+	if node.raft.State() != raft.Leader {
+		if leaderCommit, _, ok := node.progress.getLeaderCommit(); ok && leaderCommit > commitIndex {
+			commitIndex = leaderCommit
+		}
+	}
+	return replicationLag(commitIndex, node.raft.AppliedIndex())
+}
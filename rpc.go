@@ -1,19 +1,45 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/hashicorp/raft"
 	simpledb "github.com/triplewy/simpledb-embedded"
 	pb "github.com/triplewy/simpledb/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
-// ReadRPC calls node's DB Read API
+// ReadRPC calls node's DB Read API. Reads with a max staleness that this
+// node does not meet are forwarded to the leader.
 func (node *Node) ReadRPC(ctx context.Context, msg *pb.ReadMsg) (*pb.Entry, error) {
+	if msg.MaxStaleness != nil && !node.withinStaleness(msg.MaxStaleness) {
+		ctx, leader, err := node.leaderClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return leader.ReadRPC(ctx, msg)
+	}
+	if msg.MaxStaleness == nil && msg.Linearizable {
+		if err := node.linearizableRead(ctx); err != nil {
+			return nil, err
+		}
+	}
+	_, key, err := node.tableKey(msg.Table, msg.Key)
+	if err != nil {
+		return nil, err
+	}
 	txn := node.store.db.StartTxn()
-	entry, err := txn.Read(msg.Key)
+	entry, err := txn.Read(key)
 	if err != nil {
+		if _, ok := err.(*simpledb.ErrKeyNotFound); ok {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
 		return nil, err
 	}
 	values := make(map[string]*simpledb.Value)
@@ -26,27 +52,71 @@ func (node *Node) ReadRPC(ctx context.Context, msg *pb.ReadMsg) (*pb.Entry, erro
 	if err != nil {
 		return nil, err
 	}
+	projected, err := projectPaths(entry.Attributes, msg.Paths)
+	if err != nil {
+		return nil, err
+	}
+	attributes = append(attributes, projected...)
 	return &pb.Entry{
-		Key:        entry.Key,
+		Key:        msg.Key,
 		Attributes: attributes,
 	}, nil
 }
 
-// ScanRPC calls node's DB Scan API
+// ScanRPC returns the entries of a table between two keys that match the
+// filter, forwarding to the leader if this node exceeds the max staleness.
 func (node *Node) ScanRPC(ctx context.Context, msg *pb.ScanMsg) (*pb.EntriesMsg, error) {
+	if len(msg.Filter) > maxFilterLength {
+		return nil, status.Errorf(codes.InvalidArgument, "filter is longer than %d bytes", maxFilterLength)
+	}
+	var f filter
+	if msg.Filter != "" {
+		var err error
+		if f, err = parseFilter(msg.Filter); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid filter: %v", err)
+		}
+	}
+	if msg.MaxStaleness != nil && !node.withinStaleness(msg.MaxStaleness) {
+		ctx, leader, err := node.leaderClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return leader.ScanRPC(ctx, msg)
+	}
+	if msg.MaxStaleness == nil && msg.Linearizable {
+		if err := node.linearizableRead(ctx); err != nil {
+			return nil, err
+		}
+	}
+	table, err := node.resolveTable(msg.Table)
+	if err != nil {
+		return nil, err
+	}
 	txn := node.store.db.StartTxn()
-	entries, err := txn.Scan(msg.StartKey, msg.EndKey)
+	entries, err := txn.Scan(table.key(msg.StartKey), table.key(msg.EndKey))
 	if err != nil {
 		return nil, err
 	}
 	result := []*pb.Entry{}
 	for _, entry := range entries {
-		attributes, err := valuesToAttributes(entry.Attributes)
+		if !table.contains(entry.Key) || (f != nil && !f.match(entry.Attributes)) {
+			continue
+		}
+		if msg.KeysOnly {
+			result = append(result, &pb.Entry{Key: table.userKey(entry.Key)})
+			continue
+		}
+		var attributes []*pb.Attribute
+		if len(msg.Paths) > 0 {
+			attributes, err = projectPaths(entry.Attributes, msg.Paths)
+		} else {
+			attributes, err = valuesToAttributes(entry.Attributes)
+		}
 		if err != nil {
 			return nil, err
 		}
 		result = append(result, &pb.Entry{
-			Key:        entry.Key,
+			Key:        table.userKey(entry.Key),
 			Attributes: attributes,
 		})
 	}
@@ -55,102 +125,290 @@ func (node *Node) ScanRPC(ctx context.Context, msg *pb.ScanMsg) (*pb.EntriesMsg,
 	}, nil
 }
 
-// UpdateRPC calls node's DB Update API
+// CountRPC returns the number of keys of a table in a range or with a prefix,
+// or of the whole table if neither is set. Counts with a max staleness that
+// this node does not meet are forwarded to the leader.
+func (node *Node) CountRPC(ctx context.Context, msg *pb.KeyRangeMsg) (*pb.CountMsg, error) {
+	if msg.Prefix != "" && (msg.StartKey != "" || msg.EndKey != "") {
+		return nil, status.Error(codes.InvalidArgument, "set either a prefix or start and end keys")
+	}
+	if msg.MaxStaleness != nil && !node.withinStaleness(msg.MaxStaleness) {
+		ctx, leader, err := node.leaderClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return leader.CountRPC(ctx, msg)
+	}
+	if msg.MaxStaleness == nil && msg.Linearizable {
+		if err := node.linearizableRead(ctx); err != nil {
+			return nil, err
+		}
+	}
+	table, err := node.resolveTable(msg.Table)
+	if err != nil {
+		return nil, err
+	}
+	prefix := table.key(msg.Prefix)
+	startKey, endKey := table.key(msg.StartKey), table.key(msg.EndKey)
+	if msg.Prefix != "" {
+		startKey, endKey = prefix, prefixEnd(prefix)
+	} else if msg.StartKey == "" && msg.EndKey == "" {
+		startKey, endKey = table.prefix(), table.end()
+	}
+	txn := node.store.db.StartTxn()
+	entries, err := txn.Scan(startKey, endKey)
+	if err != nil {
+		return nil, err
+	}
+	count := uint64(0)
+	for _, entry := range entries {
+		if !table.contains(entry.Key) || !strings.HasPrefix(entry.Key, prefix) {
+			continue
+		}
+		count++
+	}
+	return &pb.CountMsg{Count: count}, nil
+}
+
+// UpdateRPC calls node's DB Update API. Updates setting paths inside
+// documents are applied as UpdatePaths.
 func (node *Node) UpdateRPC(ctx context.Context, msg *pb.Entry) (*pb.OkMsg, error) {
-	values, err := attributesToValues(msg.Attributes)
+	table, key, err := node.tableKey(msg.Table, msg.Key)
+	if err != nil {
+		return nil, err
+	}
+	values, err := node.documentValues(msg.Attributes)
+	if err != nil {
+		return nil, err
+	}
+	paths, err := pathValues(msg.Paths)
 	if err != nil {
 		return nil, err
 	}
 	c := &Command{
 		Op:     Update,
-		Key:    msg.Key,
+		Key:    key,
 		Values: values,
+		Table:  uint64(table),
+		Paths:  paths,
 	}
-	buf, err := encodeMsgPack(c)
-	if err != nil {
-		return nil, err
+	if len(paths) > 0 {
+		c.Op = UpdatePaths
 	}
-	f := node.raft.Apply(buf.Bytes(), applyTimeout)
-	if e := f.(raft.Future); e.Error() != nil {
-		return nil, e.Error()
+	if err := setRequestID(c, msg.RequestId); err != nil {
+		return nil, err
 	}
-	resp := f.Response().(*fsmResponse)
-	if resp.err != nil {
-		return nil, resp.err
+	err = node.applyCommand(c)
+	if err != nil {
+		return nil, err
 	}
 	return &pb.OkMsg{Ok: true}, nil
 }
 
 // InsertRPC calls node's DB Insert API
 func (node *Node) InsertRPC(ctx context.Context, msg *pb.Entry) (*pb.OkMsg, error) {
-	values, err := attributesToValues(msg.Attributes)
+	table, key, err := node.tableKey(msg.Table, msg.Key)
+	if err != nil {
+		return nil, err
+	}
+	values, err := node.documentValues(msg.Attributes)
 	if err != nil {
 		return nil, err
 	}
 	c := &Command{
 		Op:     Insert,
-		Key:    msg.Key,
+		Key:    key,
 		Values: values,
+		Table:  uint64(table),
 	}
-	buf, err := encodeMsgPack(c)
-	if err != nil {
+	if err := setRequestID(c, msg.RequestId); err != nil {
 		return nil, err
 	}
-	f := node.raft.Apply(buf.Bytes(), applyTimeout)
-	if e := f.(raft.Future); e.Error() != nil {
-		return nil, e.Error()
-	}
-	resp := f.Response().(*fsmResponse)
-	if resp.err != nil {
-		return nil, resp.err
+	err = node.applyCommand(c)
+	if err != nil {
+		return nil, err
 	}
 	return &pb.OkMsg{Ok: true}, nil
 }
 
 // DeleteRPC calls node's DB Delete API
 func (node *Node) DeleteRPC(ctx context.Context, msg *pb.KeyMsg) (*pb.OkMsg, error) {
+	table, key, err := node.tableKey(msg.Table, msg.Key)
+	if err != nil {
+		return nil, err
+	}
 	c := &Command{
 		Op:     Delete,
-		Key:    msg.Key,
+		Key:    key,
 		Values: nil,
+		Table:  uint64(table),
+	}
+	if err := setRequestID(c, msg.RequestId); err != nil {
+		return nil, err
 	}
-	buf, err := encodeMsgPack(c)
+	err = node.applyCommand(c)
 	if err != nil {
 		return nil, err
 	}
-	f := node.raft.Apply(buf.Bytes(), applyTimeout)
-	if e := f.(raft.Future); e.Error() != nil {
-		return nil, e.Error()
+	return &pb.OkMsg{Ok: true}, nil
+}
+
+// DeleteRangeRPC deletes the entries ScanRPC returns for the same keys in a
+// single command and returns how many were removed
+func (node *Node) DeleteRangeRPC(ctx context.Context, msg *pb.RangeMsg) (*pb.CountMsg, error) {
+	table, startKey, err := node.tableKey(msg.Table, msg.StartKey)
+	if err != nil {
+		return nil, err
+	}
+	c := &Command{
+		Op:     DeleteRange,
+		Key:    startKey,
+		EndKey: table.key(msg.EndKey),
+		Table:  uint64(table),
+	}
+	return node.applyCount(c, msg.RequestId)
+}
+
+// DeletePrefixRPC deletes the entries whose key starts with a non-empty
+// prefix in a single command and returns how many were removed
+func (node *Node) DeletePrefixRPC(ctx context.Context, msg *pb.PrefixMsg) (*pb.CountMsg, error) {
+	if msg.Prefix == "" {
+		return nil, status.Error(codes.InvalidArgument, "prefix must not be empty")
+	}
+	table, prefix, err := node.tableKey(msg.Table, msg.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	c := &Command{
+		Op:    DeletePrefix,
+		Key:   prefix,
+		Table: uint64(table),
+	}
+	return node.applyCount(c, msg.RequestId)
+}
+
+// applyCount applies c and returns the count of its response
+func (node *Node) applyCount(c *Command, id *pb.RequestId) (*pb.CountMsg, error) {
+	if err := setRequestID(c, id); err != nil {
+		return nil, err
+	}
+	resp, err := node.apply(c)
+	if err != nil {
+		return nil, err
 	}
-	resp := f.Response().(*fsmResponse)
 	if resp.err != nil {
 		return nil, resp.err
 	}
-	return &pb.OkMsg{Ok: true}, nil
+	return &pb.CountMsg{Count: resp.count}, nil
+}
+
+// applyCommand replicates c through raft and returns the error of applying it
+// to the FSM. Writes rejected because this node is not the leader are returned
+// as FailedPrecondition so clients know the command was never applied.
+func (node *Node) applyCommand(c *Command) error {
+	resp, err := node.apply(c)
+	if err != nil {
+		return err
+	}
+	return resp.err
+}
+
+// apply replicates c through raft and returns the response of the FSM
+func (node *Node) apply(c *Command) (*fsmResponse, error) {
+	if err := node.checkFeature(c.Op); err != nil {
+		return nil, err
+	}
+	buf, err := encodeCommand(c, node.cachedFeatureVersion())
+	if err != nil {
+		return nil, err
+	}
+	f := node.raft.Apply(buf, node.Config.applyTimeout())
+	if err := f.Error(); err != nil {
+		return nil, node.raftError(err)
+	}
+	return f.Response().(*fsmResponse), nil
+}
+
+// raftError converts an error of a raft future to a status. Requests that
+// only the leader can serve are FailedPrecondition with a hint of the leader,
+// and other failures Unavailable.
+func (node *Node) raftError(err error) error {
+	switch err {
+	case raft.ErrNotLeader, raft.ErrLeadershipTransferInProgress:
+		if node.isNonvoter() {
+			return status.Errorf(codes.FailedPrecondition, "node is a read-only learner; leader is %v", node.leaderHint())
+		}
+		return status.Errorf(codes.FailedPrecondition, "%v; leader is %v", err, node.leaderHint())
+	case raft.ErrNothingNewToSnapshot:
+		return status.Error(codes.FailedPrecondition, err.Error())
+	default:
+		return status.Error(codes.Unavailable, err.Error())
+	}
+}
+
+// setRequestID attaches the client session of a write to c, if any
+func setRequestID(c *Command, id *pb.RequestId) error {
+	if id == nil {
+		return nil
+	}
+	if id.ClientId == "" || strings.Contains(id.ClientId, "\x00") {
+		return status.Errorf(codes.InvalidArgument, "invalid client id: %q", id.ClientId)
+	}
+	if id.Sequence == 0 || id.FirstIncomplete > id.Sequence {
+		return status.Errorf(codes.InvalidArgument, "invalid sequence %d with first incomplete %d", id.Sequence, id.FirstIncomplete)
+	}
+	c.ClientID = id.ClientId
+	c.Sequence = id.Sequence
+	c.FirstIncomplete = id.FirstIncomplete
+	return nil
+}
+
+// checkKey rejects keys of the default table reserved for simpledb itself
+// and for the other tables
+func checkKey(key string) error {
+	if isInternalKey(key) || isTableKey(key) {
+		return status.Errorf(codes.InvalidArgument, "keys starting with %q or %q are reserved", internalPrefix, tableDataPrefix)
+	}
+	return nil
+}
+
+// attributeType returns the attribute type of a value, or false if its data
+// type is invalid
+func attributeType(value *simpledb.Value) (pb.Attribute_Type, bool) {
+	switch value.DataType {
+	case simpledb.Bool:
+		return pb.Attribute_BOOL, true
+	case simpledb.Int:
+		return pb.Attribute_INT, true
+	case simpledb.Uint:
+		return pb.Attribute_UINT, true
+	case simpledb.Float:
+		return pb.Attribute_FLOAT, true
+	case simpledb.String:
+		return pb.Attribute_STRING, true
+	case simpledb.Bytes:
+		return pb.Attribute_BYTES, true
+	case documentDataType:
+		return documentType(value)
+	}
+	return 0, false
 }
 
 func valuesToAttributes(fields map[string]*simpledb.Value) (result []*pb.Attribute, err error) {
 	for name, value := range fields {
+		t, ok := attributeType(value)
+		if !ok {
+			return nil, fmt.Errorf("field contains invalid DataType: %v", value.DataType)
+		}
 		attribute := &pb.Attribute{
 			Name:  name,
+			Type:  t,
 			Value: value.Data,
 		}
-		switch value.DataType {
-		case simpledb.Bool:
-			attribute.Type = pb.Attribute_BOOL
-		case simpledb.Int:
-			attribute.Type = pb.Attribute_INT
-		case simpledb.Uint:
-			attribute.Type = pb.Attribute_UINT
-		case simpledb.Float:
-			attribute.Type = pb.Attribute_FLOAT
-		case simpledb.String:
-			attribute.Type = pb.Attribute_STRING
-		case simpledb.Bytes:
-			attribute.Type = pb.Attribute_STRING
-		default:
-			return nil, fmt.Errorf("field contains invalid DataType: %v", value.DataType)
+		if isDocumentType(t) {
+			attribute.Value = documentJSON(value)
 		}
+		setTyped(attribute)
 		result = append(result, attribute)
 	}
 	return result, nil
@@ -159,10 +417,14 @@ func valuesToAttributes(fields map[string]*simpledb.Value) (result []*pb.Attribu
 func attributesToValues(attributes []*pb.Attribute) (map[string]*simpledb.Value, error) {
 	values := make(map[string]*simpledb.Value)
 	for _, attribute := range attributes {
+		t, data, err := attributeValue(attribute)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
 		value := &simpledb.Value{
-			Data: attribute.Value,
+			Data: data,
 		}
-		switch attribute.Type {
+		switch t {
 		case pb.Attribute_BOOL:
 			value.DataType = simpledb.Bool
 		case pb.Attribute_INT:
@@ -176,9 +438,96 @@ func attributesToValues(attributes []*pb.Attribute) (map[string]*simpledb.Value,
 		case pb.Attribute_BYTES:
 			value.DataType = simpledb.Bytes
 		default:
-			return nil, fmt.Errorf("attribute contains invalid type: %v", attribute.Type)
+			value = documentValue(t, data)
 		}
 		values[attribute.Name] = value
 	}
 	return values, nil
 }
+
+// attributeValue returns the type and canonical encoding of an attribute sent
+// by a client, taken from its typed value if it has one. A typed value sent
+// with a value must agree with its type and value.
+func attributeValue(attribute *pb.Attribute) (pb.Attribute_Type, []byte, error) {
+	if t, data, ok := typedValue(attribute); ok {
+		if len(attribute.Value) > 0 && (attribute.Type != t || !bytes.Equal(attribute.Value, data)) {
+			return 0, nil, fmt.Errorf("attribute %v: typed value conflicts with its %v value", attribute.Name, attribute.Type)
+		}
+		return t, data, nil
+	}
+	if isDocumentType(attribute.Type) {
+		data, err := canonicalJSON(attribute.Type, attribute.Value)
+		if err != nil {
+			return 0, nil, fmt.Errorf("attribute %v: %v", attribute.Name, err)
+		}
+		return attribute.Type, data, nil
+	}
+	if err := checkEncoding(attribute.Type, attribute.Value); err != nil {
+		return 0, nil, fmt.Errorf("attribute %v: %v", attribute.Name, err)
+	}
+	return attribute.Type, attribute.Value, nil
+}
+
+// typedValue returns the type and canonical encoding of the typed value of an
+// attribute, or false if it has none
+func typedValue(attribute *pb.Attribute) (pb.Attribute_Type, []byte, bool) {
+	switch v := attribute.Typed.(type) {
+	case *pb.Attribute_BoolValue:
+		if v.BoolValue {
+			return pb.Attribute_BOOL, []byte{1}, true
+		}
+		return pb.Attribute_BOOL, []byte{0}, true
+	case *pb.Attribute_IntValue:
+		return pb.Attribute_INT, uint64ToBytes(uint64(v.IntValue)), true
+	case *pb.Attribute_UintValue:
+		return pb.Attribute_UINT, uint64ToBytes(v.UintValue), true
+	case *pb.Attribute_FloatValue:
+		return pb.Attribute_FLOAT, uint64ToBytes(math.Float64bits(v.FloatValue)), true
+	}
+	return 0, nil, false
+}
+
+// checkEncoding returns an error if data is not the canonical encoding of a
+// value of type t
+func checkEncoding(t pb.Attribute_Type, data []byte) error {
+	switch t {
+	case pb.Attribute_BOOL:
+		if len(data) != 1 || data[0] > 1 {
+			return fmt.Errorf("bool must be 1 byte, 0 or 1")
+		}
+	case pb.Attribute_INT, pb.Attribute_UINT, pb.Attribute_FLOAT:
+		if len(data) != 8 {
+			return fmt.Errorf("%v must be 8 bytes, got %d", t, len(data))
+		}
+	case pb.Attribute_STRING:
+		if !utf8.Valid(data) {
+			return fmt.Errorf("string must be valid UTF-8")
+		}
+	case pb.Attribute_BYTES:
+	case pb.Attribute_MAP, pb.Attribute_LIST, pb.Attribute_JSON:
+		_, err := canonicalJSON(t, data)
+		return err
+	default:
+		return fmt.Errorf("invalid type: %v", t)
+	}
+	return nil
+}
+
+// setTyped sets the typed value of a bool or number attribute. Values written
+// before encodings were checked are left to the raw value.
+func setTyped(attribute *pb.Attribute) {
+	data := attribute.Value
+	if isDocumentType(attribute.Type) || checkEncoding(attribute.Type, data) != nil {
+		return
+	}
+	switch attribute.Type {
+	case pb.Attribute_BOOL:
+		attribute.Typed = &pb.Attribute_BoolValue{BoolValue: data[0] == 1}
+	case pb.Attribute_INT:
+		attribute.Typed = &pb.Attribute_IntValue{IntValue: int64(bytesToUint64(data))}
+	case pb.Attribute_UINT:
+		attribute.Typed = &pb.Attribute_UintValue{UintValue: bytesToUint64(data)}
+	case pb.Attribute_FLOAT:
+		attribute.Typed = &pb.Attribute_FloatValue{FloatValue: math.Float64frombits(bytesToUint64(data))}
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	pb "github.com/triplewy/simpledb/grpc"
+)
+
+func TestCountRPC(t *testing.T) {
+	c, err := newTestCluster(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Shutdown()
+	if _, err := c.WaitForLeader(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WaitForFeatures(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	node := c.Node(0)
+	ctx := context.Background()
+	if _, err := node.CreateTableRPC(ctx, &pb.TableMsg{Name: "other"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"", "other"} {
+		for _, key := range []string{"a0", "a1", "b0"} {
+			if _, err := node.InsertRPC(ctx, &pb.Entry{Key: key, Attributes: testAttributes(key), Table: table}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	tests := []struct {
+		msg   *pb.KeyRangeMsg
+		count uint64
+	}{
+		{&pb.KeyRangeMsg{}, 3},
+		{&pb.KeyRangeMsg{Table: "other"}, 3},
+		{&pb.KeyRangeMsg{Prefix: "a"}, 2},
+		{&pb.KeyRangeMsg{StartKey: "a1", EndKey: "b1"}, 2},
+	}
+	for _, test := range tests {
+		msg, err := node.CountRPC(ctx, test.msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Count != test.count {
+			t.Errorf("%v: got %d, want %d", test.msg, msg.Count, test.count)
+		}
+	}
+	if _, err := node.CountRPC(ctx, &pb.KeyRangeMsg{Prefix: "a", StartKey: "a"}); err == nil {
+		t.Error("expected prefix and start key to be rejected")
+	}
+}
+
+func TestAttributeValue(t *testing.T) {
+	one := uint64ToBytes(1)
+	tests := []struct {
+		name      string
+		attribute *pb.Attribute
+		t         pb.Attribute_Type
+		data      []byte
+	}{
+		{"typed only", &pb.Attribute{Typed: &pb.Attribute_IntValue{IntValue: 1}}, pb.Attribute_INT, one},
+		{"typed and value", &pb.Attribute{Type: pb.Attribute_UINT, Value: one, Typed: &pb.Attribute_UintValue{UintValue: 1}}, pb.Attribute_UINT, one},
+		{"typed bool and value", &pb.Attribute{Type: pb.Attribute_BOOL, Value: []byte{1}, Typed: &pb.Attribute_BoolValue{BoolValue: true}}, pb.Attribute_BOOL, []byte{1}},
+		{"value only", &pb.Attribute{Type: pb.Attribute_FLOAT, Value: uint64ToBytes(math.Float64bits(1.5))}, pb.Attribute_FLOAT, uint64ToBytes(math.Float64bits(1.5))},
+		{"document", &pb.Attribute{Type: pb.Attribute_MAP, Value: []byte(`{ "a": 1.0 }`)}, pb.Attribute_MAP, []byte(`{"a":1}`)},
+		// Rejected
+		{"typed and other value", &pb.Attribute{Type: pb.Attribute_INT, Value: uint64ToBytes(2), Typed: &pb.Attribute_IntValue{IntValue: 1}}, 0, nil},
+		{"typed and other type", &pb.Attribute{Type: pb.Attribute_UINT, Value: one, Typed: &pb.Attribute_IntValue{IntValue: 1}}, 0, nil},
+		{"typed and string", &pb.Attribute{Type: pb.Attribute_STRING, Value: []byte("1"), Typed: &pb.Attribute_FloatValue{FloatValue: 1}}, 0, nil},
+		{"typed bool and other value", &pb.Attribute{Type: pb.Attribute_BOOL, Value: []byte{0}, Typed: &pb.Attribute_BoolValue{BoolValue: true}}, 0, nil},
+		{"short int", &pb.Attribute{Type: pb.Attribute_INT, Value: []byte{1}}, 0, nil},
+		{"invalid document", &pb.Attribute{Type: pb.Attribute_LIST, Value: []byte(`{}`)}, 0, nil},
+	}
+	for _, test := range tests {
+		typ, data, err := attributeValue(test.attribute)
+		if test.data == nil {
+			if err == nil {
+				t.Errorf("%v: accepted as %v %x", test.name, typ, data)
+			}
+			continue
+		}
+		if err != nil || typ != test.t || !bytes.Equal(data, test.data) {
+			t.Errorf("%v: got %v %q, %v", test.name, typ, data, err)
+		}
+	}
+}
+
+func TestCheckEncoding(t *testing.T) {
+	tests := []struct {
+		t    pb.Attribute_Type
+		data []byte
+		ok   bool
+	}{
+		{pb.Attribute_BOOL, []byte{0}, true},
+		{pb.Attribute_BOOL, []byte{1}, true},
+		{pb.Attribute_BOOL, []byte{2}, false},
+		{pb.Attribute_BOOL, nil, false},
+		{pb.Attribute_INT, make([]byte, 8), true},
+		{pb.Attribute_INT, make([]byte, 7), false},
+		{pb.Attribute_INT, make([]byte, 9), false},
+		{pb.Attribute_UINT, make([]byte, 8), true},
+		{pb.Attribute_UINT, nil, false},
+		{pb.Attribute_UINT, make([]byte, 4), false},
+		{pb.Attribute_FLOAT, make([]byte, 8), true},
+		{pb.Attribute_FLOAT, make([]byte, 4), false},
+		{pb.Attribute_FLOAT, make([]byte, 16), false},
+		{pb.Attribute_STRING, []byte("é"), true},
+		{pb.Attribute_STRING, []byte{0xff}, false},
+		{pb.Attribute_BYTES, []byte{0xff}, true},
+		{pb.Attribute_JSON, []byte(`[1]`), true},
+		{pb.Attribute_JSON, []byte(`[1`), false},
+		{pb.Attribute_Type(100), nil, false},
+	}
+	for _, test := range tests {
+		if err := checkEncoding(test.t, test.data); (err == nil) != test.ok {
+			t.Errorf("%v %x: %v", test.t, test.data, err)
+		}
+	}
+}
+
+func TestSetTyped(t *testing.T) {
+	tests := []struct {
+		attribute *pb.Attribute
+		typed     interface{}
+	}{
+		{&pb.Attribute{Type: pb.Attribute_BOOL, Value: []byte{1}}, &pb.Attribute_BoolValue{BoolValue: true}},
+		{&pb.Attribute{Type: pb.Attribute_INT, Value: uint64ToBytes(uint64(math.MaxUint64))}, &pb.Attribute_IntValue{IntValue: -1}},
+		{&pb.Attribute{Type: pb.Attribute_UINT, Value: uint64ToBytes(math.MaxUint64)}, &pb.Attribute_UintValue{UintValue: math.MaxUint64}},
+		{&pb.Attribute{Type: pb.Attribute_FLOAT, Value: uint64ToBytes(math.Float64bits(-0.5))}, &pb.Attribute_FloatValue{FloatValue: -0.5}},
+		// Values written before encodings were checked keep only their value
+		{&pb.Attribute{Type: pb.Attribute_INT, Value: []byte{1}}, nil},
+		{&pb.Attribute{Type: pb.Attribute_BOOL, Value: []byte{2}}, nil},
+		{&pb.Attribute{Type: pb.Attribute_STRING, Value: []byte("s")}, nil},
+	}
+	for _, test := range tests {
+		setTyped(test.attribute)
+		if test.typed == nil {
+			if test.attribute.Typed != nil {
+				t.Errorf("%v %x: typed %v", test.attribute.Type, test.attribute.Value, test.attribute.Typed)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(test.attribute.Typed, test.typed) {
+			t.Errorf("%v %x: typed %v, expected %v", test.attribute.Type, test.attribute.Value, test.attribute.Typed, test.typed)
+		}
+		// A typed attribute read back can be written again
+		if _, _, err := attributeValue(test.attribute); err != nil {
+			t.Errorf("%v %x: %v", test.attribute.Type, test.attribute.Value, err)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	simpledb "github.com/triplewy/simpledb-embedded"
+	pb "github.com/triplewy/simpledb/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Schemas constrain the attributes of the entries of a table whose keys start
+// with a prefix. The schema with the longest matching prefix applies to a key,
+// and keys matching none are unconstrained. Inserts and updates are checked
+// when they are applied: attributes must have the type of their field,
+// missing fields with a default get it, and required fields must be present.
+// A strict schema also rejects attributes without a field.
+//
+// Schemas only apply to writes after they are set. To keep existing entries
+// valid, a schema can only evolve by adding optional fields or fields with a
+// default, and by making required fields optional.
+const (
+	// schemaPrefix keys the schemas of each table by key prefix
+	schemaPrefix = internalPrefix + "schema/"
+
+	schemaAttribute = "schema"
+)
+
+// schema is the replicated form of a pb.SchemaMsg
+type schema struct {
+	Fields []*schemaField
+	Strict bool
+}
+
+type schemaField struct {
+	Name       string
+	Type       pb.Attribute_Type
+	Required   bool
+	HasDefault bool
+	Default    []byte
+}
+
+func schemaKey(table tableID, prefix string) string {
+	return schemaPrefix + table.bytes() + prefix
+}
+
+func (s *schema) field(name string) *schemaField {
+	for _, field := range s.Fields {
+		if field.Name == name {
+			return field
+		}
+	}
+	return nil
+}
+
+// readSchemas returns the schemas of a table by prefix
+func readSchemas(txn *simpledb.Txn, table tableID) (map[string]*schema, error) {
+	prefix := schemaKey(table, "")
+	entries, err := txn.Scan(prefix, prefixEnd(prefix))
+	if err != nil {
+		return nil, err
+	}
+	schemas := make(map[string]*schema)
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Key, prefix) {
+			continue
+		}
+		value, ok := entry.Attributes[schemaAttribute]
+		if !ok {
+			return nil, fmt.Errorf("schema %q has no definition", entry.Key)
+		}
+		var s schema
+		if err := decodeMsgPack(value.Data, &s); err != nil {
+			return nil, fmt.Errorf("invalid schema %q: %v", entry.Key, err)
+		}
+		schemas[entry.Key[len(prefix):]] = &s
+	}
+	return schemas, nil
+}
+
+// schemaFor returns the schema that applies to a key of a table, or nil
+func schemaFor(txn *simpledb.Txn, table tableID, key string) (*schema, error) {
+	schemas, err := readSchemas(txn, table)
+	if err != nil {
+		return nil, err
+	}
+	var match *schema
+	longest := -1
+	for prefix, s := range schemas {
+		if strings.HasPrefix(key, prefix) && len(prefix) > longest {
+			match, longest = s, len(prefix)
+		}
+	}
+	return match, nil
+}
+
+// enforceSchema checks the attributes written by c and the attributes the
+// entry will have against the schema that applies to it, and returns the
+// latter with defaults filled in. Attributes written before the schema was
+// set are not checked.
+func enforceSchema(txn *simpledb.Txn, c *Command, written, attributes map[string]*simpledb.Value) (map[string]*simpledb.Value, error) {
+	table := tableID(c.Table)
+	s, err := schemaFor(txn, table, table.userKey(c.Key))
+	if err != nil || s == nil {
+		return attributes, err
+	}
+	for name, value := range written {
+		field := s.field(name)
+		if field == nil {
+			if s.Strict {
+				return nil, fmt.Errorf("attribute %v is not in the schema", name)
+			}
+			continue
+		}
+		if t, ok := attributeType(value); !ok || t != field.Type {
+			return nil, fmt.Errorf("attribute %v must be of type %v", name, field.Type)
+		}
+	}
+	var result map[string]*simpledb.Value
+	for _, field := range s.Fields {
+		if _, ok := attributes[field.Name]; ok {
+			continue
+		}
+		if field.HasDefault {
+			if result == nil {
+				result = make(map[string]*simpledb.Value, len(attributes)+1)
+				for name, value := range attributes {
+					result[name] = value
+				}
+			}
+			values, err := attributesToValues([]*pb.Attribute{{Name: field.Name, Type: field.Type, Value: field.Default}})
+			if err != nil {
+				return nil, err
+			}
+			result[field.Name] = values[field.Name]
+		} else if field.Required {
+			return nil, fmt.Errorf("attribute %v is required", field.Name)
+		}
+	}
+	if result == nil {
+		return attributes, nil
+	}
+	return result, nil
+}
+
+// checkEvolution returns an error if replacing old with s could make entries
+// valid under old invalid under s
+func checkEvolution(old, s *schema) error {
+	if s.Strict && !old.Strict {
+		return fmt.Errorf("a schema cannot become strict")
+	}
+	for _, oldField := range old.Fields {
+		field := s.field(oldField.Name)
+		if field == nil {
+			return fmt.Errorf("field %v cannot be removed", oldField.Name)
+		}
+		if field.Type != oldField.Type {
+			return fmt.Errorf("field %v cannot change type from %v to %v", field.Name, oldField.Type, field.Type)
+		}
+		if field.Required && !oldField.Required && !field.HasDefault {
+			return fmt.Errorf("field %v cannot become required without a default", field.Name)
+		}
+	}
+	for _, field := range s.Fields {
+		if old.field(field.Name) == nil && field.Required && !field.HasDefault {
+			return fmt.Errorf("new field %v must be optional or have a default", field.Name)
+		}
+	}
+	return nil
+}
+
+// applySetSchema sets the schema of Table for keys starting with Key
+func applySetSchema(txn *simpledb.Txn, c *Command) (uint64, error) {
+	value, ok := c.Values[schemaAttribute]
+	if !ok {
+		return 0, fmt.Errorf("set schema without a schema")
+	}
+	var s schema
+	if err := decodeMsgPack(value.Data, &s); err != nil {
+		return 0, fmt.Errorf("invalid schema: %v", err)
+	}
+	schemas, err := readSchemas(txn, tableID(c.Table))
+	if err != nil {
+		return 0, err
+	}
+	if old, ok := schemas[c.Key]; ok {
+		if err := checkEvolution(old, &s); err != nil {
+			return 0, err
+		}
+	}
+	txn.Write(schemaKey(tableID(c.Table), c.Key), c.Values)
+	return 0, nil
+}
+
+// applyDropSchema removes the schema of Table for keys starting with Key
+func applyDropSchema(txn *simpledb.Txn, c *Command) (uint64, error) {
+	key := schemaKey(tableID(c.Table), c.Key)
+	exists, err := txn.Exists(key)
+	if err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, fmt.Errorf("no schema for prefix %q", c.Key)
+	}
+	txn.Delete(key)
+	return 0, nil
+}
+
+// toSchema validates msg and converts it to its replicated form
+func toSchema(msg *pb.SchemaMsg) (*schema, error) {
+	s := &schema{Strict: msg.Strict}
+	for _, field := range msg.Fields {
+		if field.Name == "" {
+			return nil, fmt.Errorf("field name must not be empty")
+		}
+		if s.field(field.Name) != nil {
+			return nil, fmt.Errorf("duplicate field %v", field.Name)
+		}
+		if _, ok := pb.Attribute_Type_name[int32(field.Type)]; !ok {
+			return nil, fmt.Errorf("field %v has invalid type %v", field.Name, field.Type)
+		}
+		f := &schemaField{Name: field.Name, Type: field.Type, Required: field.Required}
+		if field.Default != nil {
+			t, data, err := attributeValue(field.Default)
+			if err != nil {
+				return nil, fmt.Errorf("default of field %v: %v", field.Name, err)
+			}
+			if t != field.Type {
+				return nil, fmt.Errorf("default of field %v must be of type %v", field.Name, field.Type)
+			}
+			f.HasDefault, f.Default = true, data
+		}
+		s.Fields = append(s.Fields, f)
+	}
+	return s, nil
+}
+
+func (s *schema) toMsg(table, prefix string) *pb.SchemaMsg {
+	msg := &pb.SchemaMsg{Table: table, Prefix: prefix, Strict: s.Strict}
+	for _, field := range s.Fields {
+		f := &pb.SchemaField{Name: field.Name, Type: field.Type, Required: field.Required}
+		if field.HasDefault {
+			f.Default = &pb.Attribute{Name: field.Name, Type: field.Type, Value: field.Default}
+			setTyped(f.Default)
+		}
+		msg.Fields = append(msg.Fields, f)
+	}
+	return msg
+}
+
+// SetSchemaRPC sets the schema of the keys of a table starting with a prefix,
+// replacing the previous one if the change is allowed
+func (node *Node) SetSchemaRPC(ctx context.Context, msg *pb.SchemaMsg) (*pb.OkMsg, error) {
+	s, err := toSchema(msg)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid schema: %v", err)
+	}
+	table, err := node.resolveTable(msg.Table)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := encodeMsgPack(s)
+	if err != nil {
+		return nil, err
+	}
+	err = node.applyCommand(&Command{
+		Op:    SetSchema,
+		Key:   msg.Prefix,
+		Table: uint64(table),
+		Values: map[string]*simpledb.Value{
+			schemaAttribute: {DataType: simpledb.Bytes, Data: buf.Bytes()},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &pb.OkMsg{Ok: true}, nil
+}
+
+// DropSchemaRPC removes the schema of the keys of a table starting with a
+// prefix
+func (node *Node) DropSchemaRPC(ctx context.Context, msg *pb.SchemaMsg) (*pb.OkMsg, error) {
+	table, err := node.resolveTable(msg.Table)
+	if err != nil {
+		return nil, err
+	}
+	err = node.applyCommand(&Command{Op: DropSchema, Key: msg.Prefix, Table: uint64(table)})
+	if err != nil {
+		return nil, err
+	}
+	return &pb.OkMsg{Ok: true}, nil
+}
+
+// ListSchemasRPC returns the schemas of a table known to this node
+func (node *Node) ListSchemasRPC(ctx context.Context, msg *pb.TableMsg) (*pb.SchemasMsg, error) {
+	table, err := node.resolveTable(msg.Name)
+	if err != nil {
+		return nil, err
+	}
+	schemas, err := readSchemas(node.store.db.StartTxn(), table)
+	if err != nil {
+		return nil, err
+	}
+	result := &pb.SchemasMsg{Schemas: []*pb.SchemaMsg{}}
+	for prefix, s := range schemas {
+		result.Schemas = append(result.Schemas, s.toMsg(msg.Name, prefix))
+	}
+	sort.Slice(result.Schemas, func(i, j int) bool { return result.Schemas[i].Prefix < result.Schemas[j].Prefix })
+	return result, nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"testing"
+
+	simpledb "github.com/triplewy/simpledb-embedded"
+	pb "github.com/triplewy/simpledb/grpc"
+)
+
+func setSchema(s *store, prefix string, sc *schema) error {
+	buf, err := encodeMsgPack(sc)
+	if err != nil {
+		return err
+	}
+	return s.execute(&Command{
+		Op:     SetSchema,
+		Key:    prefix,
+		Values: map[string]*simpledb.Value{schemaAttribute: {DataType: simpledb.Bytes, Data: buf.Bytes()}},
+	}, 0).err
+}
+
+func TestCheckEvolution(t *testing.T) {
+	name := &schemaField{Name: "name", Type: pb.Attribute_STRING, Required: true}
+	age := &schemaField{Name: "age", Type: pb.Attribute_INT}
+	old := &schema{Fields: []*schemaField{name, age}}
+	tests := []struct {
+		name string
+		s    *schema
+		ok   bool
+	}{
+		{"unchanged", &schema{Fields: []*schemaField{name, age}}, true},
+		{"optional field added", &schema{Fields: []*schemaField{name, age, {Name: "email", Type: pb.Attribute_STRING}}}, true},
+		{"required field with default added", &schema{Fields: []*schemaField{name, age, {Name: "admin", Type: pb.Attribute_BOOL, Required: true, HasDefault: true, Default: []byte{0}}}}, true},
+		{"required field made optional", &schema{Fields: []*schemaField{{Name: "name", Type: pb.Attribute_STRING}, age}}, true},
+		{"optional field made required with default", &schema{Fields: []*schemaField{name, {Name: "age", Type: pb.Attribute_INT, Required: true, HasDefault: true, Default: uint64ToBytes(0)}}}, true},
+		{"required field added", &schema{Fields: []*schemaField{name, age, {Name: "email", Type: pb.Attribute_STRING, Required: true}}}, false},
+		{"optional field made required", &schema{Fields: []*schemaField{name, {Name: "age", Type: pb.Attribute_INT, Required: true}}}, false},
+		{"field removed", &schema{Fields: []*schemaField{name}}, false},
+		{"type changed", &schema{Fields: []*schemaField{name, {Name: "age", Type: pb.Attribute_UINT}}}, false},
+		{"made strict", &schema{Fields: []*schemaField{name, age}, Strict: true}, false},
+	}
+	for _, test := range tests {
+		if err := checkEvolution(old, test.s); (err == nil) != test.ok {
+			t.Errorf("%v: %v", test.name, err)
+		}
+	}
+}
+
+func TestSetSchemaEvolution(t *testing.T) {
+	s := newTestStore(t)
+	age := &schemaField{Name: "age", Type: pb.Attribute_INT}
+	if err := setSchema(s, "user/", &schema{Fields: []*schemaField{age}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := setSchema(s, "user/", &schema{Fields: []*schemaField{{Name: "age", Type: pb.Attribute_INT, Required: true}}}); err == nil {
+		t.Fatal("made a field required that existing entries may lack")
+	}
+	// Another prefix is a different schema
+	if err := setSchema(s, "admin/", &schema{Fields: []*schemaField{{Name: "age", Type: pb.Attribute_STRING, Required: true}}}); err != nil {
+		t.Fatal(err)
+	}
+	schemas, err := readSchemas(s.db.StartTxn(), defaultTable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schemas) != 2 || schemas["user/"].Fields[0].Required {
+		t.Fatalf("schemas after a rejected change: %+v", schemas)
+	}
+}
+
+func TestEnforceSchema(t *testing.T) {
+	s := newTestStore(t)
+	fields := func() []*schemaField {
+		return []*schemaField{
+			{Name: "name", Type: pb.Attribute_STRING, Required: true},
+			{Name: "age", Type: pb.Attribute_INT},
+			{Name: "admin", Type: pb.Attribute_BOOL, Required: true, HasDefault: true, Default: []byte{0}},
+		}
+	}
+	if err := setSchema(s, "user/", &schema{Fields: fields()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := setSchema(s, "user/strict/", &schema{Fields: fields(), Strict: true}); err != nil {
+		t.Fatal(err)
+	}
+	name := &simpledb.Value{DataType: simpledb.String, Data: []byte("a")}
+	for _, key := range []string{"user/1", "user/strict/1"} {
+		if resp := s.execute(&Command{Op: Insert, Key: key, Values: map[string]*simpledb.Value{"name": name}}, 0); resp.err != nil {
+			t.Fatal(resp.err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		op     uint8
+		key    string
+		values map[string]*simpledb.Value
+		ok     bool
+	}{
+		{"insert outside the prefixes", Insert, "other", map[string]*simpledb.Value{"age": stringValue("x")}, true},
+		{"insert with extra attribute", Insert, "user/2", map[string]*simpledb.Value{"name": name, "extra": intValue(1)}, true},
+		{"strict insert with extra attribute", Insert, "user/strict/2", map[string]*simpledb.Value{"name": name, "extra": intValue(1)}, false},
+		{"insert without required attribute", Insert, "user/3", map[string]*simpledb.Value{"age": intValue(1)}, false},
+		{"insert of wrong type", Insert, "user/4", map[string]*simpledb.Value{"name": name, "age": stringValue("1")}, false},
+		{"update", Update, "user/1", map[string]*simpledb.Value{"age": intValue(2)}, true},
+		{"update of wrong type", Update, "user/1", map[string]*simpledb.Value{"admin": intValue(1)}, false},
+		{"update with extra attribute", Update, "user/1", map[string]*simpledb.Value{"extra": intValue(1)}, true},
+		{"strict update with extra attribute", Update, "user/strict/1", map[string]*simpledb.Value{"extra": intValue(1)}, false},
+		{"strict update", Update, "user/strict/1", map[string]*simpledb.Value{"age": intValue(2)}, true},
+	}
+	for _, test := range tests {
+		resp := s.execute(&Command{Op: test.op, Key: test.key, Values: test.values}, 0)
+		if (resp.err == nil) != test.ok {
+			t.Errorf("%v: %v", test.name, resp.err)
+		}
+	}
+
+	// Defaults are filled in, and rejected writes changed nothing
+	txn := s.db.StartTxn()
+	entry, err := txn.Read("user/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if admin, ok := entry.Attributes["admin"]; !ok || admin.DataType != simpledb.Bool || admin.Data[0] != 0 {
+		t.Fatalf("default of admin: %v", admin)
+	}
+	if age := entry.Attributes["age"]; age == nil || bytesToUint64(age.Data) != 2 {
+		t.Fatalf("age after updates: %v", age)
+	}
+	for _, key := range []string{"user/strict/2", "user/3", "user/4"} {
+		if exists, err := txn.Exists(key); err != nil || exists {
+			t.Errorf("rejected insert of %v was written: %v", key, err)
+		}
+	}
+}
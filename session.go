@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/raft"
+	simpledb "github.com/triplewy/simpledb-embedded"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Client sessions make writes idempotent as described in the Raft thesis: the
+// result of every command carrying a client ID and sequence is recorded in the
+// same transaction as the command, and a retry returns the recorded result
+// instead of applying the command again. Sessions live in the db, so they are
+// replicated and restored like any other state.
+//
+// The leader periodically proposes ExpireSessions with its clock. A session
+// that had the same results at two of them sessionTTL apart is discarded
+// with its results, so every node expires the same sessions. A write retried
+// after its session expired is applied again.
+const (
+	// sessionPrefix keys the lowest incomplete sequence of each client
+	sessionPrefix = internalPrefix + "session/"
+	// resultPrefix keys the result of each command of each client
+	resultPrefix = internalPrefix + "result/"
+
+	firstIncompleteAttribute = "first_incomplete"
+	errorAttribute           = "error"
+	countAttribute           = "count"
+	// idleSinceAttribute and resultCountAttribute record when ExpireSessions
+	// last saw a session change and how many results it had then. Sessions
+	// rewritten by a command lose them.
+	idleSinceAttribute   = "idle_since"
+	resultCountAttribute = "result_count"
+	// nowAttribute and ttlAttribute of ExpireSessions are the leader's clock
+	// and sessionTTL, in nanoseconds
+	nowAttribute = "now"
+	ttlAttribute = "ttl"
+)
+
+const (
+	// sessionTTL is how long a client session is kept after its last write
+	sessionTTL = time.Hour
+	// sessionExpiryInterval is how often the leader proposes ExpireSessions
+	sessionExpiryInterval = time.Minute
+)
+
+type session struct {
+	clientID        string
+	firstIncomplete uint64
+}
+
+func sessionKey(clientID string) string {
+	return sessionPrefix + clientID
+}
+
+func resultKey(clientID string, sequence uint64) string {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, sequence)
+	return resultPrefix + clientID + "\x00" + string(buf)
+}
+
+// readSession returns the session of a client, which is empty if the client
+// has not written yet
+func readSession(txn *simpledb.Txn, clientID string) (*session, error) {
+	s := &session{clientID: clientID}
+	entry, err := txn.Read(sessionKey(clientID))
+	if err != nil {
+		if _, ok := err.(*simpledb.ErrKeyNotFound); ok {
+			return s, nil
+		}
+		return nil, err
+	}
+	if value, ok := entry.Attributes[firstIncompleteAttribute]; ok {
+		s.firstIncomplete = bytesToUint64(value.Data)
+	}
+	return s, nil
+}
+
+// result returns the recorded response to a command if it was applied
+// before, or nil. Commands below the lowest incomplete sequence were
+// acknowledged by the client, so their results are gone and they are rejected
+// without applying.
+func (s *session) result(txn *simpledb.Txn, sequence uint64) (*fsmResponse, error) {
+	if sequence < s.firstIncomplete {
+		return &fsmResponse{err: fmt.Errorf("request %d of client %v was already acknowledged", sequence, s.clientID)}, nil
+	}
+	entry, err := txn.Read(resultKey(s.clientID, sequence))
+	if err != nil {
+		if _, ok := err.(*simpledb.ErrKeyNotFound); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+	resp := &fsmResponse{}
+	if value, ok := entry.Attributes[errorAttribute]; ok && len(value.Data) > 0 {
+		resp.err = errors.New(string(value.Data))
+	}
+	if value, ok := entry.Attributes[countAttribute]; ok {
+		resp.count = bytesToUint64(value.Data)
+	}
+	return resp, nil
+}
+
+// record writes the response to command c and discards the results the
+// client has acknowledged since its last command
+func (s *session) record(txn *simpledb.Txn, c *Command, resp *fsmResponse) error {
+	message := ""
+	if resp.err != nil {
+		message = resp.err.Error()
+	}
+	txn.Write(resultKey(s.clientID, c.Sequence), map[string]*simpledb.Value{
+		errorAttribute: {DataType: simpledb.String, Data: []byte(message)},
+		countAttribute: {DataType: simpledb.Uint, Data: uint64ToBytes(resp.count)},
+	})
+	if c.FirstIncomplete <= s.firstIncomplete {
+		return nil
+	}
+	entries, err := txn.Scan(resultKey(s.clientID, s.firstIncomplete), resultKey(s.clientID, c.FirstIncomplete))
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		sequence := binary.BigEndian.Uint64([]byte(entry.Key[len(entry.Key)-8:]))
+		if sequence < c.FirstIncomplete {
+			txn.Delete(entry.Key)
+		}
+	}
+	s.firstIncomplete = c.FirstIncomplete
+	txn.Write(sessionKey(s.clientID), map[string]*simpledb.Value{
+		firstIncompleteAttribute: {DataType: simpledb.Uint, Data: uint64ToBytes(s.firstIncomplete)},
+	})
+	return nil
+}
+
+// applyExpireSessions marks the sessions that changed since the last
+// ExpireSessions as idle from now, and discards the sessions that stayed idle
+// for the ttl. It returns the number of sessions discarded.
+func applyExpireSessions(txn *simpledb.Txn, c *Command) (uint64, error) {
+	now, ttl := c.Values[nowAttribute], c.Values[ttlAttribute]
+	if now == nil || ttl == nil {
+		return 0, fmt.Errorf("expire sessions requires %v and %v", nowAttribute, ttlAttribute)
+	}
+	// Results of clients that never advanced their session have no session
+	// key, so clients are collected from both prefixes
+	results := make(map[string][]string)
+	entries, err := txn.Scan(resultPrefix, prefixEnd(resultPrefix))
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range entries {
+		clientID := entry.Key[len(resultPrefix) : len(entry.Key)-9]
+		results[clientID] = append(results[clientID], entry.Key)
+	}
+	sessions := make(map[string]map[string]*simpledb.Value)
+	entries, err = txn.Scan(sessionPrefix, prefixEnd(sessionPrefix))
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range entries {
+		sessions[entry.Key[len(sessionPrefix):]] = entry.Attributes
+	}
+	clients := []string{}
+	for clientID := range results {
+		clients = append(clients, clientID)
+	}
+	for clientID := range sessions {
+		if _, ok := results[clientID]; !ok {
+			clients = append(clients, clientID)
+		}
+	}
+	sort.Strings(clients)
+
+	var expired uint64
+	for _, clientID := range clients {
+		attributes := sessions[clientID]
+		count := uint64(len(results[clientID]))
+		idleSince, idle := attributes[idleSinceAttribute]
+		idleCount, counted := attributes[resultCountAttribute]
+		if idle && counted && bytesToUint64(idleCount.Data) == count {
+			if int64(bytesToUint64(now.Data))-int64(bytesToUint64(idleSince.Data)) >= int64(bytesToUint64(ttl.Data)) {
+				txn.Delete(sessionKey(clientID))
+				for _, key := range results[clientID] {
+					txn.Delete(key)
+				}
+				expired++
+			}
+			continue
+		}
+		firstIncomplete := &simpledb.Value{DataType: simpledb.Uint, Data: uint64ToBytes(0)}
+		if value, ok := attributes[firstIncompleteAttribute]; ok {
+			firstIncomplete = value
+		}
+		txn.Write(sessionKey(clientID), map[string]*simpledb.Value{
+			firstIncompleteAttribute: firstIncomplete,
+			idleSinceAttribute:       now,
+			resultCountAttribute:     {DataType: simpledb.Uint, Data: uint64ToBytes(count)},
+		})
+	}
+	return expired, nil
+}
+
+// watchSessions proposes ExpireSessions while this node is the leader, until
+// the node shuts down
+func (node *Node) watchSessions() {
+	ticker := time.NewTicker(sessionExpiryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-node.shutdownCh:
+			return
+		case <-ticker.C:
+		}
+		if node.raft.State() != raft.Leader {
+			continue
+		}
+		err := node.applyCommand(&Command{
+			Op: ExpireSessions,
+			Values: map[string]*simpledb.Value{
+				nowAttribute: {DataType: simpledb.Int, Data: uint64ToBytes(uint64(time.Now().UnixNano()))},
+				ttlAttribute: {DataType: simpledb.Int, Data: uint64ToBytes(uint64(sessionTTL))},
+			},
+		})
+		// Older clusters keep sessions until every server supports expiry
+		if err != nil && status.Code(err) != codes.Unimplemented {
+			log.Printf("failed to expire sessions: %v", err)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	simpledb "github.com/triplewy/simpledb-embedded"
+)
+
+func newTestStore(t *testing.T) *store {
+	dir, err := ioutil.TempDir("", "simpledb-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &store{dir: dir}
+	if err := s.initialize(); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		s.db.Close()
+		os.RemoveAll(dir)
+	})
+	return s
+}
+
+func expireSessions(t *testing.T, s *store, now int64) uint64 {
+	resp := s.execute(&Command{
+		Op: ExpireSessions,
+		Values: map[string]*simpledb.Value{
+			nowAttribute: {DataType: simpledb.Int, Data: uint64ToBytes(uint64(now))},
+			ttlAttribute: {DataType: simpledb.Int, Data: uint64ToBytes(10)},
+		},
+	}, 0)
+	if resp.err != nil {
+		t.Fatal(resp.err)
+	}
+	return resp.count
+}
+
+func TestExpireSessions(t *testing.T) {
+	s := newTestStore(t)
+	insert := func(clientID string, sequence uint64, key string) *fsmResponse {
+		return s.execute(&Command{
+			Op:              Insert,
+			Key:             key,
+			Values:          map[string]*simpledb.Value{"value": {DataType: simpledb.String, Data: []byte(key)}},
+			ClientID:        clientID,
+			Sequence:        sequence,
+			FirstIncomplete: sequence,
+		}, 0)
+	}
+	if resp := insert("idle", 1, "a"); resp.err != nil {
+		t.Fatal(resp.err)
+	}
+	if resp := insert("active", 1, "b"); resp.err != nil {
+		t.Fatal(resp.err)
+	}
+
+	if expired := expireSessions(t, s, 0); expired != 0 {
+		t.Fatalf("expired %d sessions when marking them", expired)
+	}
+	if resp := insert("active", 2, "c"); resp.err != nil {
+		t.Fatal(resp.err)
+	}
+	if expired := expireSessions(t, s, 5); expired != 0 {
+		t.Fatalf("expired %d sessions before the ttl", expired)
+	}
+	if expired := expireSessions(t, s, 10); expired != 1 {
+		t.Fatalf("expired %d sessions, expected only the idle one", expired)
+	}
+
+	txn := s.db.StartTxn()
+	for clientID, kept := range map[string]bool{"idle": false, "active": true} {
+		session, err := readSession(txn, clientID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := session.result(txn, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if kept != (session.firstIncomplete == 2 && resp != nil) {
+			t.Fatalf("session of %v: first incomplete %d, result %v", clientID, session.firstIncomplete, resp)
+		}
+	}
+	if _, err := txn.Read(resultKey("idle", 1)); err == nil {
+		t.Fatal("result of expired session was kept")
+	}
+}
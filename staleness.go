@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/raft"
+	simpledb "github.com/triplewy/simpledb-embedded"
+	pb "github.com/triplewy/simpledb/grpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// leaderKey holds the raft and rpc addresses announced by the latest leader,
+// so that followers can forward reads to it
+const leaderKey = internalPrefix + "meta/leader"
+
+const (
+	raftAddressAttribute = "raft_address"
+	rpcAddressAttribute  = "rpc_address"
+)
+
+// forwardedKey is set in the metadata of reads forwarded to the leader so
+// that they are never forwarded again
+const forwardedKey = "simpledb-forwarded"
+
+// forwarder caches connections to the leaders reads were forwarded to
+type forwarder struct {
+	mu    sync.Mutex
+	conns map[string]*grpc.ClientConn
+}
+
+func (f *forwarder) conn(addr string, opts []grpc.DialOption) (*grpc.ClientConn, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if conn, ok := f.conns[addr]; ok {
+		return conn, nil
+	}
+	conn, err := grpc.Dial(addr, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if f.conns == nil {
+		f.conns = make(map[string]*grpc.ClientConn)
+	}
+	f.conns[addr] = conn
+	return conn, nil
+}
+
+func (f *forwarder) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for addr, conn := range f.conns {
+		conn.Close()
+		delete(f.conns, addr)
+	}
+}
+
+// watchLeadership announces the addresses of this node and resumes index
+// backfills and table purges whenever it becomes the leader, until the node shuts down
+func (node *Node) watchLeadership() {
+	for {
+		select {
+		case <-node.shutdownCh:
+			return
+		case isLeader := <-node.raft.LeaderCh():
+			if isLeader {
+				if err := node.announce(); err != nil {
+					log.Printf("failed to announce leadership: %v", err)
+				}
+				node.resumeBackfills()
+				node.resumePurges()
+			}
+		}
+	}
+}
+
+func (node *Node) announce() error {
+	return node.applyCommand(&Command{
+		Op:  Announce,
+		Key: leaderKey,
+		Values: map[string]*simpledb.Value{
+			raftAddressAttribute: {DataType: simpledb.String, Data: []byte(node.raftAddr)},
+			rpcAddressAttribute:  {DataType: simpledb.String, Data: []byte(node.rpcAdvertise)},
+		},
+	})
+}
+
+// leaderRPCAddr returns the rpc address announced by the current leader. If
+// the leader is unknown, e.g. because this node is partitioned from it, the
+// address of the last announced leader is returned.
+func (node *Node) leaderRPCAddr() (string, error) {
+	leader := node.raft.Leader()
+	entry, err := node.store.db.StartTxn().Read(leaderKey)
+	if err != nil {
+		if _, ok := err.(*simpledb.ErrKeyNotFound); !ok {
+			return "", err
+		}
+		return "", status.Error(codes.Unavailable, "no leader announced yet")
+	}
+	raftAddr, ok := entry.Attributes[raftAddressAttribute]
+	rpcAddr, ok2 := entry.Attributes[rpcAddressAttribute]
+	if !ok || !ok2 {
+		return "", fmt.Errorf("invalid leader announcement: %v", entry.Attributes)
+	}
+	if leader != "" && raft.ServerAddress(raftAddr.Data) != leader {
+		return "", status.Errorf(codes.Unavailable, "rpc address of leader %v not known yet", leader)
+	}
+	return string(rpcAddr.Data), nil
+}
+
+// leaderHint returns the rpc address of the leader for clients redirected to
+// it, or "unknown"
+func (node *Node) leaderHint() string {
+	addr, err := node.leaderRPCAddr()
+	if err != nil || addr == "" {
+		return "unknown"
+	}
+	return addr
+}
+
+// withinStaleness returns true if this node may serve a read bounded by
+// staleness locally. The leader always may.
+func (node *Node) withinStaleness(staleness *pb.Staleness) bool {
+	if node.raft.State() == raft.Leader {
+		return true
+	}
+	if staleness.MaxLagMs > 0 {
+		last := node.raft.LastContact()
+		if last.IsZero() || time.Since(last) > time.Duration(staleness.MaxLagMs)*time.Millisecond {
+			return false
+		}
+	}
+	if staleness.MaxLagEntries > 0 {
+		// Lag is measured against the leader's commit index, which this node
+		// only learns when the leader polls it
+		_, at, ok := node.progress.getLeaderCommit()
+		if !ok || time.Since(at) > leaderCommitExpiry || node.replicationLag() > staleness.MaxLagEntries {
+			return false
+		}
+	}
+	return true
+}
+
+// linearizableRead waits until this node may serve a read that observes every
+// write completed before it started. Only the leader may: once per term it
+// commits a barrier, so that its commit index covers earlier terms, then for
+// every read it confirms it is still the leader and waits until it has
+// applied its commit index.
+func (node *Node) linearizableRead(ctx context.Context) error {
+	if node.raft.State() != raft.Leader {
+		return status.Errorf(codes.FailedPrecondition, "%v; leader is %v", raft.ErrNotLeader, node.leaderHint())
+	}
+	term := node.raft.CurrentTerm()
+	if atomic.LoadUint64(&node.barrierTerm) != term {
+		if err := node.raft.Barrier(node.Config.applyTimeout()).Error(); err != nil {
+			return node.leadershipError(err)
+		}
+		atomic.StoreUint64(&node.barrierTerm, term)
+	}
+	commitIndex := node.raft.CommitIndex()
+	if err := node.raft.VerifyLeader().Error(); err != nil {
+		return node.leadershipError(err)
+	}
+	for node.raft.AppliedIndex() < commitIndex {
+		select {
+		case <-ctx.Done():
+			return status.Error(codes.DeadlineExceeded, ctx.Err().Error())
+		case <-time.After(time.Millisecond):
+		}
+	}
+	return nil
+}
+
+// leadershipError converts an error confirming leadership to a status that
+// clients retry on
+func (node *Node) leadershipError(err error) error {
+	switch err {
+	case raft.ErrNotLeader, raft.ErrLeadershipLost, raft.ErrLeadershipTransferInProgress:
+		return status.Errorf(codes.FailedPrecondition, "%v; leader is %v", err, node.leaderHint())
+	default:
+		return status.Error(codes.Unavailable, err.Error())
+	}
+}
+
+// leaderClient returns a client for the leader to forward a read to. Reads
+// already forwarded once fail instead, e.g. when leadership moved meanwhile.
+func (node *Node) leaderClient(ctx context.Context) (context.Context, pb.SimpleDbClient, error) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get(forwardedKey)) > 0 {
+		return nil, nil, status.Errorf(codes.FailedPrecondition, "forwarded read reached a stale follower; leader is %v", node.leaderHint())
+	}
+	addr, err := node.leaderRPCAddr()
+	if err != nil {
+		return nil, nil, err
+	}
+	opts, err := node.dialOptions()
+	if err != nil {
+		return nil, nil, err
+	}
+	conn, err := node.forwarder.conn(addr, opts)
+	if err != nil {
+		return nil, nil, status.Error(codes.Unavailable, err.Error())
+	}
+	ctx = metadata.AppendToOutgoingContext(ctx, forwardedKey, string(node.localID()))
+	return ctx, pb.NewSimpleDbClient(conn), nil
+}
+
+// dialOptions returns options to dial other nodes, using the node's own
+// certificate to verify them if TLS is enabled
+func (node *Node) dialOptions() ([]grpc.DialOption, error) {
+	if node.Config.TLS.CertFile == "" {
+		return []grpc.DialOption{grpc.WithInsecure()}, nil
+	}
+	creds, err := credentials.NewClientTLSFromFile(node.Config.TLS.CertFile, "")
+	if err != nil {
+		return nil, fmt.Errorf("could not create credentials: %v", err)
+	}
+	return []grpc.DialOption{grpc.WithTransportCredentials(creds)}, nil
+}
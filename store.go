@@ -1,24 +1,47 @@
 package main
 
 import (
-	"errors"
 	"fmt"
-	"math"
 	"os"
 	"path/filepath"
+	"strings"
 
-	"github.com/hashicorp/raft"
 	simpledb "github.com/triplewy/simpledb-embedded"
 )
 
+// internalPrefix prefixes keys used by simpledb itself, such as raft log
+// entries. They are hidden from scans and cannot be accessed by clients.
+const internalPrefix = "\x00"
+
+// isInternalKey returns true if key is reserved for simpledb itself
+func isInternalKey(key string) bool {
+	return strings.HasPrefix(key, internalPrefix)
+}
+
+// raftPrefix prefixes the keys of raft's log and stable store, which are not
+// part of the FSM's state
+const raftPrefix = internalPrefix + "raft/"
+
+// stablePrefix prefixes the keys of raft's stable store, next to the log
+// keys. Keys written without it by earlier versions are still read.
+const stablePrefix = raftPrefix + "stable/"
+
+func stableKey(key []byte) string {
+	return stablePrefix + string(key)
+}
+
 type store struct {
-	dir string
-	db  *simpledb.DB
+	dir  string
+	db   *simpledb.DB
+	logs *logStore
+	// applied is the index of the last log entry applied to db, only
+	// accessed by the FSM
+	applied uint64
 }
 
 func (node *Node) newStore() error {
 	store := &store{
-		dir: node.Config.dataDir,
+		dir: node.Config.DataDir,
 		db:  nil,
 	}
 	err := store.initialize()
@@ -42,107 +65,17 @@ func (store *store) initialize() error {
 	if err != nil {
 		return err
 	}
-	store.db = db
-	return nil
-}
-
-// FirstIndex returns the first index written. 0 for no entries.
-func (store *store) FirstIndex() (uint64, error) {
-	logs, err := store.RangeLogs()
-	if err != nil || len(logs) == 0 {
-		return 0, err
+	logs, err := newLogStore(db)
+	if err != nil {
+		return err
 	}
-	return logs[0].Index, err
-}
-
-// LastIndex returns the last index written. 0 for no entries.
-func (store *store) LastIndex() (uint64, error) {
-	logs, err := store.RangeLogs()
-	if err != nil || len(logs) == 0 {
-		return 0, err
+	store.applied, err = readApplied(db.StartTxn())
+	if err != nil {
+		return err
 	}
-	return logs[len(logs)-1].Index, err
-}
-
-// GetLog gets a log entry at a given index.
-func (store *store) GetLog(index uint64, log *raft.Log) error {
-	return store.db.ViewTxn(func(txn *simpledb.Txn) error {
-		key := string(append([]byte("log"), uint64ToBytes(index)...))
-		entry, err := txn.Read(key)
-		if err != nil {
-			fmt.Println(err)
-			return err
-		}
-		if value, ok := entry.Attributes["log"]; ok {
-			return decodeMsgPack(value.Data, &log)
-		}
-		return errors.New("Log entry has no 'value' field")
-	})
-}
-
-// StoreLog stores a log entry.
-func (store *store) StoreLog(log *raft.Log) error {
-	return store.StoreLogs([]*raft.Log{log})
-}
-
-// StoreLogs stores multiple log entries.
-func (store *store) StoreLogs(logs []*raft.Log) error {
-	return store.db.UpdateTxn(func(txn *simpledb.Txn) error {
-		for _, log := range logs {
-			key := string(append([]byte("log"), uint64ToBytes(log.Index)...))
-			buf, err := encodeMsgPack(log)
-			if err != nil {
-				return err
-			}
-			value, err := simpledb.CreateValue(buf.Bytes())
-			if err != nil {
-				return err
-			}
-			txn.Write(key, map[string]*simpledb.Value{"log": value})
-		}
-		return nil
-	})
-}
-
-// DeleteRange deletes a range of log entries. The range is inclusive.
-func (store *store) DeleteRange(min, max uint64) error {
-	return store.db.UpdateTxn(func(txn *simpledb.Txn) error {
-		startKey := string(append([]byte("log"), uint64ToBytes(min)...))
-		endKey := string(append([]byte("log"), uint64ToBytes(max)...))
-		entries, err := txn.Scan(startKey, endKey)
-		if err != nil {
-			return err
-		}
-		for _, entry := range entries {
-			txn.Delete(entry.Key)
-		}
-		return nil
-	})
-}
-
-func (store *store) RangeLogs() (logs []*raft.Log, err error) {
-	err = store.db.ViewTxn(func(txn *simpledb.Txn) error {
-		startKey := string(append([]byte("log"), uint64ToBytes(0)...))
-		endKey := string(append([]byte("log"), uint64ToBytes(math.MaxUint64)...))
-		entries, err := txn.Scan(startKey, endKey)
-		if err != nil {
-			return err
-		}
-		for _, entry := range entries {
-			if value, ok := entry.Attributes["log"]; ok {
-				var log raft.Log
-				err := decodeMsgPack(value.Data, &log)
-				if err != nil {
-					return err
-				}
-				logs = append(logs, &log)
-			} else {
-				return fmt.Errorf("log entry has no attribute 'log': %v", entry.Attributes)
-			}
-		}
-		return nil
-	})
-	return logs, err
+	store.db = db
+	store.logs = logs
+	return nil
 }
 
 // Set is used to set a key/value set outside of the raft log
@@ -152,7 +85,9 @@ func (store *store) Set(key []byte, val []byte) error {
 			DataType: simpledb.Bytes,
 			Data:     val,
 		}}
-		txn.Write(string(key), values)
+		txn.Write(stableKey(key), values)
+		// Drop the key written by versions without the prefix
+		txn.Delete(string(key))
 		return nil
 	})
 }
@@ -161,7 +96,11 @@ func (store *store) Set(key []byte, val []byte) error {
 func (store *store) Get(key []byte) ([]byte, error) {
 	var result []byte
 	err := store.db.ViewTxn(func(txn *simpledb.Txn) error {
-		entry, err := txn.Read(string(key))
+		entry, err := txn.Read(stableKey(key))
+		if _, ok := err.(*simpledb.ErrKeyNotFound); ok {
+			// Fall back to the key written by versions without the prefix
+			entry, err = txn.Read(string(key))
+		}
 		if err != nil {
 			switch err.(type) {
 			case *simpledb.ErrKeyNotFound:
@@ -188,7 +127,9 @@ func (store *store) SetUint64(key []byte, val uint64) error {
 			DataType: simpledb.Uint,
 			Data:     uint64ToBytes(val),
 		}}
-		txn.Write(string(key), values)
+		txn.Write(stableKey(key), values)
+		// Drop the key written by versions without the prefix
+		txn.Delete(string(key))
 		return nil
 	})
 }
@@ -197,7 +138,11 @@ func (store *store) SetUint64(key []byte, val uint64) error {
 func (store *store) GetUint64(key []byte) (uint64, error) {
 	var result uint64
 	err := store.db.ViewTxn(func(txn *simpledb.Txn) error {
-		entry, err := txn.Read(string(key))
+		entry, err := txn.Read(stableKey(key))
+		if _, ok := err.(*simpledb.ErrKeyNotFound); ok {
+			// Fall back to the key written by versions without the prefix
+			entry, err = txn.Read(string(key))
+		}
 		if err != nil {
 			switch err.(type) {
 			case *simpledb.ErrKeyNotFound:
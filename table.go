@@ -0,0 +1,457 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/hashicorp/raft"
+	simpledb "github.com/triplewy/simpledb-embedded"
+	pb "github.com/triplewy/simpledb/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Tables are namespaces of keys. The entries of a table are stored under a
+// prefix made of tableDataPrefix and the table's ID, so scans of one table
+// never reach another. IDs are never reused, so dropping a table only
+// removes its metadata and its entries become unreachable at once. The
+// leader then purges them in the background in batches of PurgeTable
+// commands, which resume under a new leader like index backfills.
+//
+// The default table, named "", has ID 0 and holds the keys of clients that
+// do not use tables, stored without a prefix.
+const (
+	// tablePrefix keys the ID of each table by name
+	tablePrefix = internalPrefix + "table/"
+	// tableIDPrefix keys the name of each table by ID
+	tableIDPrefix = internalPrefix + "tableid/"
+	// droppedTablePrefix keys the IDs of dropped tables not purged yet
+	droppedTablePrefix = internalPrefix + "droppedtable/"
+	// nextTableKey holds the ID of the last table created
+	nextTableKey = internalPrefix + "meta/last_table"
+	// tableDataPrefix starts the keys of every table but the default one
+	tableDataPrefix = "\x01"
+
+	idAttribute   = "id"
+	nameAttribute = "name"
+)
+
+// tableID identifies a table in keys and commands
+type tableID uint64
+
+const defaultTable tableID = 0
+
+func (id tableID) bytes() string {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(id))
+	return string(buf)
+}
+
+// prefix returns the prefix of the keys of the table
+func (id tableID) prefix() string {
+	if id == defaultTable {
+		return ""
+	}
+	return tableDataPrefix + id.bytes()
+}
+
+// key returns the key a key of the table is stored at
+func (id tableID) key(key string) string {
+	return id.prefix() + key
+}
+
+// userKey returns the key of the table stored at key
+func (id tableID) userKey(key string) string {
+	return key[len(id.prefix()):]
+}
+
+// contains returns true if the stored key belongs to the table
+func (id tableID) contains(key string) bool {
+	if id == defaultTable {
+		return !isInternalKey(key) && !isTableKey(key)
+	}
+	return strings.HasPrefix(key, id.prefix())
+}
+
+// end returns a key greater than every key of the table
+func (id tableID) end() string {
+	if id == defaultTable {
+		return keyspaceEnd
+	}
+	return prefixEnd(id.prefix())
+}
+
+// scanWindows calls fn in key order with batches of at most limit entries of
+// the table from start on, together with a key that ends the batch, until fn
+// returns false
+func (id tableID) scanWindows(txn *simpledb.Txn, start string, limit int, fn func(end string, entries []*simpledb.Entry) bool) error {
+	return scanWindows(txn, id.prefix(), start, limit, id.contains, fn)
+}
+
+// scanWindows calls fn in key order with batches of at most limit of the
+// entries whose key starts with prefix, is at least start and is kept by
+// keep, together with a key that ends the batch, until fn returns false. The
+// embedded DB cannot limit a scan, so the prefix is never scanned whole but a
+// window of keys sharing the byte after it at a time.
+func scanWindows(txn *simpledb.Txn, prefix, start string, limit int, keep func(key string) bool, fn func(end string, entries []*simpledb.Entry) bool) error {
+	if prefix >= start && keep(prefix) {
+		entry, err := txn.Read(prefix)
+		if err == nil {
+			if !fn(prefix+"\x00", []*simpledb.Entry{entry}) {
+				return nil
+			}
+		} else if _, ok := err.(*simpledb.ErrKeyNotFound); !ok {
+			return err
+		}
+	}
+	for b := 0; b < 256; b++ {
+		window := prefix + string([]byte{byte(b)})
+		end := prefixEnd(window)
+		if end <= start || !keep(window) {
+			continue
+		}
+		from := window
+		if start > from {
+			from = start
+		}
+		entries, err := txn.Scan(from, end)
+		if err != nil {
+			return err
+		}
+		batch := entries[:0]
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Key, window) && entry.Key >= start && entry.Key < end {
+				batch = append(batch, entry)
+			}
+		}
+		for len(batch) > limit {
+			if !fn(batch[limit].Key, batch[:limit]) {
+				return nil
+			}
+			batch = batch[limit:]
+		}
+		if len(batch) > 0 && !fn(end, batch) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func isTableKey(key string) bool {
+	return strings.HasPrefix(key, tableDataPrefix)
+}
+
+func parseTableID(b string) tableID {
+	return tableID(binary.BigEndian.Uint64([]byte(b)))
+}
+
+// readTable returns the ID of the table with the given name, or false if
+// there is none
+func readTable(txn *simpledb.Txn, name string) (tableID, bool, error) {
+	if name == "" {
+		return defaultTable, true, nil
+	}
+	entry, err := txn.Read(tablePrefix + name)
+	if err != nil {
+		if _, ok := err.(*simpledb.ErrKeyNotFound); ok {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	value, ok := entry.Attributes[idAttribute]
+	if !ok {
+		return 0, false, fmt.Errorf("table %v has no id", name)
+	}
+	return tableID(bytesToUint64(value.Data)), true, nil
+}
+
+// checkTable returns an error if the table does not exist
+func checkTable(txn *simpledb.Txn, id tableID) error {
+	if id == defaultTable {
+		return nil
+	}
+	exists, err := txn.Exists(tableIDPrefix + id.bytes())
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("table %d was dropped", id)
+	}
+	return nil
+}
+
+// readLastTable returns the ID of the last table created
+func readLastTable(txn *simpledb.Txn) (uint64, error) {
+	entry, err := txn.Read(nextTableKey)
+	if err != nil {
+		if _, ok := err.(*simpledb.ErrKeyNotFound); ok {
+			return 0, nil
+		}
+		return 0, err
+	}
+	if value, ok := entry.Attributes[idAttribute]; ok {
+		return bytesToUint64(value.Data), nil
+	}
+	return 0, nil
+}
+
+// applyCreateTable creates the table named Key with the ID the leader chose
+// in Values, which must be greater than any ID taken, or with the next ID if
+// there is none, as proposed by earlier versions
+func applyCreateTable(txn *simpledb.Txn, c *Command) (uint64, error) {
+	if _, exists, err := readTable(txn, c.Key); err != nil {
+		return 0, err
+	} else if exists {
+		return 0, fmt.Errorf("table %v already exists", c.Key)
+	}
+	last, err := readLastTable(txn)
+	if err != nil {
+		return 0, err
+	}
+	id := tableID(last + 1)
+	if value, ok := c.Values[idAttribute]; ok {
+		id = tableID(bytesToUint64(value.Data))
+		if uint64(id) <= last {
+			return 0, fmt.Errorf("table ID %d is already taken", id)
+		}
+	}
+	idValue := map[string]*simpledb.Value{
+		idAttribute: {DataType: simpledb.Uint, Data: uint64ToBytes(uint64(id))},
+	}
+	txn.Write(nextTableKey, idValue)
+	txn.Write(tablePrefix+c.Key, idValue)
+	txn.Write(tableIDPrefix+id.bytes(), map[string]*simpledb.Value{
+		nameAttribute: {DataType: simpledb.String, Data: []byte(c.Key)},
+	})
+	return uint64(id), nil
+}
+
+// applyDropTable removes the table named Key with its indexes and schemas,
+// leaving its entries to be purged
+func applyDropTable(txn *simpledb.Txn, c *Command) (uint64, error) {
+	id, exists, err := readTable(txn, c.Key)
+	if err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, fmt.Errorf("table %v does not exist", c.Key)
+	}
+	defs, err := readIndexes(txn, id)
+	if err != nil {
+		return 0, err
+	}
+	for _, def := range defs {
+		txn.Delete(indexDefKey(id, def.attribute))
+	}
+	schemas, err := readSchemas(txn, id)
+	if err != nil {
+		return 0, err
+	}
+	for prefix := range schemas {
+		txn.Delete(schemaKey(id, prefix))
+	}
+	txn.Delete(tablePrefix + c.Key)
+	txn.Delete(tableIDPrefix + id.bytes())
+	txn.Write(droppedTablePrefix+id.bytes(), map[string]*simpledb.Value{
+		nameAttribute: {DataType: simpledb.String, Data: []byte(c.Key)},
+	})
+	return uint64(id), nil
+}
+
+// purgePrefixes returns the prefixes of the entries and index entries of a
+// table
+func purgePrefixes(id tableID) []string {
+	return []string{id.prefix(), indexTablePrefix(id)}
+}
+
+// applyPurgeTable deletes the keys from Key to EndKey of the dropped Table,
+// which must lie within one of its prefixes. Without a range, the table is
+// forgotten. It returns the number of keys deleted.
+func applyPurgeTable(txn *simpledb.Txn, c *Command) (uint64, error) {
+	id := tableID(c.Table)
+	if id == defaultTable {
+		return 0, fmt.Errorf("the default table cannot be purged")
+	}
+	if c.Key == "" && c.EndKey == "" {
+		txn.Delete(droppedTablePrefix + id.bytes())
+		return 0, nil
+	}
+	for _, prefix := range purgePrefixes(id) {
+		if !strings.HasPrefix(c.Key, prefix) || c.EndKey > prefixEnd(prefix) {
+			continue
+		}
+		entries, err := txn.Scan(c.Key, c.EndKey)
+		if err != nil {
+			return 0, err
+		}
+		count := uint64(0)
+		for _, entry := range entries {
+			if !strings.HasPrefix(entry.Key, prefix) || entry.Key < c.Key || entry.Key >= c.EndKey {
+				continue
+			}
+			txn.Delete(entry.Key)
+			count++
+		}
+		return count, nil
+	}
+	return 0, fmt.Errorf("purge range %q to %q is outside table %d", c.Key, c.EndKey, id)
+}
+
+// resolveTable returns the ID of a table known to this node
+func (node *Node) resolveTable(name string) (tableID, error) {
+	id, exists, err := readTable(node.store.db.StartTxn(), name)
+	if err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, status.Errorf(codes.NotFound, "table %v does not exist", name)
+	}
+	return id, nil
+}
+
+// tableKey returns the table and stored key of a key sent by a client.
+// Keys of the default table must not be reserved.
+func (node *Node) tableKey(table, key string) (tableID, string, error) {
+	id, err := node.resolveTable(table)
+	if err != nil {
+		return 0, "", err
+	}
+	if id == defaultTable {
+		if err := checkKey(key); err != nil {
+			return 0, "", err
+		}
+	}
+	return id, id.key(key), nil
+}
+
+// CreateTableRPC creates a table
+func (node *Node) CreateTableRPC(ctx context.Context, msg *pb.TableMsg) (*pb.OkMsg, error) {
+	if msg.Name == "" || strings.Contains(msg.Name, "\x00") {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid table name: %q", msg.Name)
+	}
+	// The leader chooses the ID, once it has applied every table created
+	// before, so that every server gives the table the same ID
+	node.tableMu.Lock()
+	defer node.tableMu.Unlock()
+	if err := node.linearizableRead(ctx); err != nil {
+		return nil, err
+	}
+	last, err := readLastTable(node.store.db.StartTxn())
+	if err != nil {
+		return nil, err
+	}
+	err = node.applyCommand(&Command{
+		Op:     CreateTable,
+		Key:    msg.Name,
+		Values: map[string]*simpledb.Value{idAttribute: {DataType: simpledb.Uint, Data: uint64ToBytes(last + 1)}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &pb.OkMsg{Ok: true}, nil
+}
+
+// DropTableRPC drops a table. Its entries are purged in the background.
+func (node *Node) DropTableRPC(ctx context.Context, msg *pb.TableMsg) (*pb.OkMsg, error) {
+	if msg.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "the default table cannot be dropped")
+	}
+	resp, err := node.apply(&Command{Op: DropTable, Key: msg.Name})
+	if err != nil {
+		return nil, err
+	}
+	if resp.err != nil {
+		return nil, resp.err
+	}
+	go node.purge(tableID(resp.count))
+	return &pb.OkMsg{Ok: true}, nil
+}
+
+// ListTablesRPC returns the names of the tables known to this node, not
+// including the default table
+func (node *Node) ListTablesRPC(ctx context.Context, msg *pb.EmptyMsg) (*pb.TablesMsg, error) {
+	entries, err := node.store.db.StartTxn().Scan(tablePrefix, prefixEnd(tablePrefix))
+	if err != nil {
+		return nil, err
+	}
+	result := &pb.TablesMsg{Names: []string{}}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Key, tablePrefix) {
+			result.Names = append(result.Names, entry.Key[len(tablePrefix):])
+		}
+	}
+	return result, nil
+}
+
+// purge proposes PurgeTable commands for a dropped table until its keys are
+// gone or this node stops being the leader
+func (node *Node) purge(id tableID) {
+	task := fmt.Sprintf("purge/%d", id)
+	if !node.tasks.start(task) {
+		return
+	}
+	defer node.tasks.done(task)
+
+	txn := node.store.db.StartTxn()
+	if exists, err := txn.Exists(droppedTablePrefix + id.bytes()); err != nil || !exists {
+		return
+	}
+	propose := func(c *Command) bool {
+		select {
+		case <-node.shutdownCh:
+			return false
+		default:
+		}
+		if node.raft.State() != raft.Leader {
+			return false
+		}
+		if err := node.applyCommand(c); err != nil {
+			log.Printf("purge table %d: %v", id, err)
+			return false
+		}
+		return true
+	}
+	// Each batch ends at the end of the window that fills it, and the last
+	// one at the end of the prefix
+	all := func(string) bool { return true }
+	for _, prefix := range purgePrefixes(id) {
+		start, n, ok := prefix, 0, true
+		err := scanWindows(txn, prefix, prefix, backfillBatchSize, all, func(end string, entries []*simpledb.Entry) bool {
+			if n += len(entries); n < backfillBatchSize {
+				return true
+			}
+			ok = propose(&Command{Op: PurgeTable, Table: uint64(id), Key: start, EndKey: end})
+			start, n = end, 0
+			return ok
+		})
+		if err != nil {
+			log.Printf("purge table %d: %v", id, err)
+			return
+		}
+		if !ok || n > 0 && !propose(&Command{Op: PurgeTable, Table: uint64(id), Key: start, EndKey: prefixEnd(prefix)}) {
+			return
+		}
+	}
+	if !propose(&Command{Op: PurgeTable, Table: uint64(id)}) {
+		return
+	}
+	log.Printf("purged table %d", id)
+}
+
+// resumePurges restarts the purge of every dropped table, after this node
+// became the leader
+func (node *Node) resumePurges() {
+	entries, err := node.store.db.StartTxn().Scan(droppedTablePrefix, prefixEnd(droppedTablePrefix))
+	if err != nil {
+		log.Printf("failed to resume table purges: %v", err)
+		return
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Key, droppedTablePrefix) && len(entry.Key) == len(droppedTablePrefix)+8 {
+			go node.purge(parseTableID(entry.Key[len(droppedTablePrefix):]))
+		}
+	}
+}
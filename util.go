@@ -3,7 +3,10 @@ package main
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"net"
+	"strconv"
+	"sync"
 
 	"github.com/hashicorp/go-msgpack/codec"
 )
@@ -11,10 +14,10 @@ import (
 // getOutboundIP() preferred outbound ip of this machine
 func getOutboundIP() (net.IP, error) {
 	conn, err := net.Dial("udp", "8.8.8.8:80")
-	defer conn.Close()
 	if err != nil {
 		return nil, err
 	}
+	defer conn.Close()
 	localAddr := conn.LocalAddr().(*net.UDPAddr)
 	return localAddr.IP, nil
 }
@@ -47,3 +50,38 @@ func uint64ToBytes(u uint64) []byte {
 	binary.LittleEndian.PutUint64(buf, u)
 	return buf
 }
+
+// parseStat parses a numeric field of raft.Stats()
+func parseStat(stats map[string]string, name string) (uint64, error) {
+	value, err := strconv.ParseUint(stats[name], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid raft stat %v: %v", name, err)
+	}
+	return value, nil
+}
+
+// tasks tracks the background tasks a node is running, by name
+type tasks struct {
+	mu      sync.Mutex
+	running map[string]bool
+}
+
+// start returns false if the task is already running
+func (t *tasks) start(name string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.running[name] {
+		return false
+	}
+	if t.running == nil {
+		t.running = make(map[string]bool)
+	}
+	t.running[name] = true
+	return true
+}
+
+func (t *tasks) done(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.running, name)
+}
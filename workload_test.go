@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/triplewy/simpledb/client"
+	pb "github.com/triplewy/simpledb/grpc"
+	"github.com/triplewy/simpledb/linearizability"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// workloadAttribute is the single attribute written and read by the workload
+const workloadAttribute = "value"
+
+// workloadConfig configures a randomized workload against a testCluster
+type workloadConfig struct {
+	clients   int
+	keys      int
+	duration  time.Duration
+	opTimeout time.Duration
+	// faultInterval is the time between injected partitions and restarts.
+	// No faults are injected if zero.
+	faultInterval time.Duration
+	seed          int64
+}
+
+// runWorkload runs concurrent clients issuing random inserts, updates,
+// deletes and reads while a nemesis partitions and restarts nodes, and
+// returns the recorded history
+func runWorkload(c *testCluster, config *workloadConfig) ([]linearizability.Operation, error) {
+	addrs := []string{}
+	for i := range c.nodes {
+		addrs = append(addrs, c.RPCAddr(i))
+	}
+	start := time.Now()
+	deadline := start.Add(config.duration)
+
+	var mu sync.Mutex
+	history := []linearizability.Operation{}
+	var wg sync.WaitGroup
+	errCh := make(chan error, config.clients+1)
+	for id := 0; id < config.clients; id++ {
+		cl, err := client.New(client.DefaultConfig(addrs...))
+		if err != nil {
+			return nil, err
+		}
+		defer cl.Close()
+		wg.Add(1)
+		go func(id int, cl *client.Client, r *rand.Rand) {
+			defer wg.Done()
+			for time.Now().Before(deadline) {
+				input := randomInput(r, config.keys)
+				call := time.Since(start).Nanoseconds()
+				output, known := doInput(cl, input, config.opTimeout)
+				ret := linearizability.Unknown
+				if known {
+					ret = time.Since(start).Nanoseconds()
+				}
+				mu.Lock()
+				history = append(history, linearizability.Operation{
+					ClientID: id,
+					Input:    input,
+					Call:     call,
+					Output:   output,
+					Return:   ret,
+				})
+				mu.Unlock()
+			}
+		}(id, cl, rand.New(rand.NewSource(config.seed+int64(id))))
+	}
+	if config.faultInterval > 0 {
+		wg.Add(1)
+		go func(r *rand.Rand) {
+			defer wg.Done()
+			if err := nemesis(c, r, deadline, config.faultInterval); err != nil {
+				errCh <- err
+			}
+		}(rand.New(rand.NewSource(config.seed - 1)))
+	}
+	wg.Wait()
+	close(errCh)
+	if err := <-errCh; err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// nemesis injects a random fault every interval until deadline, then heals
+// the cluster
+func nemesis(c *testCluster, r *rand.Rand, deadline time.Time, interval time.Duration) error {
+	for time.Now().Add(interval).Before(deadline) {
+		time.Sleep(interval)
+		switch r.Intn(3) {
+		case 0:
+			perm := r.Perm(len(c.nodes))
+			split := 1 + r.Intn(len(perm)-1)
+			c.Partition(perm[:split], perm[split:])
+		case 1:
+			c.Heal()
+		case 2:
+			if err := c.Restart(r.Intn(len(c.nodes))); err != nil {
+				return err
+			}
+		}
+	}
+	c.Heal()
+	return nil
+}
+
+func randomInput(r *rand.Rand, keys int) linearizability.KvInput {
+	input := linearizability.KvInput{
+		Op:  r.Intn(4),
+		Key: fmt.Sprintf("key%d", r.Intn(keys)),
+	}
+	if input.Op == linearizability.KvInsert || input.Op == linearizability.KvUpdate {
+		input.Attributes = map[string]string{workloadAttribute: fmt.Sprintf("%d", r.Intn(1000))}
+	}
+	return input
+}
+
+// doInput sends input to the cluster. It returns false if the outcome of the
+// request is unknown.
+func doInput(cl *client.Client, input linearizability.KvInput, timeout time.Duration) (interface{}, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var attributes []*pb.Attribute
+	for name, value := range input.Attributes {
+		attributes = append(attributes, &pb.Attribute{Name: name, Type: pb.Attribute_STRING, Value: []byte(value)})
+	}
+	var entry *pb.Entry
+	var err error
+	switch input.Op {
+	case linearizability.KvInsert:
+		err = cl.Insert(ctx, input.Key, attributes)
+	case linearizability.KvUpdate:
+		err = cl.Update(ctx, input.Key, attributes)
+	case linearizability.KvDelete:
+		err = cl.Delete(ctx, input.Key)
+	case linearizability.KvRead:
+		entry, err = cl.Read(ctx, input.Key, workloadAttribute)
+	}
+	// A read of a missing key fails with codes.NotFound. Writes rejected by
+	// the FSM fail with codes.Unknown, like a timed out or lost proposal
+	// might, so any other error leaves the outcome unknown.
+	if err != nil {
+		if input.Op == linearizability.KvRead && status.Code(err) == codes.NotFound {
+			return linearizability.KvOutput{Failed: true}, true
+		}
+		return nil, false
+	}
+	output := linearizability.KvOutput{}
+	if entry != nil {
+		output.Attributes = make(map[string]string)
+		for _, attribute := range entry.Attributes {
+			output.Attributes[attribute.Name] = string(attribute.Value)
+		}
+	}
+	return output, true
+}
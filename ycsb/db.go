@@ -4,61 +4,126 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"math/rand"
 	"os/user"
 	"path"
+	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/magiconair/properties"
 	"github.com/pingcap/go-ycsb/pkg/ycsb"
+	"github.com/triplewy/simpledb/client"
 	pb "github.com/triplewy/simpledb/grpc"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 )
 
+// go-ycsb properties understood by the simpledb binding
+const (
+	addrsProp            = "simpledb.addrs"
+	tlsProp              = "simpledb.tls"
+	certProp             = "simpledb.tls.cert"
+	consistencyProp      = "simpledb.consistency"
+	batchConcurrencyProp = "simpledb.batch.concurrency"
+	maxStalenessProp     = "simpledb.max_staleness"
+	maxLagEntriesProp    = "simpledb.max_staleness.entries"
+)
+
+// Consistency levels for reads and scans
+const (
+	// strongConsistency reads from the leader
+	strongConsistency = "strong"
+	// staleConsistency reads from a random node, which may lag the leader
+	staleConsistency = "stale"
+)
+
 type simpleDBCreator struct {
 }
 
 type simpleDBClient struct {
-	client pb.SimpleDbClient
-}
+	client           *client.Client
+	nodes            []pb.SimpleDbClient
+	conns            []*grpc.ClientConn
+	consistency      string
+	staleness        *pb.Staleness
+	batchConcurrency int
 
-type contextKey string
-
-const stateKey = contextKey("simpledb")
-
-type simpleDBState struct {
+	// tables are the tables known to exist, created on first use
+	tablesMu sync.Mutex
+	tables   map[string]*client.Table
 }
 
 func (c simpleDBCreator) Create(p *properties.Properties) (ycsb.DB, error) {
-	client, err := connect("localhost:8888")
+	addrs := strings.Split(p.GetString(addrsProp, "localhost:30000"), ",")
+	consistency := p.GetString(consistencyProp, strongConsistency)
+	if consistency != strongConsistency && consistency != staleConsistency {
+		return nil, fmt.Errorf("invalid %v: %v", consistencyProp, consistency)
+	}
+	creds, err := dialOption(p)
 	if err != nil {
 		return nil, err
 	}
-	return &simpleDBClient{
-		client: client,
-	}, nil
-}
 
-func connect(addr string) (pb.SimpleDbClient, error) {
-	usr, err := user.Current()
+	config := client.DefaultConfig(addrs...)
+	config.DialOptions = []grpc.DialOption{creds}
+	leaderClient, err := client.New(config)
 	if err != nil {
 		return nil, err
 	}
-	cert := path.Join(usr.HomeDir, ".ssl/cert.pem")
-	creds, err := credentials.NewClientTLSFromFile(cert, "")
-	if err != nil {
-		log.Fatalf("could not create credentials: %v", err)
+	db := &simpleDBClient{
+		client:           leaderClient,
+		consistency:      consistency,
+		batchConcurrency: p.GetInt(batchConcurrencyProp, 16),
+		tables:           make(map[string]*client.Table),
+	}
+	maxStaleness := p.GetParsedDuration(maxStalenessProp, 0)
+	maxLagEntries := p.GetInt(maxLagEntriesProp, 0)
+	if maxStaleness > 0 || maxLagEntries > 0 {
+		db.staleness = &pb.Staleness{
+			MaxLagMs:      int64(maxStaleness / time.Millisecond),
+			MaxLagEntries: uint64(maxLagEntries),
+		}
+	}
+	if consistency == staleConsistency {
+		for _, addr := range addrs {
+			conn, err := grpc.Dial(addr, creds)
+			if err != nil {
+				db.Close()
+				return nil, err
+			}
+			db.conns = append(db.conns, conn)
+			db.nodes = append(db.nodes, pb.NewSimpleDbClient(conn))
+		}
+	}
+	return db, nil
+}
+
+func dialOption(p *properties.Properties) (grpc.DialOption, error) {
+	if !p.GetBool(tlsProp, false) {
+		return grpc.WithInsecure(), nil
 	}
-	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(creds), grpc.WithBlock(), grpc.WithTimeout(3*time.Second))
+	cert := p.GetString(certProp, "")
+	if cert == "" {
+		usr, err := user.Current()
+		if err != nil {
+			return nil, err
+		}
+		cert = path.Join(usr.HomeDir, ".ssl/cert.pem")
+	}
+	creds, err := credentials.NewClientTLSFromFile(cert, "")
 	if err != nil {
-		log.Fatalf("did not connect: %v", err)
+		return nil, fmt.Errorf("could not create credentials: %v", err)
 	}
-	return pb.NewSimpleDbClient(conn), nil
+	return grpc.WithTransportCredentials(creds), nil
 }
 
 func (c *simpleDBClient) Close() error {
-	return nil
+	for _, conn := range c.conns {
+		conn.Close()
+	}
+	return c.client.Close()
 }
 
 func (c *simpleDBClient) InitThread(ctx context.Context, _ int, _ int) context.Context {
@@ -68,74 +133,179 @@ func (c *simpleDBClient) InitThread(ctx context.Context, _ int, _ int) context.C
 func (c *simpleDBClient) CleanupThread(_ context.Context) {
 }
 
+// table returns the table with the given name, creating it if it does not
+// exist yet
+func (c *simpleDBClient) table(ctx context.Context, name string) (*client.Table, error) {
+	c.tablesMu.Lock()
+	defer c.tablesMu.Unlock()
+	if t, ok := c.tables[name]; ok {
+		return t, nil
+	}
+	if err := c.client.CreateTable(ctx, name); err != nil && !strings.Contains(err.Error(), "already exists") {
+		return nil, err
+	}
+	t := c.client.Table(name)
+	c.tables[name] = t
+	return t, nil
+}
+
 func (c *simpleDBClient) Read(ctx context.Context, table string, key string, fields []string) (map[string][]byte, error) {
-	entry, err := c.client.ReadRPC(ctx, &pb.ReadMsg{Key: table + key, Fields: fields})
+	t, err := c.table(ctx, table)
 	if err != nil {
 		return nil, err
 	}
-	result := make(map[string][]byte)
-	for _, field := range entry.GetValues() {
-		result[field.GetName()] = field.GetValue()
+	var entry *pb.Entry
+	if c.consistency == staleConsistency {
+		entry, err = c.randomNode().ReadRPC(ctx, &pb.ReadMsg{Key: key, Attributes: fields, MaxStaleness: c.staleness, Table: table})
+	} else {
+		entry, err = t.Read(ctx, key, fields...)
 	}
-	return result, nil
+	if err != nil {
+		return nil, err
+	}
+	return attributesToFields(entry.GetAttributes()), nil
 }
 
+// Scan reads up to count entries starting at startKey. ScanRPC has no limit,
+// so the scan covers the rest of the table and is truncated here.
 func (c *simpleDBClient) Scan(ctx context.Context, table string, startKey string, count int, fields []string) ([]map[string][]byte, error) {
-	entries, err := c.client.ScanRPC(ctx, &pb.ReadMsg{Key: table + startKey, Fields: fields})
+	t, err := c.table(ctx, table)
 	if err != nil {
 		return nil, err
 	}
-	result := []map[string][]byte{}
-	for _, entry := range entries.GetEntries() {
-		fields := make(map[string][]byte)
-		for _, field := range entry.GetValues() {
-			fields[field.GetName()] = field.GetValue()
+	var entries []*pb.Entry
+	// the largest rune is valid UTF-8, unlike 0xff, and sorts after any key
+	end := string(utf8.MaxRune)
+	if c.consistency == staleConsistency {
+		msg, err := c.randomNode().ScanRPC(ctx, &pb.ScanMsg{StartKey: startKey, EndKey: end, Attributes: fields, MaxStaleness: c.staleness, Table: table})
+		if err != nil {
+			return nil, err
 		}
-		result = append(result, fields)
+		entries = msg.GetEntries()
+	} else {
+		entries, err = t.Scan(ctx, startKey, end, fields...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(entries) > count {
+		entries = entries[:count]
+	}
+	result := []map[string][]byte{}
+	for _, entry := range entries {
+		result = append(result, attributesToFields(entry.GetAttributes()))
 	}
 	return result, nil
 }
 
 func (c *simpleDBClient) Update(ctx context.Context, table string, key string, values map[string][]byte) error {
-	fields := []*pb.Field{}
-	for name, value := range values {
-		fields = append(fields, &pb.Field{Name: name, Value: value})
-	}
-	reply, err := c.client.UpdateRPC(ctx, &pb.Entry{Key: table + key, Values: fields})
+	t, err := c.table(ctx, table)
 	if err != nil {
-		fmt.Println(err)
 		return err
 	}
-	if !reply.GetOk() {
-		return errors.New("Error updating DB")
-	}
-	return nil
+	return t.Update(ctx, key, fieldsToAttributes(values))
 }
 
 func (c *simpleDBClient) Insert(ctx context.Context, table string, key string, values map[string][]byte) error {
-	fields := []*pb.Field{}
-	for name, value := range values {
-		fields = append(fields, &pb.Field{Name: name, Value: value})
-	}
-	reply, err := c.client.InsertRPC(ctx, &pb.Entry{Key: table + key, Values: fields})
+	t, err := c.table(ctx, table)
 	if err != nil {
 		return err
 	}
-	if !reply.GetOk() {
-		return errors.New("Error updating DB")
-	}
-	return nil
+	return t.Insert(ctx, key, fieldsToAttributes(values))
 }
 
 func (c *simpleDBClient) Delete(ctx context.Context, table string, key string) error {
-	reply, err := c.client.DeleteRPC(ctx, &pb.KeyMsg{Key: table + key})
+	t, err := c.table(ctx, table)
 	if err != nil {
 		return err
 	}
-	if !reply.GetOk() {
-		return errors.New("Error updating DB")
+	return t.Delete(ctx, key)
+}
+
+// BatchInsert inserts entries concurrently. There is no batch RPC, so each
+// entry is still a separate raft command.
+func (c *simpleDBClient) BatchInsert(ctx context.Context, table string, keys []string, values []map[string][]byte) error {
+	if len(keys) != len(values) {
+		return errors.New("keys and values must have the same length")
+	}
+	return c.batch(len(keys), func(i int) error {
+		return c.Insert(ctx, table, keys[i], values[i])
+	})
+}
+
+// BatchRead reads entries concurrently
+func (c *simpleDBClient) BatchRead(ctx context.Context, table string, keys []string, fields []string) ([]map[string][]byte, error) {
+	result := make([]map[string][]byte, len(keys))
+	err := c.batch(len(keys), func(i int) error {
+		values, err := c.Read(ctx, table, keys[i], fields)
+		result[i] = values
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// BatchUpdate updates entries concurrently
+func (c *simpleDBClient) BatchUpdate(ctx context.Context, table string, keys []string, values []map[string][]byte) error {
+	if len(keys) != len(values) {
+		return errors.New("keys and values must have the same length")
+	}
+	return c.batch(len(keys), func(i int) error {
+		return c.Update(ctx, table, keys[i], values[i])
+	})
+}
+
+// BatchDelete deletes entries concurrently
+func (c *simpleDBClient) BatchDelete(ctx context.Context, table string, keys []string) error {
+	return c.batch(len(keys), func(i int) error {
+		return c.Delete(ctx, table, keys[i])
+	})
+}
+
+// batch runs f for 0..n-1 with at most batchConcurrency calls in flight and
+// returns the first error
+func (c *simpleDBClient) batch(n int, f func(i int) error) error {
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	sem := make(chan struct{}, c.batchConcurrency)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := f(i); err != nil {
+				once.Do(func() { firstErr = err })
+			}
+		}(i)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+func (c *simpleDBClient) randomNode() pb.SimpleDbClient {
+	return c.nodes[rand.Intn(len(c.nodes))]
+}
+
+func attributesToFields(attributes []*pb.Attribute) map[string][]byte {
+	result := make(map[string][]byte)
+	for _, attribute := range attributes {
+		result[attribute.GetName()] = attribute.GetValue()
+	}
+	return result
+}
+
+func fieldsToAttributes(values map[string][]byte) []*pb.Attribute {
+	attributes := []*pb.Attribute{}
+	for name, value := range values {
+		attributes = append(attributes, &pb.Attribute{Name: name, Type: pb.Attribute_BYTES, Value: value})
 	}
-	return nil
+	return attributes
 }
 
 func init() {